@@ -37,6 +37,7 @@ import (
 	"github.com/k0sproject/k0s/cmd/start"
 	"github.com/k0sproject/k0s/cmd/status"
 	"github.com/k0sproject/k0s/cmd/stop"
+	"github.com/k0sproject/k0s/cmd/supervisorexec"
 	"github.com/k0sproject/k0s/cmd/sysinfo"
 	"github.com/k0sproject/k0s/cmd/token"
 	"github.com/k0sproject/k0s/cmd/validate"
@@ -96,6 +97,7 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(start.NewStartCmd())
 	cmd.AddCommand(status.NewStatusCmd())
 	cmd.AddCommand(stop.NewStopCmd())
+	cmd.AddCommand(supervisorexec.NewSupervisorExecCmd()) // hidden
 	cmd.AddCommand(sysinfo.NewSysinfoCmd())
 	cmd.AddCommand(token.NewTokenCmd())
 	cmd.AddCommand(validate.NewValidateCmd()) // hidden+deprecated
@@ -0,0 +1,37 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisorexec
+
+import (
+	"github.com/k0sproject/k0s/pkg/supervisor"
+
+	"github.com/spf13/cobra"
+)
+
+// NewSupervisorExecCmd returns the hidden command via which supervised
+// processes are started, if they need to be prepared beforehand.
+func NewSupervisorExecCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                supervisor.TrampolineCommand + " [options] -- <binary> [args...]",
+		Short:              "Prepare a supervised process and execute it (internal use only)",
+		Hidden:             true,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return supervisor.RunTrampoline(args)
+		},
+	}
+}
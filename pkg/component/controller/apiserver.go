@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -51,7 +52,7 @@ type APIServer struct {
 	EnableKonnectivity        bool
 	DisableEndpointReconciler bool
 	gid                       int
-	supervisor                supervisor.Supervisor
+	supervisor                supervisor.SupervisedProcess
 	uid                       int
 }
 
@@ -163,7 +164,13 @@ func (a *APIServer) Start(_ context.Context) error {
 		apiServerArgs = append(apiServerArgs, fmt.Sprintf("--%s=%s", name, value))
 	}
 
-	a.supervisor = supervisor.Supervisor{
+	etcdArgs, err := getEtcdArgs(a.ClusterConfig.Spec.Storage, a.K0sVars)
+	if err != nil {
+		return err
+	}
+	apiServerArgs = append(apiServerArgs, etcdArgs...)
+
+	a.supervisor = &supervisor.Supervisor{
 		Name:    kubeAPIComponentName,
 		BinPath: assets.BinPath(kubeAPIComponentName, a.K0sVars.BinDir),
 		RunDir:  a.K0sVars.RunDir,
@@ -173,12 +180,6 @@ func (a *APIServer) Start(_ context.Context) error {
 		GID:     a.gid,
 	}
 
-	etcdArgs, err := getEtcdArgs(a.ClusterConfig.Spec.Storage, a.K0sVars)
-	if err != nil {
-		return err
-	}
-	a.supervisor.Args = append(a.supervisor.Args, etcdArgs...)
-
 	return a.supervisor.Supervise()
 }
 
@@ -201,7 +202,13 @@ func (a *APIServer) writeKonnectivityConfig() error {
 
 // Stop stops APIServer
 func (a *APIServer) Stop() error {
-	return a.supervisor.Stop()
+	if a.supervisor == nil {
+		return nil
+	}
+	if err := a.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
 
 // Health-check interface
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path"
 	"path/filepath"
@@ -44,7 +45,7 @@ type Manager struct {
 	ServiceClusterIPRange string
 	ExtraArgs             string
 
-	supervisor     *supervisor.Supervisor
+	supervisor     supervisor.SupervisedProcess
 	uid, gid       int
 	previousConfig stringmap.StringMap
 }
@@ -145,7 +146,7 @@ func (a *Manager) Reconcile(_ context.Context, clusterConfig *v1beta1.ClusterCon
 		logger.Info("reconcile has nothing to do")
 		err := a.supervisor.Stop()
 		a.supervisor = nil
-		if err != nil {
+		if err != nil && !errors.Is(err, supervisor.ErrNotStarted) {
 			return err
 		}
 	}
@@ -166,7 +167,9 @@ func (a *Manager) Reconcile(_ context.Context, clusterConfig *v1beta1.ClusterCon
 // Stop stops Manager
 func (a *Manager) Stop() error {
 	if a.supervisor != nil {
-		return a.supervisor.Stop()
+		if err := a.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+			return err
+		}
 	}
 	return nil
 }
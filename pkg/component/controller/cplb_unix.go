@@ -51,7 +51,7 @@ type Keepalived struct {
 	KubeConfigPath   string
 	keepalivedConfig *keepalivedConfig
 	uid              int
-	supervisor       *supervisor.Supervisor
+	supervisor       supervisor.SupervisedProcess
 	log              *logrus.Entry
 	configFilePath   string
 	reconciler       *CPLBReconciler
@@ -157,7 +157,7 @@ func (k *Keepalived) Stop() error {
 	}
 
 	k.log.Infof("Stopping keepalived")
-	if err := k.supervisor.Stop(); err != nil {
+	if err := k.supervisor.Stop(); err != nil && !errors.Is(err, supervisor.ErrNotStarted) {
 		// Failed to stop keepalived. Don't delete the VIP, just in case.
 		return fmt.Errorf("failed to stop keepalived: %w", err)
 	}
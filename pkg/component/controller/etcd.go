@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -53,7 +54,7 @@ type Etcd struct {
 	K0sVars     *config.CfgVars
 	LogLevel    string
 
-	supervisor supervisor.Supervisor
+	supervisor supervisor.SupervisedProcess
 	uid        int
 	gid        int
 	ctx        context.Context
@@ -225,7 +226,7 @@ func (e *Etcd) Start(ctx context.Context) error {
 
 	logrus.Debugf("starting etcd with args: %v", args)
 
-	e.supervisor = supervisor.Supervisor{
+	e.supervisor = &supervisor.Supervisor{
 		Name:          "etcd",
 		BinPath:       assets.BinPath("etcd", e.K0sVars.BinDir),
 		RunDir:        e.K0sVars.RunDir,
@@ -241,11 +242,14 @@ func (e *Etcd) Start(ctx context.Context) error {
 
 // Stop stops etcd
 func (e *Etcd) Stop() error {
-	if e.Config.IsExternalClusterUsed() {
+	if e.Config.IsExternalClusterUsed() || e.supervisor == nil {
 		return nil
 	}
 
-	return e.supervisor.Stop()
+	if err := e.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
 
 func (e *Etcd) setupCerts(ctx context.Context) error {
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -30,7 +31,7 @@ import (
 type K0SControlAPI struct {
 	ConfigPath string
 	K0sVars    *config.CfgVars
-	supervisor supervisor.Supervisor
+	supervisor supervisor.SupervisedProcess
 }
 
 var _ manager.Component = (*K0SControlAPI)(nil)
@@ -49,7 +50,7 @@ func (m *K0SControlAPI) Start(_ context.Context) error {
 	if err != nil {
 		return err
 	}
-	m.supervisor = supervisor.Supervisor{
+	m.supervisor = &supervisor.Supervisor{
 		Name:    "k0s-control-api",
 		BinPath: selfExe,
 		RunDir:  m.K0sVars.RunDir,
@@ -65,5 +66,11 @@ func (m *K0SControlAPI) Start(_ context.Context) error {
 
 // Stop stops k0s api
 func (m *K0SControlAPI) Stop() error {
-	return m.supervisor.Stop()
+	if m.supervisor == nil {
+		return nil
+	}
+	if err := m.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -44,7 +45,7 @@ type Kine struct {
 	Config       *v1beta1.KineConfig
 	gid          int
 	K0sVars      *config.CfgVars
-	supervisor   supervisor.Supervisor
+	supervisor   supervisor.SupervisedProcess
 	uid          int
 	bypassClient *etcd.Client
 	ctx          context.Context
@@ -107,7 +108,7 @@ func (k *Kine) Start(ctx context.Context) error {
 	logrus.Info("Starting kine")
 	k.ctx = ctx
 
-	k.supervisor = supervisor.Supervisor{
+	k.supervisor = &supervisor.Supervisor{
 		Name:    "kine",
 		BinPath: assets.BinPath("kine", k.K0sVars.BinDir),
 		DataDir: k.K0sVars.DataDir,
@@ -130,7 +131,13 @@ func (k *Kine) Start(ctx context.Context) error {
 
 // Stop stops kine
 func (k *Kine) Stop() error {
-	return k.supervisor.Stop()
+	if k.supervisor == nil {
+		return nil
+	}
+	if err := k.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
 
 const hcKey = "/k0s-health-check"
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -49,7 +50,7 @@ type Konnectivity struct {
 	NodeConfig                 *v1beta1.ClusterConfig
 	K0sControllersLeaseCounter *K0sControllersLeaseCounter
 
-	supervisor      *supervisor.Supervisor
+	supervisor      supervisor.SupervisedProcess
 	uid             int
 	serverCount     int
 	serverCountChan <-chan int
@@ -169,7 +170,7 @@ func (k *Konnectivity) runServer(count int) error {
 	if k.supervisor != nil {
 		k.EmitWithPayload("restarting konnectivity server due to server count change",
 			map[string]interface{}{"serverCount": count})
-		if err := k.supervisor.Stop(); err != nil {
+		if err := k.supervisor.Stop(); err != nil && !errors.Is(err, supervisor.ErrNotStarted) {
 			k.log.Errorf("failed to stop supervisor: %s", err)
 		}
 	}
@@ -205,7 +206,10 @@ func (k *Konnectivity) Stop() error {
 		return nil
 	}
 	logrus.Debug("about to stop konnectivity supervisor")
-	return k.supervisor.Stop()
+	if err := k.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
 
 func (k *Konnectivity) Healthy() error {
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 
 	"github.com/sirupsen/logrus"
@@ -38,7 +39,7 @@ type Scheduler struct {
 	K0sVars        *config.CfgVars
 	LogLevel       string
 	SingleNode     bool
-	supervisor     *supervisor.Supervisor
+	supervisor     supervisor.SupervisedProcess
 	uid            int
 	previousConfig stringmap.StringMap
 }
@@ -66,7 +67,9 @@ func (a *Scheduler) Start(_ context.Context) error {
 // Stop stops Scheduler
 func (a *Scheduler) Stop() error {
 	if a.supervisor != nil {
-		return a.supervisor.Stop()
+		if err := a.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+			return err
+		}
 	}
 	return nil
 }
@@ -107,7 +110,7 @@ func (a *Scheduler) Reconcile(_ context.Context, clusterConfig *v1beta1.ClusterC
 		logrus.WithField("component", kubeSchedulerComponentName).Info("reconcile has nothing to do")
 		err := a.supervisor.Stop()
 		a.supervisor = nil
-		if err != nil {
+		if err != nil && !errors.Is(err, supervisor.ErrNotStarted) {
 			return err
 		}
 	}
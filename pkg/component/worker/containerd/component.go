@@ -60,7 +60,7 @@ const importsPathWindows = "C:\\etc\\k0s\\containerd.d\\"
 
 // Component implements the component interface to manage containerd as a k0s component.
 type Component struct {
-	supervisor    supervisor.Supervisor
+	supervisor    supervisor.SupervisedProcess
 	LogLevel      string
 	K0sVars       *config.CfgVars
 	Profile       *workerconfig.Profile
@@ -133,7 +133,7 @@ func (c *Component) Start(ctx context.Context) error {
 			return fmt.Errorf("failed to start windows server: %w", err)
 		}
 	} else {
-		c.supervisor = supervisor.Supervisor{
+		c.supervisor = &supervisor.Supervisor{
 			Name:    "containerd",
 			BinPath: assets.BinPath("containerd", c.K0sVars.BinDir),
 			RunDir:  c.K0sVars.RunDir,
@@ -311,7 +311,13 @@ func (c *Component) Stop() error {
 	if runtime.GOOS == "windows" {
 		return c.windowsStop()
 	}
-	return c.supervisor.Stop()
+	if c.supervisor == nil {
+		return nil
+	}
+	if err := c.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
 
 // This is the md5sum of the default k0s containerd config file before 1.27
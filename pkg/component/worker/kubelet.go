@@ -19,6 +19,7 @@ package worker
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -58,7 +59,7 @@ type Kubelet struct {
 	StaticPods          StaticPods
 	LogLevel            string
 	dataDir             string
-	supervisor          supervisor.Supervisor
+	supervisor          supervisor.SupervisedProcess
 	ClusterDNS          string
 	Labels              []string
 	Taints              []string
@@ -204,7 +205,7 @@ func (k *Kubelet) Start(ctx context.Context) error {
 		args.Merge(extras)
 	}
 	logrus.Debugf("starting kubelet with args: %v", args)
-	k.supervisor = supervisor.Supervisor{
+	k.supervisor = &supervisor.Supervisor{
 		Name:    cmd,
 		BinPath: assets.BinPath(cmd, k.K0sVars.BinDir),
 		RunDir:  k.K0sVars.RunDir,
@@ -227,7 +228,13 @@ func (k *Kubelet) Start(ctx context.Context) error {
 
 // Stop stops kubelet
 func (k *Kubelet) Stop() error {
-	return k.supervisor.Stop()
+	if k.supervisor == nil {
+		return nil
+	}
+	if err := k.supervisor.Stop(); !errors.Is(err, supervisor.ErrNotStarted) {
+		return err
+	}
+	return nil
 }
 
 func (k *Kubelet) prepareLocalKubeletConfig(kubeletConfigData kubeletConfig) (string, error) {
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// accessLogEntry is a line of the AccessLog.
+type accessLogEntry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	User   string    `json:"user"`
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// audit records a call of the given method in AccessLog, if set. The call
+// failed if err isn't nil. Returns after the entry has been written.
+func (s *Supervisor) audit(method string, err error) {
+	if s.AccessLog == nil {
+		return
+	}
+
+	entry := accessLogEntry{
+		Time:   time.Now().UTC(),
+		Method: method,
+		User:   os.Getenv("USER"),
+		Result: "ok",
+	}
+	if err != nil {
+		entry.Result, entry.Error = "error", err.Error()
+	}
+
+	line, err := json.Marshal(&entry)
+	if err == nil {
+		s.accessLogMutex.Lock()
+		_, err = s.AccessLog.Write(append(line, '\n'))
+		s.accessLogMutex.Unlock()
+	}
+	if err != nil && s.log != nil {
+		s.log.WithError(err).Errorf("Failed to write access log entry for %s", method)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	t.Setenv("USER", "auditor")
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	var accessLog bytes.Buffer
+	s := Supervisor{
+		Name:             t.Name(),
+		BinPath:          sleep.binPath,
+		Args:             sleep.binArgs,
+		RunDir:           t.TempDir(),
+		ConfidentialMode: true,
+		AccessLog:        &accessLog,
+	}
+	assert.ErrorIs(t, s.Stop(), ErrNotStarted)
+	require.NoError(t, s.Supervise())
+	assert.ErrorIs(t, s.Thaw(), ErrNotFrozen)
+	require.NoError(t, s.Stop())
+
+	lines := strings.Split(strings.TrimSuffix(accessLog.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	var entries []accessLogEntry
+	for _, line := range lines {
+		var entry accessLogEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.WithinDuration(t, time.Now(), entry.Time, time.Minute)
+		assert.Equal(t, "auditor", entry.User)
+		entry.Time, entry.User = time.Time{}, ""
+		entries = append(entries, entry)
+	}
+	assert.Equal(t, []accessLogEntry{
+		{Method: "Stop", Result: "error", Error: ErrNotStarted.Error()},
+		{Method: "Thaw", Result: "error", Error: ErrNotFrozen.Error()},
+		{Method: "Stop", Result: "ok"},
+	}, entries)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// The number of graceful shutdowns that need to be observed before the
+	// stop timeout is adapted.
+	minShutdownSamples = 5
+	// The number of most recent graceful shutdowns that the adaptive stop
+	// timeout is based on.
+	maxShutdownSamples = 20
+)
+
+// stopTimeout returns the time to wait for the supervised process to
+// terminate after it has been asked to. In AdaptiveTimeout mode, this is the
+// average duration of the recent graceful shutdowns plus two standard
+// deviations, at most MaxTimeoutStop. TimeoutStop is used until enough
+// shutdowns have been observed.
+func (s *Supervisor) stopTimeout() time.Duration {
+	if !s.AdaptiveTimeout {
+		return s.TimeoutStop
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return adaptiveTimeout(s.shutdowns, s.TimeoutStop, s.MaxTimeoutStop)
+}
+
+func adaptiveTimeout(samples []time.Duration, fallback, limit time.Duration) time.Duration {
+	if len(samples) < minShutdownSamples {
+		return fallback
+	}
+
+	var mean float64
+	for _, sample := range samples {
+		mean += float64(sample)
+	}
+	mean /= float64(len(samples))
+
+	var variance float64
+	for _, sample := range samples {
+		deviation := float64(sample) - mean
+		variance += deviation * deviation
+	}
+	variance /= float64(len(samples))
+
+	return min(time.Duration(mean+2*math.Sqrt(variance)), limit)
+}
+
+// recordShutdown remembers the duration of a graceful shutdown of the
+// supervised process in AdaptiveTimeout mode, and persists it to StateFile,
+// if configured.
+func (s *Supervisor) recordShutdown(duration time.Duration) {
+	if !s.AdaptiveTimeout {
+		return
+	}
+
+	s.mutex.Lock()
+	s.shutdowns = append(s.shutdowns, duration)
+	if len(s.shutdowns) > maxShutdownSamples {
+		s.shutdowns = s.shutdowns[len(s.shutdowns)-maxShutdownSamples:]
+	}
+	shutdowns := slices.Clone(s.shutdowns)
+	s.mutex.Unlock()
+
+	if s.StateFile == "" {
+		return
+	}
+	state, err := s.readStateFile()
+	if err == nil {
+		state.Shutdowns = shutdowns
+		err = s.writeStateFile(state)
+	}
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to record shutdown duration")
+	}
+}
+
+// loadShutdowns restores the durations of previous graceful shutdowns from
+// StateFile in AdaptiveTimeout mode.
+func (s *Supervisor) loadShutdowns() {
+	if !s.AdaptiveTimeout || s.StateFile == "" {
+		return
+	}
+
+	state, err := s.readStateFile()
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to load shutdown durations")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.shutdowns = state.Shutdowns
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveTimeout_Converges(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	rng := rand.New(rand.NewPCG(1, 2))
+	newSupervisor := func() *Supervisor {
+		s := &Supervisor{
+			Name:            t.Name(),
+			TimeoutStop:     time.Second,
+			AdaptiveTimeout: true,
+			MaxTimeoutStop:  time.Minute,
+			StateFile:       stateFile,
+			log:             logrus.WithField("component", t.Name()),
+		}
+		s.loadShutdowns()
+		return s
+	}
+
+	// Simulate restarts of k0s, with a single shutdown each, taking between
+	// two and three seconds.
+	for i := range 10 {
+		s := newSupervisor()
+		if i < minShutdownSamples {
+			assert.Equal(t, time.Second, s.stopTimeout(), "Adapted too early in round %d", i)
+		} else {
+			assert.Greater(t, s.stopTimeout(), 2*time.Second, "Didn't adapt in round %d", i)
+		}
+		s.recordShutdown(2*time.Second + time.Duration(rng.Int64N(int64(time.Second))))
+	}
+
+	// The mean of the distribution is 2.5s, its standard deviation ~0.29s.
+	assert.InDelta(t, 3080*time.Millisecond, newSupervisor().stopTimeout(), float64(400*time.Millisecond))
+}
+
+func TestAdaptiveTimeout_Limit(t *testing.T) {
+	samples := []time.Duration{time.Minute, 2 * time.Minute, time.Minute, 2 * time.Minute, time.Minute}
+	assert.Equal(t, 90*time.Second, adaptiveTimeout(samples, time.Second, 90*time.Second))
+	assert.Equal(t, time.Second, adaptiveTimeout(samples[:minShutdownSamples-1], time.Second, 90*time.Second))
+}
+
+func TestAdaptiveTimeout_RecordsShutdowns(t *testing.T) {
+	s := Supervisor{
+		Name:            t.Name(),
+		BinPath:         selectCmd(t, cmd{"sleep", []string{"60"}}).binPath,
+		Args:            []string{"60"},
+		RunDir:          t.TempDir(),
+		AdaptiveTimeout: true,
+	}
+	require.NoError(t, s.Supervise())
+	require.NoError(t, s.Stop())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if assert.Len(t, s.shutdowns, 1) {
+		assert.Less(t, s.shutdowns[0], s.TimeoutStop)
+	}
+	assert.Equal(t, time.Minute, s.MaxTimeoutStop)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// benchPollInterval is the interval in which Bench samples the resource usage.
+// It's a variable, so that tests can replace it.
+var benchPollInterval = 1 * time.Second
+
+// BenchResult describes the stability of a supervised process over a period of
+// time.
+type BenchResult struct {
+	// The duration of the benchmark.
+	Duration time.Duration `json:"duration"`
+	// The number of restarts of the process during the benchmark.
+	Restarts int `json:"restarts"`
+	// Whether the process has been running without any restarts.
+	Stable bool `json:"stable"`
+	// The CPU usage of the process, in CPUs, e.g. 0.5 means 50% of one CPU.
+	CPU BenchStats `json:"cpu"`
+	// The memory usage of the process, in bytes.
+	Memory BenchStats `json:"memory"`
+}
+
+// BenchStats summarizes the samples of a metric collected during a benchmark.
+type BenchStats struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Avg     float64 `json:"avg"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+}
+
+// Bench observes the supervised process for the given duration, sampling its
+// resource usage every second. The supervisor is started if it isn't already,
+// and stopped again afterwards in that case.
+func (s *Supervisor) Bench(duration time.Duration) (BenchResult, error) {
+	if !s.IsRunning() {
+		if err := s.Supervise(); err != nil {
+			return BenchResult{}, err
+		}
+		defer func() {
+			if err := s.Stop(); err != nil {
+				s.log.WithError(err).Warn("Failed to stop after benchmark")
+			}
+		}()
+	}
+
+	type sample struct {
+		pid   int
+		at    time.Time
+		usage ResourceUsage
+	}
+
+	var cpu, memory []float64
+	var prev *sample
+	poll := func() {
+		pid := s.Snapshot().PID
+		if pid == 0 {
+			prev = nil
+			return
+		}
+		usage, err := processResourceUsage(pid)
+		// A process without any resident memory is still being exec'ed.
+		if err != nil || usage.MemoryBytes == 0 {
+			prev = nil
+			return
+		}
+
+		current := &sample{pid, time.Now(), usage}
+		memory = append(memory, float64(usage.MemoryBytes))
+		if prev != nil && prev.pid == pid {
+			elapsed := current.at.Sub(prev.at)
+			cpu = append(cpu, float64(usage.CPUTime-prev.usage.CPUTime)/float64(elapsed))
+		}
+		prev = current
+	}
+
+	restarts := s.Snapshot().Restarts
+	start := time.Now()
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+	ticker := time.NewTicker(benchPollInterval)
+	defer ticker.Stop()
+
+	poll()
+	for polling := true; polling; {
+		select {
+		case <-ticker.C:
+			poll()
+		case <-deadline.C:
+			polling = false
+		}
+	}
+
+	result := BenchResult{
+		Duration: time.Since(start),
+		Restarts: s.Snapshot().Restarts - restarts,
+		CPU:      newBenchStats(cpu),
+		Memory:   newBenchStats(memory),
+	}
+	result.Stable = result.Restarts == 0
+	return result, nil
+}
+
+func newBenchStats(samples []float64) BenchStats {
+	stats := BenchStats{Samples: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, sample := range sorted {
+		sum += sample
+	}
+
+	// Nearest-rank percentiles.
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		return sorted[max(rank, 1)-1]
+	}
+
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.Avg = sum / float64(len(sorted))
+	stats.P50 = percentile(50)
+	stats.P95 = percentile(95)
+	stats.P99 = percentile(99)
+	return stats
+}
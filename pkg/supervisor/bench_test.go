@@ -0,0 +1,98 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBench(t *testing.T) {
+	oldInterval := benchPollInterval
+	benchPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { benchPollInterval = oldInterval })
+
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+	}
+
+	result, err := s.Bench(200 * time.Millisecond)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, result.Duration, 200*time.Millisecond)
+	assert.True(t, result.Stable)
+	assert.Zero(t, result.Restarts)
+	assert.False(t, s.IsRunning(), "Bench should stop the supervisor it started")
+
+	if runtime.GOOS == "linux" {
+		assert.Positive(t, result.Memory.Samples)
+		assert.Positive(t, result.Memory.Min)
+		assert.Positive(t, result.CPU.Samples)
+	}
+}
+
+func TestNewBenchStats(t *testing.T) {
+	samples := make([]float64, 100)
+	for i := range samples {
+		samples[i] = float64(100 - i)
+	}
+
+	assert.Equal(t, BenchStats{
+		Samples: 100,
+		Min:     1,
+		Max:     100,
+		Avg:     50.5,
+		P50:     50,
+		P95:     95,
+		P99:     99,
+	}, newBenchStats(samples))
+	assert.Equal(t, BenchStats{}, newBenchStats(nil))
+}
+
+func TestGetResourceUsage(t *testing.T) {
+	s := Supervisor{Name: t.Name()}
+	_, err := s.GetResourceUsage()
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	pingPong := pingpong.New(t)
+	s = Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	require.NoError(t, pingPong.AwaitPing())
+
+	usage, err := s.GetResourceUsage()
+	require.NoError(t, err)
+	assert.Positive(t, usage.MemoryBytes)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// executableInode returns the inode of the executable of the process with the
+// given pid, or zero if it can't be determined.
+func executableInode(log logrus.FieldLogger, pid int) uint64 {
+	var stat unix.Stat_t
+	if err := unix.Stat(fmt.Sprintf("/proc/%d/exe", pid), &stat); err != nil {
+		log.WithError(err).Debugf("Failed to determine executable of pid %d", pid)
+		return 0
+	}
+	return stat.Ino
+}
+
+// checkBinary warns if the binary of the exited process has been deleted or
+// replaced on disk while it was running, e.g. by a package manager.
+func (s *Supervisor) checkBinary() {
+	if s.binaryInode == 0 {
+		return
+	}
+	checkBinary(s.log, s.binaryPath, s.binaryInode)
+}
+
+func checkBinary(log logrus.FieldLogger, path string, startedInode uint64) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Binary %s has been deleted while the process was running", path)
+		} else {
+			log.WithError(err).Warnf("Failed to stat binary %s", path)
+		}
+		return
+	}
+
+	if stat.Ino != startedInode {
+		log.WithFields(logrus.Fields{
+			"startedInode": startedInode,
+			"currentInode": stat.Ino,
+			"modifiedAt":   time.Unix(stat.Mtim.Unix()).UTC(),
+		}).Warnf("Binary %s has been replaced while the process was running", path)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestExecutableInode(t *testing.T) {
+	log, _ := logtest.NewNullLogger()
+	executable, err := os.Executable()
+	require.NoError(t, err)
+
+	var stat unix.Stat_t
+	require.NoError(t, unix.Stat(executable, &stat))
+	assert.Equal(t, stat.Ino, executableInode(log, os.Getpid()))
+}
+
+func TestCheckBinary(t *testing.T) {
+	log, logs := logtest.NewNullLogger()
+	binPath := filepath.Join(t.TempDir(), "foo")
+	require.NoError(t, os.WriteFile(binPath, []byte("old"), 0755))
+
+	var stat unix.Stat_t
+	require.NoError(t, unix.Stat(binPath, &stat))
+
+	checkBinary(log, binPath, stat.Ino)
+	assert.Empty(t, logs.AllEntries(), "Unmodified binary shouldn't be reported")
+
+	// Replace the binary atomically, as package managers do.
+	newBinPath := binPath + ".new"
+	require.NoError(t, os.WriteFile(newBinPath, []byte("new"), 0755))
+	require.NoError(t, os.Rename(newBinPath, binPath))
+
+	checkBinary(log, binPath, stat.Ino)
+	if entry := logs.LastEntry(); assert.NotNil(t, entry) {
+		assert.Equal(t, logrus.WarnLevel, entry.Level)
+		assert.Contains(t, entry.Message, "has been replaced")
+		assert.Equal(t, stat.Ino, entry.Data["startedInode"])
+		assert.NotEqual(t, stat.Ino, entry.Data["currentInode"])
+		assert.Contains(t, entry.Data, "modifiedAt")
+	}
+
+	require.NoError(t, os.Remove(binPath))
+	checkBinary(log, binPath, stat.Ino)
+	if entry := logs.LastEntry(); assert.NotNil(t, entry) {
+		assert.Contains(t, entry.Message, "has been deleted")
+	}
+}
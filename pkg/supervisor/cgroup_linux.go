@@ -0,0 +1,108 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// joinCgroup moves the given PID into the cgroup v2 hierarchy at
+// s.CgroupPath, creating the cgroup if it doesn't exist yet.
+func (s *Supervisor) joinCgroup(pid int) error {
+	if err := os.MkdirAll(s.CgroupPath, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup %s: %w", s.CgroupPath, err)
+	}
+
+	procs := filepath.Join(s.CgroupPath, "cgroup.procs")
+	if err := os.WriteFile(procs, []byte(strconv.Itoa(pid)), 0); err != nil {
+		return fmt.Errorf("failed to move pid %d into cgroup %s: %w", pid, s.CgroupPath, err)
+	}
+
+	return nil
+}
+
+// cgroupContains checks whether the given PID is a member of the cgroup at
+// s.CgroupPath.
+func (s *Supervisor) cgroupContains(pid int) (bool, error) {
+	procs := filepath.Join(s.CgroupPath, "cgroup.procs")
+	content, err := os.ReadFile(procs)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", procs, err)
+	}
+	return slices.Contains(strings.Fields(string(content)), strconv.Itoa(pid)), nil
+}
+
+// setCgroupCPUQuota limits the CPU usage of the cgroup at s.CgroupPath to
+// s.CgroupCPUQuota.
+func (s *Supervisor) setCgroupCPUQuota() error {
+	period := s.CgroupCPUPeriodUs
+	if period == 0 {
+		period = cpuPeriodUs
+	}
+	quota := uint64(s.CgroupCPUQuota * float64(period))
+
+	cpuMax := filepath.Join(s.CgroupPath, "cpu.max")
+	if err := os.WriteFile(cpuMax, []byte(fmt.Sprintf("%d %d", quota, period)), 0); err != nil {
+		return fmt.Errorf("failed to set CPU quota of cgroup %s: %w", s.CgroupPath, err)
+	}
+
+	return nil
+}
+
+// setCgroupIOMax applies s.CgroupIOMax to the cgroup at s.CgroupPath. Device
+// paths are replaced by the devices' major and minor numbers.
+func (s *Supervisor) setCgroupIOMax() error {
+	ioMax := filepath.Join(s.CgroupPath, "io.max")
+	for _, line := range ioMaxLines(s.CgroupIOMax) {
+		device, limits, _ := strings.Cut(line, " ")
+		if strings.HasPrefix(device, "/") {
+			var err error
+			if device, err = blockDeviceNumber(device); err != nil {
+				return err
+			}
+		}
+
+		// The kernel only accepts a single device per write.
+		if err := os.WriteFile(ioMax, []byte(device+" "+strings.TrimSpace(limits)), 0); err != nil {
+			return fmt.Errorf("failed to set I/O limits of cgroup %s: %w", s.CgroupPath, err)
+		}
+	}
+
+	return nil
+}
+
+// blockDeviceNumber returns the block device at path in the form
+// "<major>:<minor>".
+func blockDeviceNumber(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok || stat.Mode()&os.ModeDevice == 0 || stat.Mode()&os.ModeCharDevice != 0 {
+		return "", fmt.Errorf("%s is not a block device", path)
+	}
+	return fmt.Sprintf("%d:%d", unix.Major(uint64(sys.Rdev)), unix.Minor(uint64(sys.Rdev))), nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestCgroupIOMax_DevicePath(t *testing.T) {
+	dir := t.TempDir()
+	device := filepath.Join(dir, "disk")
+	if err := unix.Mknod(device, unix.S_IFBLK|0600, int(unix.Mkdev(7, 42))); err != nil {
+		t.Skipf("Failed to create block device: %v", err)
+	}
+
+	s := Supervisor{CgroupPath: dir, CgroupIOMax: device + " wbps=1024\n8:0 riops=100\n"}
+	require.NoError(t, s.validateCgroupIOMax())
+	require.NoError(t, s.setCgroupIOMax())
+	// The two writes overwrite each other, whereas the kernel combines them.
+	if content, err := os.ReadFile(filepath.Join(dir, "io.max")); assert.NoError(t, err) {
+		assert.Equal(t, "8:0 riops=100", string(content))
+	}
+
+	s.CgroupIOMax = device + " wbps=1024"
+	require.NoError(t, s.setCgroupIOMax())
+	if content, err := os.ReadFile(filepath.Join(dir, "io.max")); assert.NoError(t, err) {
+		assert.Equal(t, "7:42 wbps=1024", string(content))
+	}
+
+	s.CgroupIOMax = filepath.Join(dir, "io.max") + " wbps=1024"
+	assert.ErrorContains(t, s.setCgroupIOMax(), "is not a block device")
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cpuPeriodUs is the default cgroup v2 CPU scheduling period.
+const cpuPeriodUs = 100000
+
+// CgroupGroupLimits are the resource limits shared by all supervised
+// processes of a cgroup group.
+type CgroupGroupLimits struct {
+	// The memory limit of the whole group. Zero means unlimited.
+	MemoryLimitBytes int64
+	// The CPU quota of the whole group, in CPUs, e.g. 0.5 means 50% of one
+	// CPU. Zero means unlimited.
+	CPUQuota float64
+}
+
+// CgroupGroupRegistry manages the parent cgroups of supervisors that share a
+// cgroup group. The parent cgroups are created on demand and removed as soon
+// as the last supervisor of a group has stopped.
+type CgroupGroupRegistry struct {
+	root string
+
+	mu     sync.Mutex
+	limits map[string]CgroupGroupLimits
+	refs   map[string]uint
+}
+
+// DefaultCgroupGroupRegistry is the registry used by supervisors having a
+// CgroupGroup.
+var DefaultCgroupGroupRegistry = NewCgroupGroupRegistry("/sys/fs/cgroup/k0s")
+
+// NewCgroupGroupRegistry creates a registry that creates its group cgroups
+// under the given cgroup v2 directory.
+func NewCgroupGroupRegistry(root string) *CgroupGroupRegistry {
+	return &CgroupGroupRegistry{
+		root:   root,
+		limits: make(map[string]CgroupGroupLimits),
+		refs:   make(map[string]uint),
+	}
+}
+
+// SetLimits configures the resource limits of the given group. They're applied
+// immediately if the group's cgroup already exists.
+func (r *CgroupGroupRegistry) SetLimits(group string, limits CgroupGroupLimits) error {
+	if err := validateCgroupGroupName(group); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits[group] = limits
+	if r.refs[group] > 0 {
+		return r.applyLimits(group, limits)
+	}
+	return nil
+}
+
+// acquire returns the path of the group's cgroup, creating it if required.
+// Each successful call needs to be paired with a call to release.
+func (r *CgroupGroupRegistry) acquire(group string) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("cgroups are not supported on %s", runtime.GOOS)
+	}
+	if err := validateCgroupGroupName(group); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := filepath.Join(r.root, group)
+	if r.refs[group] == 0 {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return "", fmt.Errorf("failed to create cgroup for group %q: %w", group, err)
+		}
+		// Delegate the controllers to the supervisors' cgroups. This is best
+		// effort, as the controllers may already be enabled.
+		for _, dir := range []string{filepath.Dir(r.root), r.root, path} {
+			_ = os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+cpu +memory"), 0)
+		}
+		if err := r.applyLimits(group, r.limits[group]); err != nil {
+			return "", err
+		}
+	}
+
+	r.refs[group]++
+	return path, nil
+}
+
+// release drops a reference to the group's cgroup acquired via acquire,
+// removing the cgroup when the last reference is gone.
+func (r *CgroupGroupRegistry) release(group string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.refs[group] {
+	case 0:
+		return nil
+	case 1:
+		delete(r.refs, group)
+		path := filepath.Join(r.root, group)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove cgroup for group %q: %w", group, err)
+		}
+		return nil
+	default:
+		r.refs[group]--
+		return nil
+	}
+}
+
+func (r *CgroupGroupRegistry) applyLimits(group string, limits CgroupGroupLimits) error {
+	path := filepath.Join(r.root, group)
+
+	memoryMax := "max"
+	if limits.MemoryLimitBytes > 0 {
+		memoryMax = fmt.Sprint(limits.MemoryLimitBytes)
+	}
+	if err := os.WriteFile(filepath.Join(path, "memory.max"), []byte(memoryMax), 0); err != nil {
+		return fmt.Errorf("failed to set memory limit for group %q: %w", group, err)
+	}
+
+	cpuMax := fmt.Sprintf("max %d", cpuPeriodUs)
+	if limits.CPUQuota > 0 {
+		cpuMax = fmt.Sprintf("%d %d", int64(limits.CPUQuota*cpuPeriodUs), cpuPeriodUs)
+	}
+	if err := os.WriteFile(filepath.Join(path, "cpu.max"), []byte(cpuMax), 0); err != nil {
+		return fmt.Errorf("failed to set CPU quota for group %q: %w", group, err)
+	}
+
+	return nil
+}
+
+// validateCgroupCPUQuota checks the CPU quota of the supervisor's cgroup.
+func (s *Supervisor) validateCgroupCPUQuota() error {
+	if s.CgroupCPUQuota == 0 {
+		return nil
+	}
+	if s.CgroupPath == "" && s.CgroupGroup == "" {
+		return errors.New("a CPU quota requires a cgroup")
+	}
+	if maxQuota := float64(runtime.NumCPU()); s.CgroupCPUQuota < 0.01 || s.CgroupCPUQuota > maxQuota {
+		return fmt.Errorf("CPU quota %g out of range [0.01, %g]", s.CgroupCPUQuota, maxQuota)
+	}
+	// The kernel accepts periods between 1ms and 1s.
+	if period := s.CgroupCPUPeriodUs; period != 0 && (period < 1000 || period > 1000000) {
+		return fmt.Errorf("CPU period %dus out of range [1000, 1000000]", period)
+	}
+	return nil
+}
+
+// validateCgroupIOMax checks the I/O limits of the supervisor's cgroup.
+func (s *Supervisor) validateCgroupIOMax() error {
+	if s.CgroupIOMax == "" {
+		return nil
+	}
+	if s.CgroupPath == "" && s.CgroupGroup == "" {
+		return errors.New("I/O limits require a cgroup")
+	}
+
+	for _, line := range ioMaxLines(s.CgroupIOMax) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid I/O limit %q: no limits given", line)
+		}
+		if device := fields[0]; !strings.HasPrefix(device, "/") && !isDeviceNumber(device) {
+			return fmt.Errorf("invalid I/O limit %q: invalid device %q", line, device)
+		}
+		for _, limit := range fields[1:] {
+			key, value, _ := strings.Cut(limit, "=")
+			switch key {
+			case "rbps", "wbps", "riops", "wiops":
+			default:
+				return fmt.Errorf("invalid I/O limit %q: unknown key %q", line, key)
+			}
+			if _, err := strconv.ParseUint(value, 10, 64); err != nil && value != "max" {
+				return fmt.Errorf("invalid I/O limit %q: invalid value for %s: %q", line, key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// ioMaxLines splits io.max content into its non-empty lines.
+func ioMaxLines(ioMax string) []string {
+	var lines []string
+	for _, line := range strings.Split(ioMax, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// isDeviceNumber returns whether device is in the form "<major>:<minor>".
+func isDeviceNumber(device string) bool {
+	major, minor, ok := strings.Cut(device, ":")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseUint(major, 10, 32)
+	if err == nil {
+		_, err = strconv.ParseUint(minor, 10, 32)
+	}
+	return err == nil
+}
+
+func validateCgroupGroupName(group string) error {
+	if group == "" || group == "." || group == ".." || strings.ContainsAny(group, `/\`) {
+		return fmt.Errorf("invalid cgroup group name: %q", group)
+	}
+	return nil
+}
+
+// leaveCgroupGroup removes the supervisor's cgroup from its cgroup group.
+func (s *Supervisor) leaveCgroupGroup() {
+	if err := os.Remove(s.CgroupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.log.WithError(err).Warn("Failed to remove cgroup")
+	}
+	if err := DefaultCgroupGroupRegistry.release(s.CgroupGroup); err != nil {
+		s.log.WithError(err).Warn("Failed to release cgroup group")
+	}
+}
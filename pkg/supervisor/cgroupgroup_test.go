@@ -0,0 +1,191 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupGroupRegistry(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are only supported on Linux")
+	}
+
+	root := t.TempDir()
+	r := NewCgroupGroupRegistry(root)
+	require.NoError(t, r.SetLimits("system", CgroupGroupLimits{
+		MemoryLimitBytes: 1 << 30,
+		CPUQuota:         1.5,
+	}))
+
+	path, err := r.acquire("system")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "system"), path)
+	if content, err := os.ReadFile(filepath.Join(path, "memory.max")); assert.NoError(t, err) {
+		assert.Equal(t, "1073741824", string(content))
+	}
+	if content, err := os.ReadFile(filepath.Join(path, "cpu.max")); assert.NoError(t, err) {
+		assert.Equal(t, "150000 100000", string(content))
+	}
+
+	// A second reference shares the same cgroup.
+	path2, err := r.acquire("system")
+	require.NoError(t, err)
+	assert.Equal(t, path, path2)
+	assert.Equal(t, uint(2), r.refs["system"])
+
+	// Updated limits are applied to existing cgroups.
+	require.NoError(t, r.SetLimits("system", CgroupGroupLimits{}))
+	if content, err := os.ReadFile(filepath.Join(path, "memory.max")); assert.NoError(t, err) {
+		assert.Equal(t, "max", string(content))
+	}
+
+	assert.NoError(t, r.release("system"))
+	assert.DirExists(t, path)
+	assert.Equal(t, uint(1), r.refs["system"])
+
+	// Releasing the last reference attempts to remove the cgroup. Since this
+	// is no real cgroupfs, the interface files prevent the removal.
+	assert.ErrorContains(t, r.release("system"), "failed to remove cgroup")
+	assert.NotContains(t, r.refs, "system")
+}
+
+func TestCgroupGroupRegistry_InvalidName(t *testing.T) {
+	r := NewCgroupGroupRegistry(t.TempDir())
+	for _, name := range []string{"", ".", "..", "a/b"} {
+		assert.ErrorContains(t, r.SetLimits(name, CgroupGroupLimits{}), "invalid cgroup group name")
+	}
+}
+
+func TestCgroupCPUQuota(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are only supported on Linux")
+	}
+
+	s := Supervisor{CgroupPath: t.TempDir(), CgroupCPUQuota: 0.5}
+	require.NoError(t, s.validateCgroupCPUQuota())
+	require.NoError(t, s.setCgroupCPUQuota())
+	if content, err := os.ReadFile(filepath.Join(s.CgroupPath, "cpu.max")); assert.NoError(t, err) {
+		assert.Equal(t, "50000 100000", string(content))
+	}
+
+	s.CgroupCPUPeriodUs = 10000
+	require.NoError(t, s.validateCgroupCPUQuota())
+	require.NoError(t, s.setCgroupCPUQuota())
+	if content, err := os.ReadFile(filepath.Join(s.CgroupPath, "cpu.max")); assert.NoError(t, err) {
+		assert.Equal(t, "5000 10000", string(content))
+	}
+}
+
+func TestCgroupCPUQuota_Invalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		s    *Supervisor
+		err  string
+	}{
+		{"no_cgroup", &Supervisor{CgroupCPUQuota: 1}, "a CPU quota requires a cgroup"},
+		{"too_small", &Supervisor{CgroupPath: "/foo", CgroupCPUQuota: 0.001}, "CPU quota 0.001 out of range"},
+		{"too_large", &Supervisor{CgroupGroup: "foo", CgroupCPUQuota: float64(runtime.NumCPU() + 1)}, "out of range"},
+		{"period", &Supervisor{CgroupPath: "/foo", CgroupCPUQuota: 1, CgroupCPUPeriodUs: 100}, "CPU period 100us out of range"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ErrorContains(t, test.s.validateCgroupCPUQuota(), test.err)
+		})
+	}
+}
+
+func TestCgroupIOMax(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are only supported on Linux")
+	}
+
+	s := Supervisor{CgroupPath: t.TempDir(), CgroupIOMax: "8:0 rbps=1048576 wiops=max"}
+	require.NoError(t, s.validateCgroupIOMax())
+	require.NoError(t, s.setCgroupIOMax())
+	if content, err := os.ReadFile(filepath.Join(s.CgroupPath, "io.max")); assert.NoError(t, err) {
+		assert.Equal(t, "8:0 rbps=1048576 wiops=max", string(content))
+	}
+}
+
+func TestCgroupIOMax_Invalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		s    *Supervisor
+		err  string
+	}{
+		{"no_cgroup", &Supervisor{CgroupIOMax: "8:0 rbps=1"}, "I/O limits require a cgroup"},
+		{"no_limits", &Supervisor{CgroupPath: "/foo", CgroupIOMax: "8:0"}, "no limits given"},
+		{"device", &Supervisor{CgroupPath: "/foo", CgroupIOMax: "sda rbps=1"}, `invalid device "sda"`},
+		{"key", &Supervisor{CgroupPath: "/foo", CgroupIOMax: "8:0 rbps=1 bps=1"}, `unknown key "bps"`},
+		{"value", &Supervisor{CgroupGroup: "foo", CgroupIOMax: "/dev/sda riops=-1"}, `invalid value for riops: "-1"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ErrorContains(t, test.s.validateCgroupIOMax(), test.err)
+		})
+	}
+}
+
+func TestCgroupGroup_ReleasedOnFailedStart(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are only supported on Linux")
+	}
+
+	oldRegistry := DefaultCgroupGroupRegistry
+	t.Cleanup(func() { DefaultCgroupGroupRegistry = oldRegistry })
+
+	// A regular file can't be used as a directory.
+	notADir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notADir, nil, 0644))
+
+	for _, test := range []struct {
+		name  string
+		setup func(*Supervisor)
+	}{
+		{"log_files", func(s *Supervisor) { s.StdoutFile = filepath.Join(notADir, "stdout.log") }},
+		{"lease_client", func(s *Supervisor) {
+			oldNewLeaseClient := newLeaseClient
+			newLeaseClient = func(string) (leaseClient, error) { return nil, assert.AnError }
+			t.Cleanup(func() { newLeaseClient = oldNewLeaseClient })
+			s.LeaseEndpoint = "http://127.0.0.1:2379"
+		}},
+		{"inherited_listeners", func(s *Supervisor) { s.InheritedListeners = []string{filepath.Join(notADir, "sock")} }},
+		{"first_start", func(s *Supervisor) { s.BinPath = filepath.Join(notADir, "missing") }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewCgroupGroupRegistry(t.TempDir())
+			DefaultCgroupGroupRegistry = r
+
+			s := Supervisor{
+				Name:        t.Name(),
+				BinPath:     "true",
+				RunDir:      t.TempDir(),
+				CgroupPath:  "/sys/fs/cgroup/configured",
+				CgroupGroup: "system",
+			}
+			test.setup(&s)
+			assert.Error(t, s.Supervise())
+			assert.NotContains(t, r.refs, "system", "Cgroup group hasn't been released")
+			assert.Equal(t, "/sys/fs/cgroup/configured", s.CgroupPath)
+		})
+	}
+}
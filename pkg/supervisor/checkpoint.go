@@ -0,0 +1,113 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Checkpoint saves the state of the supervised process into destDir using
+// CRIU, so that it can be restored later on, possibly on another host. The
+// process keeps running. Requires root privileges and CRIU, see CRIUBinary.
+func (s *Supervisor) Checkpoint(destDir string) error {
+	criu, err := s.criuBinary()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	var pid int
+	if s.state.hasProcess() && s.cmd != nil && s.cmd.Process != nil {
+		pid = s.cmd.Process.Pid
+	}
+	s.mutex.Unlock()
+	if pid == 0 {
+		return s.errNotRunning()
+	}
+
+	if err := os.MkdirAll(destDir, 0700); err != nil {
+		return err
+	}
+
+	if err := runCommand(criu, "dump", "-t", strconv.Itoa(pid), "-D", destDir, "--leave-running"); err != nil {
+		return fmt.Errorf("failed to checkpoint pid %d: %w", pid, err)
+	}
+
+	s.log.Infof("Checkpointed pid %d into %s", pid, destDir)
+	return nil
+}
+
+// Restore restores a process from a checkpoint in srcDir that has been
+// created by [Supervisor.Checkpoint]. The restored process is detached and
+// isn't supervised. Requires root privileges and CRIU, see CRIUBinary.
+func (s *Supervisor) Restore(srcDir string) error {
+	criu, err := s.criuBinary()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(srcDir); err != nil {
+		return fmt.Errorf("invalid checkpoint: %w", err)
+	}
+
+	if err := runCommand(criu, "restore", "-D", srcDir, "--restore-detached"); err != nil {
+		return fmt.Errorf("failed to restore checkpoint %s: %w", srcDir, err)
+	}
+	return nil
+}
+
+// criuBinary checks the prerequisites for running CRIU and returns the path
+// to its binary.
+func (s *Supervisor) criuBinary() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("checkpoints are not supported on %s", runtime.GOOS)
+	}
+	if os.Geteuid() != 0 {
+		return "", errors.New("checkpoints require root privileges")
+	}
+
+	criu := s.CRIUBinary
+	if criu == "" {
+		criu = "criu"
+	}
+	path, err := exec.LookPath(criu)
+	if err != nil {
+		return "", fmt.Errorf("CRIU is required for checkpoints: %w", err)
+	}
+	return path, nil
+}
+
+// runCommand runs the given command, including its output in the error, if
+// any.
+func runCommand(name string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		if out := bytes.TrimSpace(out.Bytes()); len(out) > 0 {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
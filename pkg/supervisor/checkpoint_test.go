@@ -0,0 +1,103 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCRIU writes a fake CRIU binary that records its args and fails if the
+// FAKE_CRIU_FAIL environment variable is set.
+func fakeCRIU(t *testing.T) (binPath, argsFile string) {
+	dir := t.TempDir()
+	binPath, argsFile = filepath.Join(dir, "criu"), filepath.Join(dir, "args")
+	require.NoError(t, os.WriteFile(binPath, []byte(`#!/bin/sh
+if [ -n "$FAKE_CRIU_FAIL" ]; then
+  echo "$FAKE_CRIU_FAIL" >&2
+  exit 1
+fi
+printf '%s\n' "$@" >"`+argsFile+`"
+`), 0700))
+	return binPath, argsFile
+}
+
+func TestCheckpoint(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Checkpoints are Linux only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("Checkpoints require root privileges")
+	}
+
+	criu, argsFile := fakeCRIU(t)
+	pingPong := pingpong.New(t)
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:       t.Name(),
+		BinPath:    pingPong.BinPath(),
+		RunDir:     t.TempDir(),
+		Args:       pingPong.BinArgs(),
+		CRIUBinary: criu,
+		OnStart:    func(pid int) { pids <- pid },
+	}
+
+	assert.ErrorIs(t, s.Checkpoint(t.TempDir()), ErrNotRunning)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	destDir := filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, s.Checkpoint(destDir))
+	assert.DirExists(t, destDir)
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dump", "-t", strconv.Itoa(pid), "-D", destDir, "--leave-running"}, strings.Fields(string(args)))
+
+	require.NoError(t, s.Restore(destDir))
+	args, err = os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"restore", "-D", destDir, "--restore-detached"}, strings.Fields(string(args)))
+
+	t.Setenv("FAKE_CRIU_FAIL", "no such process")
+	err = s.Checkpoint(destDir)
+	assert.ErrorContains(t, err, "failed to checkpoint pid "+strconv.Itoa(pid))
+	assert.ErrorContains(t, err, "no such process")
+}
+
+func TestCheckpoint_Prerequisites(t *testing.T) {
+	s := Supervisor{CRIUBinary: filepath.Join(t.TempDir(), "criu")}
+	err := s.Restore(t.TempDir())
+	switch {
+	case runtime.GOOS != "linux":
+		assert.ErrorContains(t, err, "checkpoints are not supported on "+runtime.GOOS)
+	case os.Geteuid() != 0:
+		assert.ErrorContains(t, err, "checkpoints require root privileges")
+	default:
+		assert.ErrorContains(t, err, "CRIU is required for checkpoints")
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errChecksumMismatch is returned if a binary doesn't match its checksum.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+func (s *Supervisor) validateBinaryChecksum() error {
+	if !s.ValidateBinaryChecksum || s.BinaryChecksum == "" {
+		return nil
+	}
+	if sum, err := hex.DecodeString(s.BinaryChecksum); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 checksum: %q", s.BinaryChecksum)
+	}
+	return nil
+}
+
+// verifyChecksum checks that the SHA-256 checksum of the file at path matches
+// the hex encoded expected checksum.
+func verifyChecksum(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The file is read in chunks, so that large binaries don't need to fit
+	// into memory.
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to compute checksum of %s: %w", path, err)
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: SHA-256 of %s is %s, expected %s", errChecksumMismatch, path, actual, expected)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bin")
+	require.NoError(t, os.WriteFile(path, []byte("binary"), 0600))
+	sum := sha256.Sum256([]byte("binary"))
+
+	assert.NoError(t, verifyChecksum(path, hex.EncodeToString(sum[:])))
+
+	err := verifyChecksum(path, hex.EncodeToString(make([]byte, sha256.Size)))
+	assert.ErrorIs(t, err, errChecksumMismatch)
+	assert.ErrorContains(t, err, hex.EncodeToString(sum[:]))
+
+	assert.ErrorIs(t, verifyChecksum(filepath.Join(t.TempDir(), "missing"), ""), os.ErrNotExist)
+}
+
+func TestValidateBinaryChecksum(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test binary is a shell script")
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	script := []byte("#!/bin/sh\nexec sleep 0.1\n")
+	require.NoError(t, os.WriteFile(bin, script, 0700))
+	sum := sha256.Sum256(script)
+
+	crashes := make(chan CrashInfo, 10)
+	s := Supervisor{
+		Name:                   t.Name(),
+		BinPath:                bin,
+		RunDir:                 t.TempDir(),
+		TimeoutRespawn:         10 * time.Millisecond,
+		MaxRestarts:            2,
+		ValidateBinaryChecksum: true,
+		BinaryChecksum:         hex.EncodeToString(sum[:]),
+		OnCrash: func(info CrashInfo) {
+			if info.Reason == CrashReasonNormalExit {
+				// Tamper with the binary.
+				tmp := filepath.Join(dir, "bin.tmp")
+				if assert.NoError(t, os.WriteFile(tmp, []byte("#!/bin/sh\nexit 1\n"), 0700)) {
+					assert.NoError(t, os.Rename(tmp, bin))
+				}
+			}
+			crashes <- info
+		},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	// The first crash is the regular exit of the original binary.
+	assert.Equal(t, CrashReasonNormalExit, (<-crashes).Reason)
+	assert.Equal(t, CrashReasonChecksumMismatch, (<-crashes).Reason)
+	assert.Equal(t, CrashReasonChecksumMismatch, (<-crashes).Reason)
+
+	// The supervisor gives up after reaching MaxRestarts.
+	assert.Eventually(t, func() bool {
+		return s.Snapshot().State == ProcessStateStopped
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Len(t, crashes, 0)
+
+	invalid := Supervisor{
+		Name:                   t.Name(),
+		BinPath:                bin,
+		RunDir:                 t.TempDir(),
+		ValidateBinaryChecksum: true,
+		BinaryChecksum:         "invalid",
+	}
+	assert.ErrorContains(t, invalid.Supervise(), `invalid SHA-256 checksum: "invalid"`)
+}
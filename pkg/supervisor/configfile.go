@@ -0,0 +1,66 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+func (s *Supervisor) validateConfigMap() error {
+	if len(s.ConfigMap) > 0 && s.ConfigFileArg == "" {
+		return errors.New("a config file argument is required to pass a config map")
+	}
+	return nil
+}
+
+// writeConfigFile writes ConfigMap as YAML into a new temporary file in
+// RunDir, returning its path. The file is owned by the user as which the
+// supervised process runs.
+func (s *Supervisor) writeConfigFile() (_ string, err error) {
+	data, err := yaml.Marshal(s.ConfigMap)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config map: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.RunDir, s.Name+"-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create config file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, os.Remove(f.Name()))
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to write config file: %w", err), f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write config file: %w", err)
+	}
+	if os.Geteuid() == 0 {
+		if err := os.Chown(f.Name(), s.UID, s.GID); err != nil {
+			return "", fmt.Errorf("failed to change ownership of config file: %w", err)
+		}
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigMap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Requires a POSIX shell")
+	}
+
+	sh := selectCmd(t, cmd{binPath: "sh"})
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sh.binPath,
+		Args: []string{"-c", `
+[ "$1" = --config-file ] || exit 1
+echo "$2"
+cat "$2"
+exec sleep 60
+`, "sh"},
+		RunDir:        t.TempDir(),
+		ConfigMap:     map[string]string{"listen": "127.0.0.1:2379", "name": "etcd"},
+		ConfigFileArg: "--config-file",
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var output []string
+	require.Eventually(t, func() bool {
+		output = s.output.snapshot()
+		return len(output) >= 3
+	}, 10*time.Second, 10*time.Millisecond)
+
+	configFile := output[0]
+	assert.Equal(t, s.RunDir, filepath.Dir(configFile))
+	assert.Equal(t, []string{"listen: 127.0.0.1:2379", "name: etcd"}, output[1:])
+	assert.FileExists(t, configFile)
+
+	require.NoError(t, s.Stop())
+	assert.NoFileExists(t, configFile, "Config file should be removed after the process exited")
+}
+
+func TestConfigMap_RequiresArg(t *testing.T) {
+	s := Supervisor{
+		Name:      t.Name(),
+		BinPath:   "true",
+		RunDir:    t.TempDir(),
+		ConfigMap: map[string]string{"foo": "bar"},
+	}
+	assert.ErrorContains(t, s.Supervise(), "a config file argument is required")
+}
+
+func TestConfigMap_RemovedOnStartFailure(t *testing.T) {
+	s := Supervisor{
+		Name:                   t.Name(),
+		BinPath:                selectCmd(t, cmd{binPath: "true"}, cmd{binPath: "cmd"}).binPath,
+		RunDir:                 t.TempDir(),
+		ConfigMap:              map[string]string{"foo": "bar"},
+		ConfigFileArg:          "--config-file",
+		ValidateBinaryChecksum: true,
+		BinaryChecksum:         strings.Repeat("0", 64),
+	}
+	assert.ErrorIs(t, s.Supervise(), errChecksumMismatch)
+
+	entries, err := os.ReadDir(s.RunDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotEqual(t, ".yaml", filepath.Ext(entry.Name()), "Config file %s has been left behind", entry.Name())
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+)
+
+// setCoredumpFilter sets the memory mappings that are included in core dumps
+// of the given PID, see core(5).
+func setCoredumpFilter(pid int, filter uint32) error {
+	path := fmt.Sprintf("/proc/%d/coredump_filter", pid)
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%#x", filter)), 0); err != nil {
+		return fmt.Errorf("failed to set core dump filter of pid %d: %w", pid, err)
+	}
+	return nil
+}
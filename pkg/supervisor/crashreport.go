@@ -0,0 +1,87 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// CrashReport contains everything that's known about a supervised process
+// that's useful to debug its crashes.
+type CrashReport struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	State       SupervisorState    `json:"state"`
+	Crashes     []CrashInfo        `json:"crashes"`
+	RecoveryLog []RecoveryLogEntry `json:"recoveryLog"`
+	Output      []string           `json:"output"`
+	Host        HostInfo           `json:"host"`
+}
+
+// HostInfo describes the host on which a crash report has been generated.
+type HostInfo struct {
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	KernelVersion string `json:"kernelVersion,omitempty"`
+	TotalMemory   uint64 `json:"totalMemory,omitempty"`
+	CPUs          int    `json:"cpus"`
+}
+
+// GenerateCrashReport returns a gzipped JSON encoded [CrashReport] for this
+// supervisor, suitable to be written to disk or attached to a support bundle.
+func (s *Supervisor) GenerateCrashReport() ([]byte, error) {
+	report := CrashReport{
+		GeneratedAt: time.Now(),
+		Host:        getHostInfo(),
+	}
+
+	s.mutex.Lock()
+	report.State = s.snapshotLocked()
+	report.Crashes = append([]CrashInfo(nil), s.crashes...)
+	report.RecoveryLog = append([]RecoveryLogEntry(nil), s.recoveryLog...)
+	output := s.output
+	s.mutex.Unlock()
+
+	if output != nil {
+		report.Output = output.snapshot()
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(&report); err != nil {
+		return nil, fmt.Errorf("failed to encode crash report: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress crash report: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func getHostInfo() HostInfo {
+	info := HostInfo{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		CPUs: runtime.NumCPU(),
+	}
+	addPlatformHostInfo(&info)
+	return info
+}
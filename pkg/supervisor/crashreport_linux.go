@@ -0,0 +1,31 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import "golang.org/x/sys/unix"
+
+func addPlatformHostInfo(info *HostInfo) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err == nil {
+		info.KernelVersion = unix.ByteSliceToString(uname.Release[:])
+	}
+
+	var sysinfo unix.Sysinfo_t
+	if err := unix.Sysinfo(&sysinfo); err == nil {
+		info.TotalMemory = uint64(sysinfo.Totalram) * uint64(sysinfo.Unit) // explicit cast to support 32-bit systems
+	}
+}
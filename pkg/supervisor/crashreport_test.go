@@ -0,0 +1,67 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCrashReport(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo hello; echo world >&2; exit 3"}})
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Hour,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	var report CrashReport
+	require.Eventually(t, func() bool {
+		data, err := s.GenerateCrashReport()
+		require.NoError(t, err)
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.NoError(t, json.NewDecoder(gz).Decode(&report))
+		return len(report.Crashes) > 0
+	}, 10*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, t.Name(), report.State.Name)
+	assert.Equal(t, ProcessStateRestarting, report.State.State)
+	assert.Equal(t, 3, report.Crashes[0].ExitCode)
+	if assert.Len(t, report.RecoveryLog, 2) {
+		assert.Equal(t, RecoveryEventStarted, report.RecoveryLog[0].Event)
+		assert.Equal(t, RecoveryEventCrashed, report.RecoveryLog[1].Event)
+		assert.Equal(t, 3, report.RecoveryLog[1].ExitCode)
+	}
+	assert.ElementsMatch(t, []string{"hello", "world"}, report.Output)
+	assert.Equal(t, runtime.NumCPU(), report.Host.CPUs)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dlvStartTimeout  = 30 * time.Second
+	dlvDetachTimeout = 10 * time.Second
+)
+
+var dlvListening = regexp.MustCompile(`^API server listening at: (\S+)`)
+
+// SupervisorDebugger attaches a headless Delve debugger to a supervised
+// process, so that it can be debugged without being restarted. Note that Delve
+// halts the process until a client connects and continues it.
+type SupervisorDebugger struct {
+	// Path to the dlv binary. Looked up in PATH if empty.
+	DlvPath string
+
+	mu         sync.Mutex
+	supervisor *Supervisor
+	cmd        *exec.Cmd
+	exited     <-chan struct{}
+	addr       string
+}
+
+// Attach runs dlv attached to the process supervised by s, listening on
+// listenAddr. The debugger is detached when s gets stopped.
+func (d *SupervisorDebugger) Attach(s *Supervisor, listenAddr string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cmd != nil {
+		return errors.New("debugger already attached")
+	}
+
+	pid := s.Snapshot().PID
+	if pid == 0 {
+		return s.errNotRunning()
+	}
+
+	dlvPath := d.DlvPath
+	if dlvPath == "" {
+		dlvPath = "dlv"
+	}
+
+	var stderr strings.Builder
+	cmd := exec.Command(dlvPath, "attach", strconv.Itoa(pid), "--listen="+listenAddr, "--headless", "--api-version=2")
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start dlv: %w", err)
+	}
+
+	// Watch the output for the address dlv is listening on. The pipe needs to
+	// be read until EOF before waiting for dlv to exit.
+	exited, addrs := make(chan struct{}), make(chan string, 1)
+	go func() {
+		defer close(exited)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if match := dlvListening.FindStringSubmatch(scanner.Text()); match != nil {
+				select {
+				case addrs <- match[1]:
+				default:
+				}
+			}
+		}
+		_ = cmd.Wait()
+	}()
+
+	timer := time.NewTimer(dlvStartTimeout)
+	defer timer.Stop()
+
+	select {
+	case addr := <-addrs:
+		d.supervisor, d.cmd, d.exited, d.addr = s, cmd, exited, addr
+	case <-exited:
+		return fmt.Errorf("dlv exited before listening: %s", strings.TrimSpace(stderr.String()))
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		<-exited
+		return errors.New("timed out while waiting for dlv to listen")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.debugger = d
+	return nil
+}
+
+// DebuggerAddr returns the address dlv is listening on, or an empty string if
+// the debugger isn't attached.
+func (d *SupervisorDebugger) DebuggerAddr() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.addr
+}
+
+// Detach stops dlv, which detaches it from the process, letting the process
+// continue.
+func (d *SupervisorDebugger) Detach() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cmd == nil {
+		return nil
+	}
+
+	s, cmd, exited := d.supervisor, d.cmd, d.exited
+	d.supervisor, d.cmd, d.exited, d.addr = nil, nil, nil, ""
+
+	s.mutex.Lock()
+	if s.debugger == d {
+		s.debugger = nil
+	}
+	s.mutex.Unlock()
+
+	// Delve detaches from attached processes when interrupted.
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		_ = cmd.Process.Kill()
+	}
+
+	timer := time.NewTimer(dlvDetachTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+		return nil
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		<-exited
+		return errors.New("timed out while waiting for dlv to detach")
+	}
+}
+
+// detachDebugger detaches the debugger attached to the supervised process, if
+// any.
+func (s *Supervisor) detachDebugger() {
+	s.mutex.Lock()
+	d := s.debugger
+	s.mutex.Unlock()
+
+	if d != nil {
+		if err := d.Detach(); err != nil {
+			s.log.WithError(err).Warn("Failed to detach debugger")
+		}
+	}
+}
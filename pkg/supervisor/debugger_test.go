@@ -0,0 +1,76 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorDebugger(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake dlv is a shell script")
+	}
+
+	// A fake dlv that records its args and whether it got interrupted.
+	dir := t.TempDir()
+	dlvPath := filepath.Join(dir, "dlv")
+	require.NoError(t, os.WriteFile(dlvPath, []byte(`#!/bin/sh
+echo "$@" >"$0.args"
+trap 'echo detached >"$0.state"; exit 0' INT
+echo 'API server listening at: 127.0.0.1:4711'
+while :; do sleep 0.1; done
+`), 0755))
+
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+	}
+
+	underTest := SupervisorDebugger{DlvPath: dlvPath}
+	assert.ErrorIs(t, underTest.Attach(&s, "127.0.0.1:0"), ErrNotRunning)
+
+	require.NoError(t, s.Supervise())
+	require.NoError(t, pingPong.AwaitPing())
+
+	require.NoError(t, underTest.Attach(&s, "127.0.0.1:0"))
+	assert.Equal(t, "127.0.0.1:4711", underTest.DebuggerAddr())
+	assert.ErrorContains(t, underTest.Attach(&s, "127.0.0.1:0"), "debugger already attached")
+
+	args, err := os.ReadFile(dlvPath + ".args")
+	require.NoError(t, err)
+	assert.Equal(t, "attach "+strconv.Itoa(s.GetProcess().Pid)+" --listen=127.0.0.1:0 --headless --api-version=2\n", string(args))
+
+	// Stopping the supervisor detaches the debugger first.
+	require.NoError(t, s.Stop())
+
+	state, err := os.ReadFile(dlvPath + ".state")
+	require.NoError(t, err)
+	assert.Equal(t, "detached\n", string(state))
+	assert.Empty(t, underTest.DebuggerAddr())
+}
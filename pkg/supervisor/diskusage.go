@@ -0,0 +1,122 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+const defaultDiskCheckInterval = 1 * time.Minute
+
+// diskUsage returns the accumulated size of the regular files below dir. It's
+// a variable, so that tests can replace it.
+var diskUsage = func(dir string) (int64, error) {
+	var usage int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		usage += info.Size()
+		return nil
+	})
+	return usage, err
+}
+
+// monitorDiskUsage periodically checks the disk usage of s.DataDir against
+// s.MaxDiskUsageBytes until ctx is done.
+func (s *Supervisor) monitorDiskUsage(ctx context.Context) {
+	interval := s.DiskCheckInterval
+	if interval <= 0 {
+		interval = defaultDiskCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			usage, err := diskUsage(s.DataDir)
+			if err != nil {
+				s.log.WithError(err).Warnf("Failed to check disk usage of %s", s.DataDir)
+				continue
+			}
+			if usage <= s.MaxDiskUsageBytes {
+				continue
+			}
+
+			s.log.Warnf("Disk usage of %s exceeds the limit: %d > %d bytes", s.DataDir, usage, s.MaxDiskUsageBytes)
+			if s.OnDiskFull != nil {
+				s.OnDiskFull(usage)
+			}
+			if s.RestartOnDiskFull {
+				s.terminateProcess()
+			}
+		}
+	}
+}
+
+// terminateProcess asks the supervised process to terminate, so that it gets
+// respawned.
+func (s *Supervisor) terminateProcess() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.state.hasProcess() || s.cmd == nil || s.cmd.Process == nil {
+		return
+	}
+
+	process := s.cmd.Process
+	s.log.Infof("Terminating pid %d", process.Pid)
+	s.stopReason = CrashReasonUserRequested
+
+	var err error
+	if runtime.GOOS == "windows" {
+		// Graceful shutdown is not implemented on Windows, see processWaitQuit.
+		err = process.Kill()
+	} else {
+		err = process.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		s.log.WithError(err).Warnf("Failed to terminate pid %d", process.Pid)
+		return
+	}
+
+	// Kill the process if it doesn't terminate in time.
+	time.AfterFunc(s.TimeoutStop, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.cmd == nil || s.cmd.Process != process {
+			return // The process has already been respawned.
+		}
+		if err := process.Kill(); err == nil {
+			s.log.Warnf("Killed pid %d, as it didn't terminate within %s", process.Pid, s.TimeoutStop)
+			s.stopReason = CrashReasonTimeoutKill
+		}
+	})
+}
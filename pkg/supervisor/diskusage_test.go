@@ -0,0 +1,82 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), make([]byte, 100), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 23), 0644))
+
+	usage, err := diskUsage(dir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), usage)
+}
+
+func TestMonitorDiskUsage(t *testing.T) {
+	oldDiskUsage := diskUsage
+	t.Cleanup(func() { diskUsage = oldDiskUsage })
+
+	dataDir := t.TempDir()
+	usage := make(chan int64, 1)
+	diskUsage = func(string) (int64, error) {
+		select {
+		case u := <-usage:
+			return u, nil
+		default:
+			return 1024, nil
+		}
+	}
+
+	pingPong := pingpong.New(t)
+	starts, diskFull := make(chan int, 2), make(chan int64, 1)
+	s := Supervisor{
+		Name:              t.Name(),
+		BinPath:           pingPong.BinPath(),
+		RunDir:            t.TempDir(),
+		DataDir:           dataDir,
+		Args:              pingPong.BinArgs(),
+		TimeoutRespawn:    1 * time.Millisecond,
+		MaxDiskUsageBytes: 1024,
+		DiskCheckInterval: 1 * time.Millisecond,
+		OnStart:           func(pid int) { starts <- pid },
+		OnDiskFull:        func(usage int64) { diskFull <- usage },
+		RestartOnDiskFull: true,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	pid := <-starts
+	usage <- 2048
+	assert.Equal(t, int64(2048), <-diskFull)
+
+	// The process gets restarted.
+	assert.NotEqual(t, pid, <-starts, "Respawn failed")
+	assert.Empty(t, diskFull, "Usage at the limit shouldn't be reported")
+}
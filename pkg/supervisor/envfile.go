@@ -0,0 +1,154 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// parseEnvFile reads environment variables from a file in dotenv format.
+func parseEnvFile(path string) (_ []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open environment file: %w", err)
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	env, err := parseEnv(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse environment file %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// parseEnv parses environment variables in dotenv format, i.e. KEY=value
+// lines, optionally prefixed with "export". Empty lines and lines starting
+// with # are ignored. Values may be single quoted, which is taken literally,
+// or double quoted, which supports backslash escapes. Unquoted values end at
+// the start of a comment.
+func parseEnv(r io.Reader) ([]string, error) {
+	var env []string
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing =", lineNo)
+		}
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		if !envKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name: %q", lineNo, key)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		env = append(env, key+"="+value)
+	}
+
+	return env, scanner.Err()
+}
+
+func parseEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	var value strings.Builder
+	var rest string
+	switch quote := raw[0]; quote {
+	case '\'':
+		end := strings.IndexByte(raw[1:], quote)
+		if end < 0 {
+			return "", errors.New("unterminated single quoted value")
+		}
+		value.WriteString(raw[1 : end+1])
+		rest = raw[end+2:]
+
+	case '"':
+		end := -1
+		for i := 1; i < len(raw) && end < 0; i++ {
+			switch raw[i] {
+			case '"':
+				end = i
+			case '\\':
+				if i++; i == len(raw) {
+					break
+				}
+				switch raw[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				default:
+					value.WriteByte(raw[i])
+				}
+			default:
+				value.WriteByte(raw[i])
+			}
+		}
+		if end < 0 {
+			return "", errors.New("unterminated double quoted value")
+		}
+		rest = raw[end+1:]
+
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected characters after quoted value: %q", rest)
+	}
+	return value.String(), nil
+}
+
+// mergeEnv returns env with the variables from overrides added to it,
+// replacing any variables of the same name.
+func mergeEnv(env, overrides []string) []string {
+	if len(overrides) == 0 {
+		return env
+	}
+
+	indices := make(map[string]int, len(env))
+	merged := make([]string, 0, len(env)+len(overrides))
+	for _, kv := range append(env, overrides...) {
+		k, _, _ := strings.Cut(kv, "=")
+		if i, ok := indices[k]; ok {
+			merged[i] = kv
+			continue
+		}
+		indices[k] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnv(t *testing.T) {
+	env, err := parseEnv(strings.NewReader(`
+# A comment
+FOO=bar
+export EXPORTED=yes
+  SPACES = around  # trailing comment
+EMPTY=
+HASH=a#b
+SINGLE='single $quoted # value'
+DOUBLE="double \"quoted\"\tvalue\n" # comment
+URL=https://example.com/?a=b
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"FOO=bar",
+		"EXPORTED=yes",
+		"SPACES=around",
+		"EMPTY=",
+		"HASH=a#b",
+		"SINGLE=single $quoted # value",
+		"DOUBLE=double \"quoted\"\tvalue\n",
+		"URL=https://example.com/?a=b",
+	}, env)
+
+	for _, test := range []struct{ name, input, err string }{
+		{"missing_equals", "FOO", "line 1: missing ="},
+		{"invalid_key", "\nFOO BAR=baz", `line 2: invalid variable name: "FOO BAR"`},
+		{"unterminated_single", "FOO='bar", "line 1: unterminated single quoted value"},
+		{"unterminated_double", `FOO="bar\"`, "line 1: unterminated double quoted value"},
+		{"trailing_garbage", `FOO="bar" baz`, `line 1: unexpected characters after quoted value: "baz"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseEnv(strings.NewReader(test.input))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestEnvironmentFile(t *testing.T) {
+	t.Setenv("k1", "host_v1")
+	t.Setenv("k2", "host_v2")
+	t.Setenv("FOO_k3", "foo_v3")
+
+	envFile := filepath.Join(t.TempDir(), "foo.env")
+	require.NoError(t, os.WriteFile(envFile, []byte("k2=file_v2\nk3=file_v3\nk4=file_v4\n"), 0644))
+
+	fileEnv, err := parseEnvFile(envFile)
+	require.NoError(t, err)
+	env := getEnv("/var/lib/k0s", "foo", false, fileEnv)
+
+	// The environment file takes precedence over the host environment, but
+	// not over component specific variables.
+	assert.Contains(t, env, "k1=host_v1")
+	assert.Contains(t, env, "k2=file_v2")
+	assert.Contains(t, env, "k3=foo_v3")
+	assert.NotContains(t, env, "k3=file_v3")
+	assert.Contains(t, env, "k4=file_v4")
+	assert.NotContains(t, env, "k2=host_v2")
+
+	_, err = parseEnvFile(filepath.Join(t.TempDir(), "missing.env"))
+	assert.ErrorContains(t, err, "failed to open environment file")
+}
+
+func TestIncludeParentEnv(t *testing.T) {
+	t.Setenv("K0S_TEST_HOST_VAR", "leaked")
+
+	envFile := filepath.Join(t.TempDir(), "foo.env")
+	require.NoError(t, os.WriteFile(envFile, []byte("k1=file_v1\n"), 0644))
+
+	includeParentEnv := false
+	s := Supervisor{
+		Name:             "foo",
+		BinPath:          "foo",
+		DataDir:          "/var/lib/k0s",
+		EnvironmentFile:  envFile,
+		IncludeParentEnv: &includeParentEnv,
+	}
+	cmd, err := s.newCmd(context.TODO(), nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"_K0S_MANAGED=yes", "k1=file_v1", "PATH=/var/lib/k0s/bin"}, cmd.Env)
+
+	includeParentEnv = true
+	cmd, err = s.newCmd(context.TODO(), nil)
+	require.NoError(t, err)
+	assert.Contains(t, cmd.Env, "K0S_TEST_HOST_VAR=leaked")
+	assert.Contains(t, cmd.Env, "k1=file_v1")
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EventBus receives the lifecycle events of supervisors. Implementations need
+// to be safe for concurrent use and shouldn't block, as events are published
+// synchronously from within the supervision loop.
+type EventBus interface {
+	Publish(event any)
+}
+
+// SupervisorStartedEvent is published whenever the supervised process has
+// been started.
+type SupervisorStartedEvent struct {
+	Name string
+	PID  int
+}
+
+// SupervisorCrashedEvent is published whenever the supervised process exited
+// unexpectedly.
+type SupervisorCrashedEvent struct {
+	Name     string
+	PID      int
+	ExitCode int
+}
+
+// SupervisorStoppedEvent is published when the supervisor has been stopped.
+type SupervisorStoppedEvent struct {
+	Name string
+}
+
+func (s *Supervisor) publishEvent(event any) {
+	if s.EventBus != nil {
+		s.EventBus.Publish(event)
+	}
+}
+
+func (s *Supervisor) recordStartedEvent(pid int) {
+	s.publishEvent(SupervisorStartedEvent{Name: s.Name, PID: pid})
+	if s.EventRecorder != nil {
+		s.EventRecorder.Eventf(s.NodeRef, corev1.EventTypeNormal, "ComponentStarted", "Started %s (pid %d)", s.Name, pid)
+	}
+}
+
+func (s *Supervisor) recordCrashedEvent(info CrashInfo) {
+	s.publishEvent(SupervisorCrashedEvent{Name: s.Name, PID: info.PID, ExitCode: info.ExitCode})
+	if s.EventRecorder == nil {
+		return
+	}
+
+	reason := fmt.Sprintf("exit code %d", info.ExitCode)
+	if info.Signal != "" {
+		reason = "signal " + info.Signal
+	}
+	s.EventRecorder.Eventf(s.NodeRef, corev1.EventTypeWarning, "ComponentCrashed", "%s (pid %d) exited unexpectedly with %s", s.Name, info.PID, reason)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEventRecorder(t *testing.T) {
+	pingPong := pingpong.New(t)
+	recorder := record.NewFakeRecorder(10)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        pingPong.BinPath(),
+		RunDir:         t.TempDir(),
+		Args:           pingPong.BinArgs(),
+		TimeoutRespawn: 1 * time.Millisecond,
+		EventRecorder:  recorder,
+		NodeRef:        &corev1.ObjectReference{Kind: "Node", Name: "worker"},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	require.NoError(t, pingPong.AwaitPing())
+	pid := s.GetProcess().Pid
+	assert.Equal(t, fmt.Sprintf("Normal ComponentStarted Started %s (pid %d)", t.Name(), pid), <-recorder.Events)
+
+	require.NoError(t, pingPong.SendPong())
+	assert.Equal(t, fmt.Sprintf("Warning ComponentCrashed %s (pid %d) exited unexpectedly with exit code 0", t.Name(), pid), <-recorder.Events)
+
+	require.NoError(t, pingPong.AwaitPing())
+	assert.Equal(t, fmt.Sprintf("Normal ComponentStarted Started %s (pid %d)", t.Name(), s.GetProcess().Pid), <-recorder.Events)
+}
+
+func TestEventRecorder_NodeRefRequired(t *testing.T) {
+	s := Supervisor{
+		Name:          t.Name(),
+		BinPath:       filepath.Join(t.TempDir(), "foo"),
+		RunDir:        t.TempDir(),
+		EventRecorder: record.NewFakeRecorder(1),
+	}
+	assert.ErrorContains(t, s.Supervise(), "a node reference is required to record events")
+}
+
+type eventBus chan any
+
+func (b eventBus) Publish(event any) { b <- event }
+
+func TestEventBus(t *testing.T) {
+	pingPong := pingpong.New(t)
+	events := make(eventBus, 10)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        pingPong.BinPath(),
+		RunDir:         t.TempDir(),
+		Args:           pingPong.BinArgs(),
+		TimeoutRespawn: 1 * time.Millisecond,
+		EventBus:       events,
+	}
+	require.NoError(t, s.Supervise())
+
+	require.NoError(t, pingPong.AwaitPing())
+	pid := s.GetProcess().Pid
+	assert.Equal(t, SupervisorStartedEvent{Name: t.Name(), PID: pid}, <-events)
+
+	require.NoError(t, pingPong.SendPong())
+	assert.Equal(t, SupervisorCrashedEvent{Name: t.Name(), PID: pid, ExitCode: 0}, <-events)
+
+	require.NoError(t, pingPong.AwaitPing())
+	assert.Equal(t, SupervisorStartedEvent{Name: t.Name(), PID: s.GetProcess().Pid}, <-events)
+
+	require.NoError(t, s.Stop())
+	assert.Equal(t, SupervisorStoppedEvent{Name: t.Name()}, <-events)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/pkg/debounce"
+)
+
+// fileWatchRetryInterval is the interval in which failed file watches are
+// retried. It's a variable, so that tests can replace it.
+var fileWatchRetryInterval = 30 * time.Second
+
+// fileWatch tracks changes of a set of files. Files are watched via their
+// parent directories, so that atomic replacements and files that don't exist
+// yet are covered. For symlinks, both the link and its target are watched.
+type fileWatch struct {
+	log     logrus.FieldLogger
+	paths   []string
+	watcher *fsnotify.Watcher
+
+	mu      sync.Mutex
+	targets map[string]struct{} // the paths and their resolved symlink targets
+}
+
+// refresh resolves the watched paths and watches their directories. Returns
+// whether the resolved paths changed, and whether all directories could be
+// watched.
+func (w *fileWatch) refresh() (changed bool, complete bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	targets := make(map[string]struct{}, len(w.paths))
+	for _, path := range w.paths {
+		targets[path] = struct{}{}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			targets[resolved] = struct{}{}
+		}
+	}
+
+	complete = true
+	for target := range targets {
+		dir := filepath.Dir(target)
+		if err := w.watcher.Add(dir); err != nil {
+			w.log.WithError(err).Debugf("Failed to watch %s", dir)
+			complete = false
+		}
+	}
+
+	changed = w.targets != nil && !maps.Equal(w.targets, targets)
+	w.targets = targets
+	return changed, complete
+}
+
+// affects returns whether the given event changed any of the watched files.
+func (w *fileWatch) affects(event fsnotify.Event) bool {
+	// Any event may change the symlinks, e.g. when a directory of a
+	// Kubernetes volume gets swapped.
+	if changed, _ := w.refresh(); changed {
+		return true
+	}
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.targets[event.Name]
+	return ok
+}
+
+// watchFiles restarts the supervised process whenever any of the files in
+// s.AutoRestartOnFileChange change, until ctx is done. Changes are debounced
+// for s.TimeoutRespawn.
+func (s *Supervisor) watchFiles(ctx context.Context) {
+	w, err := newFileWatch(s.log, s.AutoRestartOnFileChange)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to watch files")
+		return
+	}
+	defer func() {
+		if err := w.watcher.Close(); err != nil {
+			s.log.WithError(err).Warn("Failed to close file watcher")
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return
+				}
+				s.log.WithError(err).Warn("Error while watching files")
+			}
+		}
+	}()
+
+	if _, complete := w.refresh(); !complete {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(fileWatchRetryInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if _, complete := w.refresh(); complete {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	debouncer := debounce.Debouncer[fsnotify.Event]{
+		Input:   w.watcher.Events,
+		Timeout: s.TimeoutRespawn,
+		Filter:  w.affects,
+		Callback: func(event fsnotify.Event) {
+			s.log.Infof("Restarting, as %s changed", event.Name)
+			s.terminateProcess()
+		},
+	}
+	_ = debouncer.Run(ctx)
+}
+
+func newFileWatch(log logrus.FieldLogger, paths []string) (*fileWatch, error) {
+	w := fileWatch{log: log}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		w.paths = append(w.paths, path)
+	}
+
+	var err error
+	if w.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	return &w, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoRestartOnFileChange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell and symlinks")
+	}
+
+	oldInterval := fileWatchRetryInterval
+	fileWatchRetryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { fileWatchRetryInterval = oldInterval })
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(config, []byte("v1"), 0600))
+	target := filepath.Join(dir, "target")
+	require.NoError(t, os.WriteFile(target, []byte("v1"), 0600))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(target, link))
+	// A file in a directory that doesn't exist yet.
+	missing := filepath.Join(dir, "missing", "config")
+
+	starts := make(chan int, 10)
+	s := Supervisor{
+		Name:                    t.Name(),
+		BinPath:                 selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:                  t.TempDir(),
+		Args:                    []string{"-c", "exec sleep 10"},
+		TimeoutRespawn:          10 * time.Millisecond,
+		AutoRestartOnFileChange: []string{config, link, missing},
+		OnStart:                 func(pid int) { starts <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-starts
+
+	// Waits until the process got restarted, retrying the change, since the
+	// watch may not have been established yet.
+	awaitRestart := func(t *testing.T, change func()) {
+		change()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case newPID := <-starts:
+				assert.NotEqual(t, pid, newPID)
+				pid = newPID
+				// Drain the restarts caused by retried changes.
+				for {
+					select {
+					case pid = <-starts:
+					case <-time.After(200 * time.Millisecond):
+						return
+					}
+				}
+			case <-ticker.C:
+				change()
+			case <-timeout:
+				require.Fail(t, "Process didn't restart")
+			}
+		}
+	}
+
+	t.Run("write", func(t *testing.T) {
+		awaitRestart(t, func() { require.NoError(t, os.WriteFile(config, []byte("v2"), 0600)) })
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		tmp := filepath.Join(dir, "config.tmp")
+		awaitRestart(t, func() {
+			require.NoError(t, os.WriteFile(tmp, []byte("v3"), 0600))
+			require.NoError(t, os.Rename(tmp, config))
+		})
+	})
+
+	t.Run("symlink_target", func(t *testing.T) {
+		awaitRestart(t, func() { require.NoError(t, os.WriteFile(target, []byte("v2"), 0600)) })
+	})
+
+	t.Run("symlink_swap", func(t *testing.T) {
+		other := filepath.Join(dir, "other")
+		require.NoError(t, os.WriteFile(other, []byte("v1"), 0600))
+		tmp := filepath.Join(dir, "link.tmp")
+		current := target
+		awaitRestart(t, func() {
+			current = map[string]string{target: other, other: target}[current]
+			require.NoError(t, os.Symlink(current, tmp))
+			require.NoError(t, os.Rename(tmp, link))
+		})
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		require.NoError(t, os.Mkdir(filepath.Dir(missing), 0700))
+		awaitRestart(t, func() { require.NoError(t, os.WriteFile(missing, []byte("v1"), 0600)) })
+	})
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrNotRunning is returned when an operation requires the supervised
+	// process to be running, but it isn't.
+	ErrNotRunning = errors.New("process is not running")
+	// ErrNotStarted is returned when an operation requires the supervisor to
+	// be started, but [Supervisor.Supervise] hasn't been called yet. It's
+	// also an [ErrNotRunning].
+	ErrNotStarted = fmt.Errorf("supervisor has not been started: %w", ErrNotRunning)
+	// ErrAlreadyFrozen is returned by [Supervisor.Freeze] if the supervised
+	// process is already frozen.
+	ErrAlreadyFrozen = errors.New("process is already frozen")
+	// ErrNotFrozen is returned by [Supervisor.Thaw] if the supervised process
+	// isn't frozen.
+	ErrNotFrozen = errors.New("process is not frozen")
+)
+
+// Freeze suspends the supervised process. If the supervisor has a cgroup, the
+// cgroup freezer is used, which is atomic with respect to the processes in
+// it. This fails if the process isn't a member of the cgroup, e.g. because it
+// couldn't be moved into it. Otherwise, the process is sent SIGSTOP.
+func (s *Supervisor) Freeze() (err error) {
+	defer func() { s.audit("Freeze", err) }()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.state.hasProcess() || s.cmd == nil || s.cmd.Process == nil {
+		return s.errNotRunning()
+	}
+	if s.frozen {
+		return ErrAlreadyFrozen
+	}
+
+	if err := s.setFrozenLocked(true); err != nil {
+		return err
+	}
+
+	s.log.Infof("Froze pid %d", s.cmd.Process.Pid)
+	return nil
+}
+
+// Thaw resumes a supervised process that has been suspended by
+// [Supervisor.Freeze].
+func (s *Supervisor) Thaw() (err error) {
+	defer func() { s.audit("Thaw", err) }()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.frozen {
+		return ErrNotFrozen
+	}
+
+	if err := s.setFrozenLocked(false); err != nil {
+		return err
+	}
+
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.log.Infof("Thawed pid %d", s.cmd.Process.Pid)
+	}
+	return nil
+}
+
+// ensureThawed resumes the supervised process if it's frozen, so that it is
+// able to react to signals.
+func (s *Supervisor) ensureThawed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.frozen {
+		if err := s.setFrozenLocked(false); err != nil {
+			s.log.WithError(err).Warn("Failed to thaw process")
+		}
+	}
+}
+
+// setFrozenLocked freezes or thaws the supervised process. The caller needs
+// to hold s.mutex.
+func (s *Supervisor) setFrozenLocked(frozen bool) error {
+	if s.CgroupPath != "" {
+		value := []byte("0")
+		if frozen {
+			// Freezing a cgroup that the process failed to join would be a
+			// no-op.
+			pid := s.cmd.Process.Pid
+			if contained, err := s.cgroupContains(pid); err != nil {
+				return err
+			} else if !contained {
+				return fmt.Errorf("pid %d is not in cgroup %s", pid, s.CgroupPath)
+			}
+			value = []byte("1")
+		}
+		freeze := filepath.Join(s.CgroupPath, "cgroup.freeze")
+		if err := os.WriteFile(freeze, value, 0); err != nil {
+			return fmt.Errorf("failed to write %s: %w", freeze, err)
+		}
+	} else if s.cmd != nil && s.cmd.Process != nil {
+		var err error
+		if frozen {
+			err = stopProcess(s.cmd.Process)
+		} else {
+			err = continueProcess(s.cmd.Process)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.frozen = frozen
+	return nil
+}
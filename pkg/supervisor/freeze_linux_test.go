@@ -0,0 +1,88 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezeThaw_ProcessState(t *testing.T) {
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: selectCmd(t, cmd{binPath: "sleep"}).binPath,
+		Args:    []string{"60"},
+		RunDir:  t.TempDir(),
+		OnStart: func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	require.NoError(t, s.Freeze())
+	assert.Eventually(t, func() bool { return processState(pid) == "T" }, 10*time.Second, 10*time.Millisecond,
+		"Process hasn't been stopped")
+
+	require.NoError(t, s.Thaw())
+	assert.Eventually(t, func() bool { return processState(pid) == "S" }, 10*time.Second, 10*time.Millisecond,
+		"Process hasn't been continued")
+}
+
+func TestFreeze_NotInCgroup(t *testing.T) {
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: selectCmd(t, cmd{binPath: "sleep"}).binPath,
+		Args:    []string{"60"},
+		RunDir:  t.TempDir(),
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	// Pretend the process failed to join its cgroup.
+	cgroup := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), nil, 0644))
+	s.mutex.Lock()
+	s.CgroupPath = cgroup
+	s.mutex.Unlock()
+	t.Cleanup(func() { s.mutex.Lock(); s.CgroupPath = ""; s.mutex.Unlock() })
+
+	assert.ErrorContains(t, s.Freeze(), "is not in cgroup "+cgroup)
+	assert.NoFileExists(t, filepath.Join(cgroup, "cgroup.freeze"))
+	assert.ErrorIs(t, s.Thaw(), ErrNotFrozen)
+}
+
+// processState returns the state of the given PID, as found in its stat file,
+// or an empty string if it can't be determined.
+func processState(pid int) string {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ""
+	}
+	_, fields, _ := strings.Cut(string(stat), ") ")
+	if fields := strings.Fields(fields); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
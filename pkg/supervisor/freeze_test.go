@@ -0,0 +1,54 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezeThaw(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Freezing processes not yet implemented on Windows")
+	}
+
+	sleep := selectCmd(t, cmd{"sleep", []string{"60"}})
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}
+
+	assert.ErrorIs(t, s.Freeze(), ErrNotRunning)
+	assert.ErrorIs(t, s.Thaw(), ErrNotFrozen)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	require.NoError(t, s.Freeze())
+	assert.ErrorIs(t, s.Freeze(), ErrAlreadyFrozen)
+	require.NoError(t, s.Thaw())
+	assert.ErrorIs(t, s.Thaw(), ErrNotFrozen)
+
+	// Stopping a frozen process must not block.
+	require.NoError(t, s.Freeze())
+	assert.NoError(t, s.Stop())
+}
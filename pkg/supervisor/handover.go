@@ -0,0 +1,147 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// handoverState is the serialized form of a running supervisor that's handed
+// over to a replacement k0s process.
+type handoverState struct {
+	Config          json.RawMessage `json:"config"`
+	ResolvedBinPath string          `json:"resolvedBinPath"`
+	PID             int             `json:"pid"`
+	Restarts        int             `json:"restarts"`
+	StartedAt       time.Time       `json:"startedAt"`
+}
+
+// SerializeToFd writes the state of all running supervisors to fd as JSON, so
+// that a replacement k0s process is able to adopt their processes using
+// [DeserializeFromFd], instead of restarting them. The supervisors must not be
+// stopped afterwards, as this would stop their processes as well.
+//
+// Adopted processes outlive the k0s process that started them, so they
+// shouldn't write their output to the supervisor, but into files, e.g. via
+// StdoutFile and StderrFile.
+func (m *SupervisorManager) SerializeToFd(fd *os.File) error {
+	states := []*handoverState{}
+	for _, s := range m.find(func(*Supervisor) bool { return true }) {
+		state, err := s.handoverState()
+		if err != nil {
+			return fmt.Errorf("failed to serialize %s: %w", s.Name, err)
+		}
+		if state != nil {
+			states = append(states, state)
+		}
+	}
+
+	if err := json.NewEncoder(fd).Encode(states); err != nil {
+		return fmt.Errorf("failed to serialize supervisors: %w", err)
+	}
+	return nil
+}
+
+// DeserializeFromFd reads the supervisors that have been written to fd by
+// [SupervisorManager.SerializeToFd]. The returned supervisors adopt the
+// processes of the previous k0s process when they're started via Supervise,
+// instead of starting new ones. Processes are started as usual once the
+// adopted ones exited, or if they already exited in the meantime.
+//
+// The supervisors are configured with the same fields that
+// [SupervisorManager.Export] includes. Fields that can't be serialized, e.g.
+// OnStart, OnCrash, OnStop, PostStart, StartupProbe, CleanBeforeFn and the
+// metrics registerers, need to be set again before calling Supervise.
+func DeserializeFromFd(fd *os.File) ([]*Supervisor, error) {
+	var states []*handoverState
+	if err := json.NewDecoder(fd).Decode(&states); err != nil {
+		return nil, fmt.Errorf("failed to deserialize supervisors: %w", err)
+	}
+
+	supervisors := make([]*Supervisor, 0, len(states))
+	for i, state := range states {
+		s := &Supervisor{adoptee: state}
+		if err := json.Unmarshal(state.Config, s); err != nil {
+			return nil, fmt.Errorf("failed to deserialize supervisor #%d: %w", i+1, err)
+		}
+		supervisors = append(supervisors, s)
+	}
+	return supervisors, nil
+}
+
+// handoverState returns the serialized form of s, or nil if its process isn't
+// running.
+func (s *Supervisor) handoverState() (*handoverState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.state.hasProcess() || s.cmd == nil || s.cmd.Process == nil {
+		return nil, nil
+	}
+
+	config, err := json.Marshal(s.configLocked())
+	if err != nil {
+		return nil, err
+	}
+
+	return &handoverState{
+		Config:          config,
+		ResolvedBinPath: s.binaryPath,
+		PID:             s.cmd.Process.Pid,
+		Restarts:        s.restarts,
+		StartedAt:       s.startedAt,
+	}, nil
+}
+
+// adoptProcess takes over the process that has been handed over to s. Returns
+// false if the process already exited.
+func (s *Supervisor) adoptProcess() bool {
+	state := s.adoptee
+	s.adoptee = nil
+
+	process, err := findAdoptableProcess(state.PID)
+	if err != nil {
+		s.log.WithError(err).Warnf("Failed to adopt pid %d", state.PID)
+		return false
+	}
+
+	waitResult := make(chan error, 1)
+	go func() { waitResult <- waitForAdoptedProcess(process) }()
+
+	s.mutex.Lock()
+	s.cmd = &exec.Cmd{
+		Path:    state.ResolvedBinPath,
+		Args:    append([]string{s.BinPath}, s.Args...),
+		Process: process,
+	}
+	s.binaryPath, s.binaryInode = state.ResolvedBinPath, 0
+	s.waitResult = waitResult
+	s.restarts = state.Restarts
+	s.mutex.Unlock()
+
+	s.setState(ProcessStateRunning)
+	s.mutex.Lock()
+	s.startedAt = state.StartedAt
+	s.mutex.Unlock()
+
+	s.markReady()
+	s.log.Infof("Adopted pid %d", process.Pid)
+	return true
+}
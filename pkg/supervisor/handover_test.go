@@ -0,0 +1,118 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializeToFd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "exec sleep 60"}})
+	pids := make(chan int, 1)
+	previous := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: time.Hour,
+		Annotations:    map[string]string{"role": "test"},
+		UptimeWindow:   time.Minute,
+		OnStart:        func(pid int) { pids <- pid },
+	}
+	require.NoError(t, previous.Supervise())
+	t.Cleanup(func() { assert.NoError(t, previous.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	stopped := Supervisor{Name: "stopped"}
+	manager := NewSupervisorManager()
+	require.NoError(t, manager.Register(&previous))
+	require.NoError(t, manager.Register(&stopped))
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	require.NoError(t, manager.SerializeToFd(w))
+	require.NoError(t, w.Close())
+
+	supervisors, err := DeserializeFromFd(r)
+	require.NoError(t, err)
+	require.Len(t, supervisors, 1, "Expected only running supervisors to be serialized")
+	s := supervisors[0]
+	assert.Equal(t, previous.Name, s.Name)
+	assert.Equal(t, previous.Args, s.Args)
+	assert.Equal(t, previous.TimeoutRespawn, s.TimeoutRespawn)
+	assert.Equal(t, previous.Annotations, s.Annotations)
+	assert.Equal(t, previous.UptimeWindow, s.UptimeWindow)
+	assert.Empty(t, s.PidFile, "Derived PID file deserialized")
+
+	s.OnStart = func(pid int) { assert.Fail(t, "Unexpected start", "pid %d", pid) }
+	require.NoError(t, s.Supervise())
+	state := s.Snapshot()
+	assert.Equal(t, ProcessStateRunning, state.State)
+	assert.Equal(t, pid, state.PID, "Expected the process to be adopted")
+	assert.True(t, previous.Snapshot().StartedAt.Equal(state.StartedAt), "Expected the start time to be retained")
+
+	// Stopping the adoptive supervisor stops the adopted process.
+	require.NoError(t, s.Stop())
+	assert.Equal(t, ProcessStateStopped, s.Snapshot().State)
+	assert.Eventually(t, func() bool {
+		return previous.Snapshot().State == ProcessStateRestarting
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestDeserializeFromFd_ExitedProcess(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = w.WriteString(`[{"config": {"Name": "exited", "BinPath": "` + sleep.binPath + `"}, "pid": 999999999}]`)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	supervisors, err := DeserializeFromFd(r)
+	require.NoError(t, err)
+	require.Len(t, supervisors, 1)
+	s := supervisors[0]
+	s.RunDir = t.TempDir()
+	s.Args = sleep.binArgs
+
+	pids := make(chan int, 1)
+	s.OnStart = func(pid int) { pids <- pid }
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	select {
+	case pid := <-pids:
+		assert.NotEqual(t, 999999999, pid)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "Expected a new process to be started")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// startHeartbeat updates HeartbeatFile every HeartbeatInterval in the
+// background. The returned function stops the updates.
+func (s *Supervisor) startHeartbeat(ctx context.Context) (stop func()) {
+	if s.HeartbeatFile == "" {
+		return func() {}
+	}
+	return runInBackground(ctx, s.beat)
+}
+
+func (s *Supervisor) beat(ctx context.Context) {
+	ticker := time.NewTicker(s.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := touchFile(s.HeartbeatFile, time.Now()); err != nil {
+			s.log.WithError(err).Warnf("Failed to update heartbeat file %s", s.HeartbeatFile)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// touchFile sets the access and modification times of the file at path to t,
+// creating it if it doesn't exist.
+func touchFile(path string, t time.Time) error {
+	err := os.Chtimes(path, t, t)
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, t, t)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeatFile(t *testing.T) {
+	pingPong := pingpong.New(t)
+	crashed := make(chan struct{})
+	s := Supervisor{
+		Name:              t.Name(),
+		BinPath:           pingPong.BinPath(),
+		RunDir:            t.TempDir(),
+		Args:              pingPong.BinArgs(),
+		HeartbeatFile:     filepath.Join(t.TempDir(), "heartbeat"),
+		HeartbeatInterval: 10 * time.Millisecond,
+		TimeoutRespawn:    time.Hour,
+		OnCrash:           func(CrashInfo) { close(crashed) },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	modTime := func() time.Time {
+		stat, err := os.Stat(s.HeartbeatFile)
+		if err != nil {
+			return time.Time{}
+		}
+		return stat.ModTime()
+	}
+
+	var first time.Time
+	require.Eventually(t, func() bool {
+		first = modTime()
+		return !first.IsZero()
+	}, 10*time.Second, time.Millisecond, "Heartbeat file hasn't been created")
+	assert.Eventually(t, func() bool {
+		return modTime().After(first)
+	}, 10*time.Second, time.Millisecond, "Heartbeat file hasn't been updated")
+
+	require.NoError(t, pingPong.AwaitPing())
+	require.NoError(t, pingPong.SendPong())
+	<-crashed
+
+	// Allow for a last beat that raced with the crash.
+	time.Sleep(20 * time.Millisecond)
+	last := modTime()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, last, modTime(), "Heartbeat file has been updated after the crash")
+}
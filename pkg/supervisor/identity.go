@@ -0,0 +1,67 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetUID changes the user as which the supervised process runs. The change
+// takes effect when the process is restarted the next time. The currently
+// running process is unaffected.
+func (s *Supervisor) SetUID(uid int) (err error) {
+	defer func() { s.audit("SetUID", err) }()
+	if !s.IsRunning() {
+		return s.errNotRunning()
+	}
+	if _, err := user.LookupId(strconv.Itoa(uid)); err != nil {
+		return fmt.Errorf("invalid UID %d: %w", uid, err)
+	}
+
+	s.mutex.Lock()
+	old := s.UID
+	s.UID = uid
+	s.mutex.Unlock()
+
+	s.log.WithFields(logrus.Fields{"oldUID": old, "newUID": uid}).Info("Changed UID, effective after the next restart")
+	return nil
+}
+
+// SetGID changes the group as which the supervised process runs. The change
+// takes effect when the process is restarted the next time. The currently
+// running process is unaffected.
+func (s *Supervisor) SetGID(gid int) (err error) {
+	defer func() { s.audit("SetGID", err) }()
+	if !s.IsRunning() {
+		return s.errNotRunning()
+	}
+	if _, err := user.LookupGroupId(strconv.Itoa(gid)); err != nil {
+		return fmt.Errorf("invalid GID %d: %w", gid, err)
+	}
+
+	s.mutex.Lock()
+	old := s.GID
+	s.GID = gid
+	s.mutex.Unlock()
+
+	s.log.WithFields(logrus.Fields{"oldGID": old, "newGID": gid}).Info("Changed GID, effective after the next restart")
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetUIDAndGID(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Numeric user and group IDs are not supported on Windows")
+	}
+
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+		UID:     4242,
+		GID:     4242,
+	}
+	assert.ErrorIs(t, s.SetUID(0), ErrNotRunning)
+	assert.ErrorIs(t, s.SetGID(0), ErrNotRunning)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	// Both root user and group exist on any Unix system.
+	assert.NoError(t, s.SetUID(0))
+	assert.NoError(t, s.SetGID(0))
+	assert.Zero(t, s.UID)
+	assert.Zero(t, s.GID)
+
+	assert.ErrorContains(t, s.SetUID(2147483646), "invalid UID 2147483646")
+	assert.ErrorContains(t, s.SetGID(2147483646), "invalid GID 2147483646")
+	assert.Zero(t, s.UID)
+	assert.Zero(t, s.GID)
+}
@@ -0,0 +1,30 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package integration contains integration tests that verify the lifecycle of
+// real processes run by the supervisor. They're excluded from regular builds
+// by the integration build tag:
+//
+//	go test -tags integration ./pkg/supervisor/integration
+//
+// If SUPERVISOR_INTEGRATION_IMAGE is set, the tests are run isolated inside a
+// Docker container based on that image. As the test binary is mounted into
+// the container, it needs to be statically linked for images that don't
+// provide a compatible libc:
+//
+//	SUPERVISOR_INTEGRATION_IMAGE=debian:bookworm-slim CGO_ENABLED=0 \
+//	  go test -tags integration ./pkg/supervisor/integration
+package integration
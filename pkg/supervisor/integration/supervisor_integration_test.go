@@ -0,0 +1,214 @@
+//go:build integration
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/supervisor"
+)
+
+const (
+	// The Docker image in which to run the tests, if any.
+	imageEnv = "SUPERVISOR_INTEGRATION_IMAGE"
+	// Set when the tests are running inside the Docker container.
+	inDockerEnv = "_SUPERVISOR_INTEGRATION_IN_DOCKER"
+	// The path to the testprocess binary, if it has already been built.
+	testProcessEnv = "_SUPERVISOR_INTEGRATION_TESTPROCESS"
+)
+
+// The path to the testprocess binary built from testdata.
+var testProcess string
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	if testProcess = os.Getenv(testProcessEnv); testProcess == "" {
+		dir, err := os.MkdirTemp("", "supervisor-integration-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		testProcess = filepath.Join(dir, "testprocess")
+		build := exec.Command("go", "build", "-o", testProcess, "./testdata/testprocess")
+		build.Env = append(os.Environ(), "CGO_ENABLED=0")
+		build.Stdout, build.Stderr = os.Stdout, os.Stderr
+		if err := build.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to build testprocess:", err)
+			return 1
+		}
+	}
+
+	if image := os.Getenv(imageEnv); image != "" && os.Getenv(inDockerEnv) == "" {
+		return runInDocker(image)
+	}
+
+	return m.Run()
+}
+
+// runInDocker runs the test binary with the same arguments inside a Docker
+// container based on image, and returns its exit code.
+func runInDocker(image string) int {
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	docker := exec.Command("docker", append([]string{
+		"run", "--rm", "--init",
+		"-e", inDockerEnv + "=1",
+		"-e", testProcessEnv + "=/testdata/testprocess",
+		"-v", self + ":/integration.test:ro",
+		"-v", filepath.Dir(testProcess) + ":/testdata:ro",
+		image, "/integration.test",
+	}, os.Args[1:]...)...)
+	docker.Stdout, docker.Stderr = os.Stdout, os.Stderr
+	if err := docker.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, "Failed to run tests in Docker:", err)
+		return 1
+	}
+	return 0
+}
+
+func TestStartAndStop(t *testing.T) {
+	s := supervisor.Supervisor{
+		Name:    "sleep",
+		BinPath: "/bin/sleep",
+		Args:    []string{"60"},
+		RunDir:  t.TempDir(),
+	}
+	require.NoError(t, s.Supervise())
+	pidFile := filepath.Join(s.RunDir, "sleep.pid")
+
+	process := s.GetProcess()
+	require.NotNil(t, process)
+	assert.Equal(t, supervisor.ProcessStateRunning, s.Snapshot().State)
+	pid, err := os.ReadFile(pidFile)
+	if assert.NoError(t, err, "PID file hasn't been created") {
+		assert.Equal(t, strconv.Itoa(process.Pid), strings.TrimSpace(string(pid)))
+	}
+
+	require.NoError(t, s.Stop())
+	assert.Equal(t, supervisor.ProcessStateStopped, s.Snapshot().State)
+	assert.NoFileExists(t, pidFile, "PID file hasn't been removed")
+}
+
+func TestCrashDetectionAndRestartTiming(t *testing.T) {
+	const timeoutRespawn = 200 * time.Millisecond
+
+	crashes := make(chan supervisor.CrashInfo, 10)
+	starts := make(chan time.Time, 10)
+	s := supervisor.Supervisor{
+		Name:           "crash",
+		BinPath:        testProcess,
+		Args:           []string{"crash", "3"},
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: timeoutRespawn,
+		MaxRestarts:    2,
+		OnStart:        func(int) { starts <- time.Now() },
+		OnCrash:        func(info supervisor.CrashInfo) { crashes <- info },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	<-starts
+	for range 2 {
+		crash := <-crashes
+		assert.Equal(t, 3, crash.ExitCode)
+		assert.Equal(t, supervisor.CrashReasonUnknown, crash.Reason)
+
+		restartedAt := <-starts
+		assert.GreaterOrEqual(t, restartedAt.Sub(crash.Time), timeoutRespawn, "Restarted too early")
+	}
+}
+
+func TestSIGTERMPropagation(t *testing.T) {
+	signalFile := filepath.Join(t.TempDir(), "signal")
+	s := supervisor.Supervisor{
+		Name:        "serve",
+		BinPath:     testProcess,
+		Args:        []string{"serve", signalFile},
+		RunDir:      t.TempDir(),
+		TimeoutStop: 10 * time.Second,
+	}
+	require.NoError(t, s.Supervise())
+
+	// Give the process some time to install its signal handler.
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, s.Stop())
+	signal, err := os.ReadFile(signalFile)
+	if assert.NoError(t, err, "Process hasn't been terminated gracefully") {
+		assert.Equal(t, "SIGTERM", string(signal))
+	}
+}
+
+func TestEnvInjection(t *testing.T) {
+	dir := t.TempDir()
+	envFile, envOut := filepath.Join(dir, "env"), filepath.Join(dir, "out")
+	require.NoError(t, os.WriteFile(envFile, []byte("FROM_FILE=file\n"), 0600))
+	t.Setenv("ENV_GREETING", "hello")
+
+	s := supervisor.Supervisor{
+		Name:            "env",
+		BinPath:         testProcess,
+		Args:            []string{"env", envOut},
+		RunDir:          t.TempDir(),
+		DataDir:         dir,
+		EnvironmentFile: envFile,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var env []string
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(envOut)
+		env = strings.Split(string(content), "\n")
+		return err == nil && len(content) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	assert.Contains(t, env, "_K0S_MANAGED=yes")
+	assert.Contains(t, env, "GREETING=hello")
+	assert.Contains(t, env, "FROM_FILE=file")
+	for _, e := range env {
+		if path, ok := strings.CutPrefix(e, "PATH="); ok {
+			assert.True(t, strings.HasPrefix(path, filepath.Join(dir, "bin")), "PATH doesn't start with the bin directory: %s", path)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// testprocess is a program to be supervised by the integration tests.
+//
+//	testprocess crash <exit code>  exits right away with the given exit code
+//	testprocess serve <file>       writes "SIGTERM" to file when terminated
+//	testprocess env <file>         writes its environment to file and waits
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fail("usage: testprocess crash|serve|env <arg>")
+	}
+
+	switch arg := os.Args[2]; os.Args[1] {
+	case "crash":
+		code, err := strconv.Atoi(arg)
+		if err != nil {
+			fail(err)
+		}
+		os.Exit(code)
+
+	case "serve":
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM)
+		<-sigs
+		if err := os.WriteFile(arg, []byte("SIGTERM"), 0644); err != nil {
+			fail(err)
+		}
+
+	case "env":
+		if err := os.WriteFile(arg, []byte(strings.Join(os.Environ(), "\n")), 0644); err != nil {
+			fail(err)
+		}
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM)
+		<-sigs
+
+	default:
+		fail("unknown mode:", os.Args[1])
+	}
+}
+
+func fail(v ...any) {
+	fmt.Fprintln(os.Stderr, v...)
+	os.Exit(1)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// leaseClient is the part of the etcd client that's used to maintain leases.
+type leaseClient interface {
+	Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error)
+	KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error)
+	Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
+	Close() error
+}
+
+var newLeaseClient = func(endpoint string) (leaseClient, error) {
+	return clientv3.New(clientv3.Config{Endpoints: []string{endpoint}})
+}
+
+// validateLease checks the lease settings and applies their defaults.
+func (s *Supervisor) validateLease() error {
+	if s.LeaseEndpoint == "" {
+		return nil
+	}
+	if s.LeaseTTL == 0 {
+		s.LeaseTTL = 10 * time.Second
+	} else if s.LeaseTTL < time.Second {
+		return fmt.Errorf("lease TTL %s is less than a second", s.LeaseTTL)
+	}
+	if s.LeaseKey == "" {
+		s.LeaseKey = "/k0s/supervisors/" + s.Name
+	}
+	return nil
+}
+
+// openLeaseClient connects to LeaseEndpoint, if configured.
+func (s *Supervisor) openLeaseClient() error {
+	if s.LeaseEndpoint == "" {
+		return nil
+	}
+	client, err := newLeaseClient(s.LeaseEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to create lease client: %w", err)
+	}
+	s.leaseClient = client
+	return nil
+}
+
+func (s *Supervisor) closeLeaseClient() {
+	if s.leaseClient != nil {
+		if err := s.leaseClient.Close(); err != nil {
+			s.log.WithError(err).Warn("Failed to close lease client")
+		}
+		s.leaseClient = nil
+	}
+}
+
+// startLeaseRenewal keeps the lease of LeaseKey alive in the background. The
+// returned function stops the renewal, so that the key expires after LeaseTTL.
+func (s *Supervisor) startLeaseRenewal(ctx context.Context) (stop func()) {
+	if s.leaseClient == nil {
+		return func() {}
+	}
+	return runInBackground(ctx, s.renewLease)
+}
+
+func (s *Supervisor) renewLease(ctx context.Context) {
+	// Renew well before the lease expires, so that a failed renewal may be
+	// retried in time.
+	ticker := time.NewTicker(s.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	var id clientv3.LeaseID
+	for {
+		var err error
+		if id, err = s.renewLeaseOnce(ctx, id); err != nil && ctx.Err() == nil {
+			s.log.WithError(err).Warnf("Failed to renew lease of %s", s.LeaseKey)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLeaseOnce keeps the lease with the given ID alive, granting a new one
+// if there's none or if it expired, and writes the supervisor's state into
+// LeaseKey. Returns the ID of the renewed lease.
+func (s *Supervisor) renewLeaseOnce(ctx context.Context, id clientv3.LeaseID) (clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.LeaseTTL)
+	defer cancel()
+
+	if id != 0 {
+		_, err := s.leaseClient.KeepAliveOnce(ctx, id)
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			// The lease expired in the meantime.
+			id = 0
+		} else if err != nil {
+			return id, err
+		}
+	}
+	if id == 0 {
+		lease, err := s.leaseClient.Grant(ctx, int64(s.LeaseTTL/time.Second))
+		if err != nil {
+			return 0, err
+		}
+		id = lease.ID
+	}
+
+	state, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return id, err
+	}
+	_, err = s.leaseClient.Put(ctx, s.LeaseKey, string(state), clientv3.WithLease(id))
+	return id, err
+}
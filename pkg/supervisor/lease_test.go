@@ -0,0 +1,132 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLeaseClient struct {
+	mu       sync.Mutex
+	leases   clientv3.LeaseID
+	renewals int
+	expired  bool
+	values   map[string]string
+	closed   bool
+}
+
+func (c *fakeLeaseClient) Grant(context.Context, int64) (*clientv3.LeaseGrantResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leases++
+	c.expired = false
+	return &clientv3.LeaseGrantResponse{ID: c.leases}, nil
+}
+
+func (c *fakeLeaseClient) KeepAliveOnce(context.Context, clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expired {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	c.renewals++
+	return &clientv3.LeaseKeepAliveResponse{}, nil
+}
+
+func (c *fakeLeaseClient) Put(_ context.Context, key, val string, _ ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = val
+	return &clientv3.PutResponse{}, nil
+}
+
+func (c *fakeLeaseClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestLease(t *testing.T) {
+	client := &fakeLeaseClient{values: make(map[string]string)}
+	var endpoint string
+	oldNewLeaseClient := newLeaseClient
+	newLeaseClient = func(e string) (leaseClient, error) { endpoint = e; return client, nil }
+	t.Cleanup(func() { newLeaseClient = oldNewLeaseClient })
+
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+	s := Supervisor{
+		Name:          t.Name(),
+		BinPath:       sleep.binPath,
+		Args:          sleep.binArgs,
+		RunDir:        t.TempDir(),
+		LeaseEndpoint: "http://127.0.0.1:2379",
+		LeaseTTL:      time.Second,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	assert.Equal(t, "http://127.0.0.1:2379", endpoint)
+
+	key := "/k0s/supervisors/" + t.Name()
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.renewals > 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	client.mu.Lock()
+	var state SupervisorState
+	assert.NoError(t, json.Unmarshal([]byte(client.values[key]), &state))
+	assert.Equal(t, ProcessStateRunning, state.State)
+	assert.Equal(t, clientv3.LeaseID(1), client.leases)
+	client.expired = true
+	client.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.leases == 2
+	}, 10*time.Second, 10*time.Millisecond, "Expected an expired lease to be granted anew")
+
+	require.NoError(t, s.Stop())
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.True(t, client.closed)
+}
+
+func TestValidateLease(t *testing.T) {
+	s := Supervisor{Name: "foo", LeaseEndpoint: "http://127.0.0.1:2379"}
+	require.NoError(t, s.validateLease())
+	assert.Equal(t, 10*time.Second, s.LeaseTTL)
+	assert.Equal(t, "/k0s/supervisors/foo", s.LeaseKey)
+
+	s = Supervisor{Name: "foo", LeaseEndpoint: "http://127.0.0.1:2379", LeaseTTL: time.Millisecond}
+	assert.ErrorContains(t, s.validateLease(), "lease TTL 1ms is less than a second")
+}
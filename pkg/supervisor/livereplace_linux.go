@@ -0,0 +1,105 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// LiveReplace replaces the binary of the supervised process with the one at
+// newBinPath, without writing it to disk. The binary is loaded into a sealed,
+// memory-backed file created via memfd_create(2), and BinPath is pointed to
+// it using its /proc/self/fd path. The supervised process is stopped and
+// supervised again, if it was supervised before, keeping its Args. If the new
+// binary fails to start, the previous one is supervised again.
+//
+// The memory-backed file is kept open until the binary is replaced again. As
+// it's closed on exec, the new binary can't be a script. Linux only.
+func (s *Supervisor) LiveReplace(newBinPath string) error {
+	memfd, err := loadIntoMemfd(newBinPath, s.Name)
+	if err != nil {
+		return fmt.Errorf("failed to load %s into memory: %w", newBinPath, err)
+	}
+
+	wasSupervised := s.IsRunning()
+	if wasSupervised {
+		if err := s.Stop(); err != nil {
+			memfd.Close()
+			return err
+		}
+	}
+
+	oldBinPath, oldMemfd := s.BinPath, s.liveBinary
+	s.BinPath = "/proc/self/fd/" + strconv.Itoa(int(memfd.Fd()))
+	s.liveBinary = memfd
+	if !wasSupervised {
+		closeLiveBinary(oldMemfd)
+		return nil
+	}
+
+	if err := s.Supervise(); err != nil {
+		s.log.WithError(err).Errorf("Failed to start %s, reverting to %s", newBinPath, oldBinPath)
+		s.BinPath, s.liveBinary = oldBinPath, oldMemfd
+		closeLiveBinary(memfd)
+		return errors.Join(err, s.Supervise())
+	}
+
+	closeLiveBinary(oldMemfd)
+	return nil
+}
+
+// loadIntoMemfd copies the file at path into a new memory-backed file and
+// seals it against any further modifications.
+func loadIntoMemfd(path, name string) (_ *os.File, err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	fd, err := unix.MemfdCreate(name, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, os.NewSyscallError("memfd_create", err)
+	}
+	memfd := os.NewFile(uintptr(fd), path)
+	defer func() {
+		if err != nil {
+			memfd.Close()
+		}
+	}()
+
+	if _, err := io.Copy(memfd, src); err != nil {
+		return nil, err
+	}
+	seals := unix.F_SEAL_SEAL | unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE
+	if _, err := unix.FcntlInt(memfd.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+	return memfd, nil
+}
+
+func closeLiveBinary(memfd *os.File) {
+	if memfd != nil {
+		memfd.Close()
+	}
+}
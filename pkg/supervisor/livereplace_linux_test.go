@@ -0,0 +1,65 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveReplace(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	require.NoError(t, err)
+
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sleep,
+		RunDir:  t.TempDir(),
+		Args:    []string{"60"},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	require.NoError(t, s.LiveReplace(sleep))
+	assert.Regexp(t, `^/proc/self/fd/\d+$`, s.BinPath)
+	exe, err := os.Readlink("/proc/" + strconv.Itoa(s.GetProcess().Pid) + "/exe")
+	require.NoError(t, err)
+	assert.Contains(t, exe, "memfd:"+t.Name())
+
+	t.Run("missing", func(t *testing.T) {
+		binPath := s.BinPath
+		assert.ErrorIs(t, s.LiveReplace(filepath.Join(t.TempDir(), "missing")), os.ErrNotExist)
+		assert.Equal(t, binPath, s.BinPath)
+		assert.True(t, s.IsRunning())
+	})
+
+	t.Run("revert", func(t *testing.T) {
+		binPath := s.BinPath
+		notExecutable := filepath.Join(t.TempDir(), "not-executable")
+		require.NoError(t, os.WriteFile(notExecutable, []byte("garbage"), 0600))
+
+		assert.Error(t, s.LiveReplace(notExecutable))
+		assert.Equal(t, binPath, s.BinPath)
+		assert.True(t, s.IsRunning())
+	})
+}
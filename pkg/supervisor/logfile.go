@@ -0,0 +1,286 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logFileMode              = 0600
+	logFileSizeCheckInterval = 10 * time.Second
+)
+
+// logFile is an [io.Writer] that appends to a file which may be rotated
+// concurrently.
+type logFile struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f := &logFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *logFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file = file
+	return nil
+}
+
+// Write implements [io.Writer].
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	return f.file.Write(p)
+}
+
+// Close implements [io.Closer].
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotate moves the current log file to <path>.1.gz and starts a new one.
+// Already rotated files are shifted by one, keeping at most maxFiles of them.
+func (f *logFile) rotate(maxFiles int) error {
+	uncompressed, err := f.moveAside(maxFiles)
+	if err != nil {
+		return err
+	}
+
+	// Compress outside of the lock, so that writers aren't blocked.
+	return compressFile(uncompressed, rotatedLogFileName(f.path, 1))
+}
+
+// moveAside shifts the rotated log files and renames the current log file to
+// <path>.1, so that it can be compressed. Starts a new log file afterwards.
+func (f *logFile) moveAside(maxFiles int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return "", os.ErrClosed
+	}
+
+	if err := os.Remove(rotatedLogFileName(f.path, maxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	for i := maxFiles - 1; i > 0; i-- {
+		err := os.Rename(rotatedLogFileName(f.path, i), rotatedLogFileName(f.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	if err := f.file.Close(); err != nil {
+		return "", err
+	}
+	f.file = nil
+
+	uncompressed := f.path + ".1"
+	if err := os.Rename(f.path, uncompressed); err != nil {
+		return "", errors.Join(err, f.open())
+	}
+
+	return uncompressed, f.open()
+}
+
+// startOver renames the current log file to preserved, unless it's empty, and
+// starts a new one.
+func (f *logFile) startOver(preserved string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	stat, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() == 0 {
+		return nil
+	}
+
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if err := os.Rename(f.path, preserved); err != nil {
+		return errors.Join(err, f.open())
+	}
+	return f.open()
+}
+
+func staleLogFileName(path string, t time.Time) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return fmt.Sprintf("%s-%s.log", base, t.UTC().Format("20060102T150405.000000000Z"))
+}
+
+func rotatedLogFileName(path string, n int) string {
+	return fmt.Sprintf("%s.%d.gz", path, n)
+}
+
+// compressFile gzips src into dst and removes src afterwards.
+func compressFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, in.Close()) }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFileMode)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, out.Close()) }()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// rotateOnSize periodically checks the size of the log file, rotating it as
+// soon as it exceeds maxSize, until ctx is done.
+func (f *logFile) rotateOnSize(ctx context.Context, log logrus.FieldLogger, maxSize int64, maxFiles int) {
+	ticker := time.NewTicker(logFileSizeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stat, err := os.Stat(f.path)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					log.WithError(err).Warn("Failed to check log file size")
+				}
+				continue
+			}
+			if stat.Size() > maxSize {
+				log.Debugf("Rotating log file %s", f.path)
+				if err := f.rotate(maxFiles); err != nil {
+					log.WithError(err).Warnf("Failed to rotate log file %s", f.path)
+				}
+			}
+		}
+	}
+}
+
+// openLogFiles opens StdoutFile and StderrFile, if configured, and rotates
+// them in the background until ctx is done.
+func (s *Supervisor) openLogFiles(ctx context.Context) error {
+	maxFiles := s.MaxLogFiles
+	if maxFiles == 0 {
+		maxFiles = 5
+	}
+
+	open := func(path string) (*logFile, error) {
+		if path == "" {
+			return nil, nil
+		}
+		f, err := openLogFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if s.MaxLogFileSize > 0 {
+			go f.rotateOnSize(ctx, s.log, s.MaxLogFileSize, maxFiles)
+		}
+		return f, nil
+	}
+
+	var err error
+	if s.stdoutFile, err = open(s.StdoutFile); err != nil {
+		return err
+	}
+	if s.StderrFile == s.StdoutFile {
+		s.stderrFile = s.stdoutFile
+	} else if s.stderrFile, err = open(s.StderrFile); err != nil {
+		s.closeLogFiles()
+		return err
+	}
+
+	return nil
+}
+
+// truncateStaleLogFiles moves the output of the previous run aside, so that
+// the next run starts with empty log files.
+func (s *Supervisor) truncateStaleLogFiles() {
+	files := []*logFile{s.stdoutFile}
+	if s.stderrFile != s.stdoutFile {
+		files = append(files, s.stderrFile)
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		if f != nil {
+			if err := f.startOver(staleLogFileName(f.path, now)); err != nil {
+				s.log.WithError(err).Warnf("Failed to truncate log file %s", f.path)
+			}
+		}
+	}
+}
+
+func (s *Supervisor) closeLogFiles() {
+	for _, f := range []*logFile{s.stdoutFile, s.stderrFile} {
+		if f != nil {
+			if err := f.Close(); err != nil {
+				s.log.WithError(err).Warnf("Failed to close log file %s", f.path)
+			}
+		}
+	}
+	s.stdoutFile, s.stderrFile = nil, nil
+}
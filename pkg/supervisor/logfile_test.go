@@ -0,0 +1,166 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFile_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := openLogFile(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, f.Close()) })
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+		require.NoError(t, f.rotate(2))
+	}
+	_, err = f.Write([]byte("fourth\n"))
+	require.NoError(t, err)
+
+	assertFileContent := func(t *testing.T, expected, path string) {
+		if content, err := os.ReadFile(path); assert.NoError(t, err) {
+			assert.Equal(t, expected, string(content))
+		}
+	}
+	assertGzippedContent := func(t *testing.T, expected, path string) {
+		gzFile, err := os.Open(path)
+		require.NoError(t, err)
+		defer gzFile.Close()
+		gz, err := gzip.NewReader(gzFile)
+		require.NoError(t, err)
+		content, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+
+	assertFileContent(t, "fourth\n", path)
+	assertGzippedContent(t, "third\n", path+".1.gz")
+	assertGzippedContent(t, "second\n", path+".2.gz")
+	assert.NoFileExists(t, path+".3.gz")
+	assert.NoFileExists(t, path+".1")
+
+	require.NoError(t, f.Close())
+	assert.ErrorIs(t, f.rotate(2), os.ErrClosed)
+}
+
+func TestStdoutFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	logFile := filepath.Join(t.TempDir(), "out.log")
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo out; echo err >&2"}})
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Hour,
+		StdoutFile:     logFile,
+		StderrFile:     logFile,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(logFile)
+		require.NoError(t, err)
+		return len(content) == len("out\nerr\n")
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestLogFile_StartOver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	f, err := openLogFile(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, f.Close()) })
+
+	// Empty log files are kept as they are.
+	preserved := filepath.Join(dir, "preserved.log")
+	require.NoError(t, f.startOver(preserved))
+	assert.NoFileExists(t, preserved)
+
+	_, err = f.Write([]byte("stale\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.startOver(preserved))
+	_, err = f.Write([]byte("fresh\n"))
+	require.NoError(t, err)
+
+	assert.FileExists(t, preserved)
+	content, err := os.ReadFile(preserved)
+	require.NoError(t, err)
+	assert.Equal(t, "stale\n", string(content))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh\n", string(content))
+
+	assert.Equal(t,
+		filepath.Join(dir, "test-20240102T030405.000000000Z.log"),
+		staleLogFileName(path, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+	)
+}
+
+func TestTruncateStaleOutputFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "out.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("stale\n"), 0600))
+
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo fresh"}})
+	s := Supervisor{
+		Name:                     t.Name(),
+		BinPath:                  sh.binPath,
+		Args:                     sh.binArgs,
+		RunDir:                   t.TempDir(),
+		TimeoutRespawn:           1 * time.Hour,
+		StdoutFile:               logFile,
+		StderrFile:               logFile,
+		TruncateStaleOutputFiles: true,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(logFile)
+		require.NoError(t, err)
+		return string(content) == "fresh\n"
+	}, 10*time.Second, 50*time.Millisecond)
+
+	preserved, err := filepath.Glob(filepath.Join(dir, "out-*.log"))
+	require.NoError(t, err)
+	if assert.Len(t, preserved, 1) {
+		content, err := os.ReadFile(preserved[0])
+		require.NoError(t, err)
+		assert.Equal(t, "stale\n", string(content))
+	}
+}
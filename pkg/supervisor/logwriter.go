@@ -18,6 +18,10 @@ package supervisor
 
 import (
 	"bytes"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
@@ -29,10 +33,19 @@ import (
 // This is in contrast to logrus's implementation of io.Writer, which simply
 // errors out if the log line gets longer than 64k.
 type logWriter struct {
-	log     logrus.FieldLogger // receives (possibly chunked) log lines
+	log     logrus.FieldLogger // receives (possibly chunked) log lines; nil only remembers them in output
 	buf     []byte             // buffer in which to accumulate chunks; len(buf) determines the chunk length
 	len     int                // current buffer length
 	chunkNo uint               // current chunk number; 0 means "no chunk"
+	output  *outputBuffer      // optionally remembers all logged lines
+
+	capturePanics bool     // whether to log Go panic stack traces as a single entry
+	panicTrace    []string // the lines of the currently buffered panic stack trace
+
+	sampleRate     float64       // the fraction of lines to log; zero logs all lines
+	reportInterval time.Duration // the interval in which dropped lines are reported
+	reportedAt     time.Time     // the time at which dropped lines have been reported last
+	droppedLines   uint64        // the number of lines dropped since the last report
 }
 
 // Write implements [io.Writer].
@@ -65,10 +78,10 @@ func (w *logWriter) writeBytes(in []byte) {
 			line := bytes.TrimRight(w.buf[off:off+idx], "\r")
 
 			if w.chunkNo == 0 {
-				w.log.Infof("%s", line)
+				w.logLine(line, 0)
 			} else {
 				if len(line) > 0 {
-					w.log.WithField("chunk", w.chunkNo+1).Infof("%s", line)
+					w.logLine(line, w.chunkNo+1)
 				}
 				w.chunkNo = 0
 			}
@@ -90,9 +103,91 @@ func (w *logWriter) writeBytes(in []byte) {
 			// Strip trailing carriage returns
 			line := bytes.TrimRight(w.buf[:len], "\r")
 
-			w.log.WithField("chunk", w.chunkNo+1).Infof("%s", line)
+			w.logLine(line, w.chunkNo+1)
 			w.chunkNo++                      // increase chunk number
 			w.len = copy(w.buf, w.buf[len:]) // discard logged bytes
 		}
 	}
 }
+
+// logLine logs a single (possibly chunked) line. Chunk zero means "no chunk".
+func (w *logWriter) logLine(line []byte, chunk uint) {
+	if w.output != nil {
+		w.output.add(string(line))
+	}
+	if w.log == nil {
+		return
+	}
+
+	if w.capturePanics && w.capturePanicLine(line, chunk) {
+		return
+	}
+
+	if w.sampleRate > 0 && rand.Float64() >= w.sampleRate {
+		w.droppedLines++
+		if time.Since(w.reportedAt) >= w.reportInterval {
+			w.reportDroppedLines()
+		}
+		return
+	}
+
+	if chunk == 0 {
+		w.log.Infof("%s", line)
+	} else {
+		w.log.WithField("chunk", chunk).Infof("%s", line)
+	}
+}
+
+// The header of the panicking goroutine's stack trace.
+var panicHeader = regexp.MustCompile(`^goroutine \d+ \[running\]:$`)
+
+// Lines that may occur within Go stack traces: goroutine headers, function
+// calls, file locations, goroutine creators, elided frames and blank lines.
+var stackTraceLine = regexp.MustCompile(`^(goroutine \d+ \[.*\]:|\S+\(.*\)|\t.*|created by .*|\.\.\.additional frames elided\.\.\.|)$`)
+
+const maxPanicTraceLines = 1000
+
+// capturePanicLine buffers the lines of Go panic stack traces. Returns true if
+// the line has been buffered, false if it needs to be logged as usual.
+func (w *logWriter) capturePanicLine(line []byte, chunk uint) bool {
+	if w.panicTrace == nil {
+		if chunk == 0 && panicHeader.Match(line) {
+			w.panicTrace = []string{string(line)}
+			return true
+		}
+		return false
+	}
+
+	if chunk == 0 && len(w.panicTrace) < maxPanicTraceLines && stackTraceLine.Match(line) {
+		w.panicTrace = append(w.panicTrace, string(line))
+		return true
+	}
+
+	w.flush()
+	return false
+}
+
+// reportDroppedLines logs the number of lines that have been dropped by
+// sampling since the last report, if any.
+func (w *logWriter) reportDroppedLines() {
+	if w.droppedLines > 0 {
+		w.log.WithField("dropped_lines", w.droppedLines).Warnf("Dropped %d log lines due to sampling", w.droppedLines)
+		w.droppedLines = 0
+	}
+	w.reportedAt = time.Now()
+}
+
+// flush logs any buffered panic stack trace and reports any dropped lines.
+func (w *logWriter) flush() {
+	w.reportDroppedLines()
+	if w.panicTrace == nil {
+		return
+	}
+
+	trace := w.panicTrace
+	for len(trace) > 0 && trace[len(trace)-1] == "" {
+		trace = trace[:len(trace)-1]
+	}
+	w.log.WithField("panic_trace", strings.Join(trace, "\n")).Error("Process panicked")
+	w.panicTrace = nil
+}
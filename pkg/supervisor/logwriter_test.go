@@ -17,8 +17,11 @@ limitations under the License.
 package supervisor
 
 import (
+	"math"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -106,3 +109,116 @@ func TestLogWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestLogWriter_CapturePanics(t *testing.T) {
+	log, logs := logtest.NewNullLogger()
+	underTest := logWriter{log: log, buf: make([]byte, 1024), capturePanics: true}
+
+	underTest.writeBytes([]byte(`starting up
+panic: boom
+
+goroutine 1 [running]:
+main.(*server).run(...)
+	/src/main.go:42 +0x1d
+main.main()
+	/src/main.go:12 +0x25
+
+goroutine 7 [chan receive]:
+main.worker(0xc000012345)
+	/src/worker.go:7 +0x3c
+created by main.main in goroutine 1
+	/src/main.go:10 +0x1a
+shutting down
+goroutine 2 [running]:
+main.main()
+`))
+
+	entries := logs.AllEntries()
+	if assert.Len(t, entries, 5) {
+		assert.Equal(t, "starting up", entries[0].Message)
+		assert.Equal(t, "panic: boom", entries[1].Message)
+		assert.Equal(t, "", entries[2].Message)
+
+		assert.Equal(t, logrus.ErrorLevel, entries[3].Level)
+		assert.Equal(t, "Process panicked", entries[3].Message)
+		assert.Equal(t, `goroutine 1 [running]:
+main.(*server).run(...)
+	/src/main.go:42 +0x1d
+main.main()
+	/src/main.go:12 +0x25
+
+goroutine 7 [chan receive]:
+main.worker(0xc000012345)
+	/src/worker.go:7 +0x3c
+created by main.main in goroutine 1
+	/src/main.go:10 +0x1a`, entries[3].Data["panic_trace"])
+
+		assert.Equal(t, "shutting down", entries[4].Message)
+	}
+
+	// Unterminated traces are logged when flushing.
+	logs.Reset()
+	underTest.flush()
+	if entries := logs.AllEntries(); assert.Len(t, entries, 1) {
+		assert.Equal(t, "goroutine 2 [running]:\nmain.main()", entries[0].Data["panic_trace"])
+	}
+}
+
+func TestLogWriter_Sampling(t *testing.T) {
+	log, logs := logtest.NewNullLogger()
+	underTest := logWriter{
+		log:            log,
+		buf:            make([]byte, 1024),
+		output:         newOutputBuffer(1),
+		sampleRate:     0.5,
+		reportInterval: time.Hour,
+		reportedAt:     time.Now(),
+	}
+
+	const numLines = 10000
+	for range numLines {
+		underTest.writeBytes([]byte("line\n"))
+	}
+
+	logged := len(logs.AllEntries())
+	assert.InDelta(t, numLines/2, logged, numLines/10, "Expected about half of the lines to be logged")
+	assert.Equal(t, []string{"line"}, underTest.output.snapshot(), "Output buffer should be unaffected by sampling")
+
+	underTest.flush()
+	if entry := logs.LastEntry(); assert.NotNil(t, entry) {
+		assert.Equal(t, logrus.WarnLevel, entry.Level)
+		assert.Equal(t, uint64(numLines-logged), entry.Data["dropped_lines"])
+	}
+	assert.Len(t, logs.AllEntries(), logged+1)
+
+	underTest.flush()
+	assert.Len(t, logs.AllEntries(), logged+1, "Nothing to report after flushing")
+}
+
+func TestLogWriter_SamplingReportInterval(t *testing.T) {
+	log, logs := logtest.NewNullLogger()
+	underTest := logWriter{
+		log:        log,
+		buf:        make([]byte, 1024),
+		sampleRate: math.SmallestNonzeroFloat64,
+		reportedAt: time.Now(),
+	}
+
+	underTest.writeBytes([]byte("a\nb\n"))
+
+	entries := logs.AllEntries()
+	if assert.Len(t, entries, 2) {
+		for _, entry := range entries {
+			assert.Equal(t, "Dropped 1 log lines due to sampling", entry.Message)
+		}
+	}
+}
+
+func TestLogWriter_OutputOnly(t *testing.T) {
+	underTest := logWriter{buf: make([]byte, 16), output: newOutputBuffer(10)}
+
+	underTest.writeBytes([]byte("a\nb\n"))
+	underTest.flush()
+
+	assert.Equal(t, []string{"a", "b"}, underTest.output.snapshot())
+}
@@ -0,0 +1,739 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SupervisorManager keeps track of the supervisors of a k0s node, keyed by
+// their names.
+type SupervisorManager struct {
+	// The names of the supervisors that StopAll stops one after the other,
+	// in the given order, e.g. etcd last. Supervisors that aren't listed are
+	// stopped afterwards.
+	GracefulStopOrder []string
+	// The time after which paused supervisors are resumed automatically, so
+	// that components aren't left frozen indefinitely. Zero means no limit.
+	MaxPauseDuration time.Duration
+
+	mu                sync.RWMutex
+	supervisors       map[string]*Supervisor
+	paused            map[string]*pause
+	onComponentFailed func(name string, state SupervisorState)
+	subscribersMu     sync.RWMutex
+	subscribers       map[chan ManagerEvent]struct{}
+}
+
+// watchBufferSize is the number of events buffered for each WatchChanges
+// caller. Further events are dropped until the caller catches up.
+const watchBufferSize = 64
+
+// ManagerEvent describes a state transition of a supervisor registered with a
+// [SupervisorManager].
+type ManagerEvent struct {
+	Type          StateChangeType `json:"type"`
+	ComponentName string          `json:"componentName"`
+	// The state of the supervisor after the transition.
+	State SupervisorState `json:"state"`
+}
+
+// pause records that a supervisor has been paused via
+// [SupervisorManager.Pause].
+type pause struct {
+	since time.Time
+	timer *time.Timer
+}
+
+// NewSupervisorManager creates an empty supervisor manager.
+func NewSupervisorManager() *SupervisorManager {
+	return &SupervisorManager{
+		supervisors: make(map[string]*Supervisor),
+		paused:      make(map[string]*pause),
+		subscribers: make(map[chan ManagerEvent]struct{}),
+	}
+}
+
+// Register adds a supervisor to the manager. Names need to be unique.
+func (m *SupervisorManager) Register(s *Supervisor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.supervisors[s.Name]; exists {
+		return fmt.Errorf("supervisor %q already registered", s.Name)
+	}
+	m.supervisors[s.Name] = s
+	s.mutex.Lock()
+	s.manager = m
+	s.mutex.Unlock()
+	return nil
+}
+
+// Unregister removes the supervisor with the given name from the manager.
+func (m *SupervisorManager) Unregister(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.supervisors[name]; ok {
+		s.mutex.Lock()
+		s.manager = nil
+		s.mutex.Unlock()
+		delete(m.supervisors, name)
+	}
+	if p, ok := m.paused[name]; ok {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		delete(m.paused, name)
+	}
+}
+
+// OnComponentFailed sets the function that is called whenever a registered
+// supervisor gives up on its process, as it reached its MaxRestarts. The
+// function is called in a dedicated goroutine with the supervisor's name and
+// state, so that it may react by calling StopAll, for example. Replaces any
+// previously set function.
+func (m *SupervisorManager) OnComponentFailed(fn func(name string, state SupervisorState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onComponentFailed = fn
+}
+
+// reportFailure notifies the manager of s, if any, that s gave up on its
+// process.
+func (s *Supervisor) reportFailure() {
+	s.mutex.Lock()
+	m, state := s.manager, s.snapshotLocked()
+	s.mutex.Unlock()
+	if m == nil {
+		return
+	}
+
+	m.mu.RLock()
+	fn := m.onComponentFailed
+	m.mu.RUnlock()
+	if fn != nil {
+		go fn(s.Name, state)
+	}
+}
+
+// WatchChanges returns a channel on which an event is sent whenever a
+// registered supervisor's process is started, stopped, crashed or restarted.
+// Other transitions, e.g. into the draining state, aren't reported. Each
+// caller gets a channel of its own, which is closed once ctx is done. Events
+// are dropped while the caller's channel is full, so that slow callers don't
+// block the supervisors.
+func (m *SupervisorManager) WatchChanges(ctx context.Context) <-chan ManagerEvent {
+	events := make(chan ManagerEvent, watchBufferSize)
+
+	m.subscribersMu.Lock()
+	m.subscribers[events] = struct{}{}
+	m.subscribersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.subscribersMu.Lock()
+		defer m.subscribersMu.Unlock()
+		delete(m.subscribers, events)
+		close(events)
+	}()
+
+	return events
+}
+
+// publishStateChange notifies the WatchChanges callers about a state
+// transition of a supervisor, if it's relevant.
+func (m *SupervisorManager) publishStateChange(before, after *SupervisorState) {
+	change := classifyStateChange(*before, *after)
+	if change == StateChangeUnchanged {
+		return
+	}
+
+	event := ManagerEvent{Type: change, ComponentName: after.Name, State: *after}
+	m.subscribersMu.RLock()
+	defer m.subscribersMu.RUnlock()
+	for events := range m.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// Get returns the supervisor with the given name, if it's registered.
+func (m *SupervisorManager) Get(name string) (*Supervisor, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.supervisors[name]
+	return s, ok
+}
+
+// FindByAnnotation returns all registered supervisors annotated with the given
+// key and value, sorted by name.
+func (m *SupervisorManager) FindByAnnotation(key, value string) []*Supervisor {
+	return m.find(func(s *Supervisor) bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		v, ok := s.Annotations[key]
+		return ok && v == value
+	})
+}
+
+// FindByBinPath returns all registered supervisors whose BinPath or
+// ResolvedBinPath refers to the binary at the given path, sorted by name.
+// Symlinks are resolved before comparing paths.
+func (m *SupervisorManager) FindByBinPath(path string) []*Supervisor {
+	path = evalSymlinks(path)
+	return m.find(func(s *Supervisor) bool {
+		state := s.Snapshot()
+		for _, binPath := range []string{state.BinPath, state.ResolvedBinPath} {
+			if binPath != "" && evalSymlinks(binPath) == path {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// evalSymlinks returns path with all symlinks resolved, or the cleaned path if
+// that's not possible, e.g. because it doesn't exist.
+func evalSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// Snapshot returns the states of all registered supervisors, keyed by their
+// names. Each state's LastUpdated tells when its supervisor's state last
+// changed. PausedSince is set for supervisors paused via Pause. Snapshot
+// doesn't interact with the supervised processes, so that it completes well
+// within 100ms. Status handlers can call it on every probe.
+func (m *SupervisorManager) Snapshot() map[string]SupervisorState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	states := make(map[string]SupervisorState, len(m.supervisors))
+	for name, s := range m.supervisors {
+		state := s.Snapshot()
+		if p, ok := m.paused[name]; ok {
+			since := p.since
+			state.PausedSince = &since
+		}
+		states[name] = state
+	}
+	return states
+}
+
+// StateChangeType classifies how the state of a supervisor changed between two
+// snapshots.
+type StateChangeType string
+
+const (
+	// The supervised process has been started since the previous snapshot.
+	StateChangeStarted StateChangeType = "started"
+	// The supervisor has been stopped or unregistered since the previous
+	// snapshot.
+	StateChangeStopped StateChangeType = "stopped"
+	// The supervised process exited since the previous snapshot and is about
+	// to be respawned.
+	StateChangeCrashed StateChangeType = "crashed"
+	// The supervised process has been respawned since the previous snapshot.
+	StateChangeRestarted StateChangeType = "restarted"
+	// Nothing relevant changed since the previous snapshot.
+	StateChangeUnchanged StateChangeType = "unchanged"
+)
+
+// StateDiff describes how the state of a supervisor changed between two
+// snapshots.
+type StateDiff struct {
+	ComponentName string          `json:"componentName"`
+	Before        SupervisorState `json:"before"`
+	After         SupervisorState `json:"after"`
+	ChangeType    StateChangeType `json:"changeType"`
+}
+
+// SnapshotDiff compares prev, as returned by a previous call to Snapshot, to
+// the current states of all registered supervisors. It returns the changed
+// ones, sorted by name. Supervisors that aren't part of prev are compared to
+// a stopped state, and so are the ones that have been unregistered since.
+func (m *SupervisorManager) SnapshotDiff(prev map[string]SupervisorState) []StateDiff {
+	current := m.Snapshot()
+
+	var diffs []StateDiff
+	addDiff := func(name string, before, after SupervisorState) {
+		if change := classifyStateChange(before, after); change != StateChangeUnchanged {
+			diffs = append(diffs, StateDiff{ComponentName: name, Before: before, After: after, ChangeType: change})
+		}
+	}
+	for name, after := range current {
+		before, ok := prev[name]
+		if !ok {
+			before = SupervisorState{Name: name, State: ProcessStateStopped}
+		}
+		addDiff(name, before, after)
+	}
+	for name, before := range prev {
+		if _, ok := current[name]; !ok {
+			addDiff(name, before, SupervisorState{Name: name, State: ProcessStateStopped})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].ComponentName < diffs[j].ComponentName })
+	return diffs
+}
+
+func classifyStateChange(before, after SupervisorState) StateChangeType {
+	respawned := after.Restarts > before.Restarts || (after.PID != 0 && before.PID != 0 && after.PID != before.PID)
+
+	switch after.State {
+	case ProcessStateRunning, ProcessStateDraining:
+		switch {
+		case before.State == ProcessStateRestarting:
+			return StateChangeRestarted
+		case before.State.hasProcess():
+			if respawned {
+				return StateChangeRestarted
+			}
+			return StateChangeUnchanged
+		default:
+			return StateChangeStarted
+		}
+
+	case ProcessStateRestarting:
+		if before.State.hasProcess() || (before.State == ProcessStateRestarting && respawned) {
+			return StateChangeCrashed
+		}
+		return StateChangeUnchanged
+
+	default:
+		if before.State != ProcessStateStopped && before.State != "" {
+			return StateChangeStopped
+		}
+		return StateChangeUnchanged
+	}
+}
+
+// HealthReport summarizes the health of the supervisors registered with a
+// [SupervisorManager]. Supervisors are considered healthy if their processes
+// are running.
+type HealthReport struct {
+	AllHealthy          bool     `json:"allHealthy"`
+	HealthyCount        int      `json:"healthyCount"`
+	UnhealthyCount      int      `json:"unhealthyCount"`
+	UnhealthyComponents []string `json:"unhealthyComponents,omitempty"`
+	TotalRestarts       int      `json:"totalRestarts"`
+	// The state of the running supervisor with the longest uptime, if any.
+	OldestComponent SupervisorState `json:"oldestComponent"`
+	// The state of the most recently started supervisor, if any.
+	NewestComponent SupervisorState `json:"newestComponent"`
+}
+
+// HealthReport summarizes the states of all registered supervisors. Like
+// Snapshot, it doesn't interact with the supervised processes, so that it can
+// be used to answer health checks.
+func (m *SupervisorManager) HealthReport() HealthReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var report HealthReport
+	for _, s := range m.supervisors {
+		state := s.Snapshot()
+		report.TotalRestarts += state.Restarts
+		if state.State != ProcessStateRunning {
+			report.UnhealthyCount++
+			report.UnhealthyComponents = append(report.UnhealthyComponents, state.Name)
+			continue
+		}
+
+		if report.HealthyCount == 0 || state.StartedAt.Before(report.OldestComponent.StartedAt) {
+			report.OldestComponent = state
+		}
+		if report.HealthyCount == 0 || state.StartedAt.After(report.NewestComponent.StartedAt) {
+			report.NewestComponent = state
+		}
+		report.HealthyCount++
+	}
+
+	sort.Strings(report.UnhealthyComponents)
+	report.AllHealthy = report.UnhealthyCount == 0
+	return report
+}
+
+// Export returns the configurations of all registered supervisors as YAML,
+// sorted by name. Only the exported fields that can be serialized are
+// included. Hooks, writers, channels and the like are left out, and need to be
+// set up again after an [SupervisorManager.Import]. Fields are exported as
+// supplied, i.e. without the defaults and paths that supervisors derive
+// themselves when started. Supervisors in ConfidentialMode can't be exported,
+// as their Args and ConfigMap would end up in plaintext.
+func (m *SupervisorManager) Export() ([]byte, error) {
+	supervisors := m.find(func(*Supervisor) bool { return true })
+	configs := make([]json.RawMessage, len(supervisors))
+	for i, s := range supervisors {
+		config, err := s.exportConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", s.Name, err)
+		}
+		configs[i] = config
+	}
+	return yaml.Marshal(configs)
+}
+
+// exportConfig returns the configuration of s as JSON.
+func (s *Supervisor) exportConfig() (json.RawMessage, error) {
+	// Some fields are set while starting, i.e. while holding startStopMutex.
+	s.startStopMutex.Lock()
+	defer s.startStopMutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ConfidentialMode {
+		return nil, errors.New("supervisors in confidential mode can't be exported")
+	}
+	return json.Marshal(s.configLocked())
+}
+
+// derivedField is an exported field of a supervisor whose value has been
+// derived by the supervisor itself, e.g. a default value.
+type derivedField struct{ supplied, derived any }
+
+// serializableFieldsLocked returns the values of all serializable exported
+// fields of s. The caller needs to hold s.mutex.
+func (s *Supervisor) serializableFieldsLocked() map[string]any {
+	v := reflect.ValueOf(s).Elem()
+	fields := make(map[string]any)
+	for _, field := range reflect.VisibleFields(v.Type()) {
+		if !field.IsExported() {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Func, reflect.Chan, reflect.Interface:
+			continue
+		}
+		fields[field.Name] = v.FieldByIndex(field.Index).Interface()
+	}
+	return fields
+}
+
+// recordDerivedFields remembers the supplied values of the exported fields
+// that have been changed while starting s.
+func (s *Supervisor) recordDerivedFields(supplied map[string]any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.derivedFields == nil {
+		s.derivedFields = make(map[string]derivedField)
+	}
+	for name, value := range s.serializableFieldsLocked() {
+		prev, known := s.derivedFields[name]
+		switch {
+		case reflect.DeepEqual(supplied[name], value):
+			// Values derived by previous starts may have been changed since.
+			if known && !reflect.DeepEqual(prev.derived, value) {
+				delete(s.derivedFields, name)
+			}
+		case known && reflect.DeepEqual(prev.derived, supplied[name]):
+			s.derivedFields[name] = derivedField{prev.supplied, value}
+		default:
+			s.derivedFields[name] = derivedField{supplied[name], value}
+		}
+	}
+}
+
+// configLocked returns the serializable exported fields of s with non-zero
+// values, as supplied by the caller. Fields that still have the value that the
+// supervisor derived itself are reverted to the supplied value. The caller
+// needs to hold s.mutex.
+func (s *Supervisor) configLocked() map[string]any {
+	config := s.serializableFieldsLocked()
+	for name, value := range config {
+		if field, ok := s.derivedFields[name]; ok && reflect.DeepEqual(field.derived, value) {
+			value = field.supplied
+		}
+		if reflect.ValueOf(value).IsZero() {
+			delete(config, name)
+		} else {
+			config[name] = value
+		}
+	}
+	return config
+}
+
+// Import registers and supervises the supervisors configured in data, as
+// returned by Export. All configurations are validated before any supervisor
+// is registered. If any of them is invalid, or its name is already taken,
+// nothing is started and the returned error lists all invalid configurations.
+// If any of them fails to start, the supervisors started so far are stopped
+// and unregistered again.
+func (m *SupervisorManager) Import(data []byte) error {
+	// Validation applies defaults, which shouldn't look as if they were
+	// supplied. Hence, separate copies are validated.
+	var supervisors, validated []*Supervisor
+	if err := yaml.UnmarshalStrict(data, &supervisors); err != nil {
+		return fmt.Errorf("failed to parse supervisor configurations: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &validated); err != nil {
+		return fmt.Errorf("failed to parse supervisor configurations: %w", err)
+	}
+
+	var errs []error
+	names := make(map[string]bool, len(validated))
+	for i, s := range validated {
+		if s == nil || s.Name == "" {
+			errs = append(errs, fmt.Errorf("supervisor #%d has no name", i+1))
+			continue
+		}
+		if _, exists := m.Get(s.Name); exists || names[s.Name] {
+			errs = append(errs, fmt.Errorf("supervisor %q already registered", s.Name))
+		}
+		names[s.Name] = true
+		if err := s.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid configuration for %s: %w", s.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i, s := range supervisors {
+		if err := m.Register(s); err != nil {
+			return errors.Join(err, m.rollBackImport(supervisors[:i]))
+		}
+		if err := s.Supervise(); err != nil {
+			m.Unregister(s.Name)
+			err = fmt.Errorf("failed to supervise %s: %w", s.Name, err)
+			return errors.Join(err, m.rollBackImport(supervisors[:i]))
+		}
+	}
+	return nil
+}
+
+// rollBackImport stops and unregisters the given, already started supervisors
+// of a failed Import.
+func (m *SupervisorManager) rollBackImport(supervisors []*Supervisor) error {
+	var errs []error
+	for _, s := range supervisors {
+		if err := s.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", s.Name, err))
+		}
+		m.Unregister(s.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// Pause freezes the supervised process of the supervisor with the given name
+// via [Supervisor.Freeze], e.g. for a maintenance window. Pausing an already
+// paused supervisor is a no-op. The time of the pause is reported as
+// PausedSince by Snapshot. If MaxPauseDuration is set, the supervisor is
+// resumed automatically after it.
+func (m *SupervisorManager) Pause(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.supervisors[name]
+	if !ok {
+		return fmt.Errorf("no such component: %q", name)
+	}
+	if _, paused := m.paused[name]; paused {
+		return nil
+	}
+	if err := s.Freeze(); err != nil && !errors.Is(err, ErrAlreadyFrozen) {
+		return err
+	}
+
+	p := &pause{since: time.Now()}
+	if m.MaxPauseDuration > 0 {
+		p.timer = time.AfterFunc(m.MaxPauseDuration, func() {
+			s.log.Warnf("Resuming, as the maximum pause duration of %s has been exceeded", m.MaxPauseDuration)
+			if err := m.resume(name, p); err != nil {
+				s.log.WithError(err).Error("Failed to resume")
+			}
+		})
+	}
+	m.paused[name] = p
+	return nil
+}
+
+// Resume thaws the supervised process of the supervisor with the given name
+// via [Supervisor.Thaw]. Resuming a supervisor that isn't paused is a no-op.
+func (m *SupervisorManager) Resume(name string) error {
+	return m.resume(name, nil)
+}
+
+// resume resumes the supervisor with the given name. If p is not nil, the
+// supervisor is only resumed if it's still paused by p.
+func (m *SupervisorManager) resume(name string, p *pause) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.supervisors[name]
+	if !ok {
+		return fmt.Errorf("no such component: %q", name)
+	}
+	current, paused := m.paused[name]
+	if p != nil && current != p {
+		return nil
+	}
+	if err := s.Thaw(); err != nil && !errors.Is(err, ErrNotFrozen) {
+		return err
+	}
+
+	if paused {
+		if current.timer != nil {
+			current.timer.Stop()
+		}
+		delete(m.paused, name)
+	}
+	return nil
+}
+
+// WaitForAll blocks until all registered supervisors are ready, as signaled
+// by [Supervisor.Ready], or until ctx is done.
+func (m *SupervisorManager) WaitForAll(ctx context.Context) error {
+	for _, s := range m.find(func(*Supervisor) bool { return true }) {
+		select {
+		case <-s.Ready():
+		case <-ctx.Done():
+			return fmt.Errorf("%s is not ready: %w", s.Name, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Drain quiesces the component of the supervisor with the given name by
+// calling its OnDrain hook. The supervisor is in the draining state while the
+// hook runs, and stays in it afterwards, until the process is restarted. If
+// the supervisor's StopAfterDrain is set, it's stopped once the hook returned
+// successfully. If the hook fails, the supervisor goes back to the running
+// state.
+func (m *SupervisorManager) Drain(ctx context.Context, name string) error {
+	s, ok := m.Get(name)
+	if !ok {
+		return fmt.Errorf("no such component: %q", name)
+	}
+	if s.OnDrain == nil {
+		return fmt.Errorf("%s can't be drained, as it has no OnDrain hook", name)
+	}
+	if !s.transitionState(ProcessStateRunning, ProcessStateDraining) {
+		return s.errNotRunning()
+	}
+
+	if err := s.OnDrain(ctx); err != nil {
+		s.transitionState(ProcessStateDraining, ProcessStateRunning)
+		return fmt.Errorf("failed to drain %s: %w", name, err)
+	}
+
+	if s.StopAfterDrain {
+		return s.Stop()
+	}
+	return nil
+}
+
+// StopAll stops all registered supervisors. The ones in GracefulStopOrder are
+// stopped first, sequentially, each one waiting up to its TimeoutStop for its
+// process to exit. The remaining ones are stopped concurrently afterwards.
+// Supervisors that have never been started are skipped.
+func (m *SupervisorManager) StopAll() error {
+	ordered := make(map[string]bool, len(m.GracefulStopOrder))
+	var errs []error
+	stop := func(s *Supervisor) error {
+		if err := s.Stop(); err != nil && !errors.Is(err, ErrNotStarted) {
+			return fmt.Errorf("failed to stop %s: %w", s.Name, err)
+		}
+		return nil
+	}
+
+	for _, name := range m.GracefulStopOrder {
+		ordered[name] = true
+		if s, ok := m.Get(name); ok {
+			if err := stop(s); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	remaining := m.find(func(s *Supervisor) bool { return !ordered[s.Name] })
+	var wg sync.WaitGroup
+	remainingErrs := make([]error, len(remaining))
+	for i, s := range remaining {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			remainingErrs[i] = stop(s)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(append(errs, remainingErrs...)...)
+}
+
+// find returns all registered supervisors matching the given predicate,
+// sorted by name.
+func (m *SupervisorManager) find(matches func(*Supervisor) bool) []*Supervisor {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []*Supervisor
+	for _, s := range m.supervisors {
+		if matches(s) {
+			found = append(found, s)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found
+}
+
+// ServeHTTP reports the state of the registered supervisors as JSON. It
+// responds with 200 if all of them are running, and with 503 otherwise. The
+// component query parameter restricts the report to a single supervisor.
+func (m *SupervisorManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var supervisors []*Supervisor
+	if name := r.URL.Query().Get("component"); name != "" {
+		s, ok := m.Get(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("no such component: %q", name), http.StatusNotFound)
+			return
+		}
+		supervisors = []*Supervisor{s}
+	} else {
+		supervisors = m.find(func(*Supervisor) bool { return true })
+	}
+
+	status := http.StatusOK
+	states := make([]SupervisorState, 0, len(supervisors))
+	for _, s := range supervisors {
+		state := s.Snapshot()
+		if state.State != ProcessStateRunning {
+			status = http.StatusServiceUnavailable
+		}
+		states = append(states, state)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(states)
+}
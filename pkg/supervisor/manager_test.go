@@ -0,0 +1,650 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorManager_Register(t *testing.T) {
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd"}
+
+	require.NoError(t, m.Register(etcd))
+	assert.ErrorContains(t, m.Register(&Supervisor{Name: "etcd"}), `supervisor "etcd" already registered`)
+
+	s, ok := m.Get("etcd")
+	assert.True(t, ok)
+	assert.Same(t, etcd, s)
+
+	m.Unregister("etcd")
+	_, ok = m.Get("etcd")
+	assert.False(t, ok)
+}
+
+func TestSupervisorManager_FindByAnnotation(t *testing.T) {
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", Annotations: map[string]string{"role": "controller"}}
+	apiserver := &Supervisor{Name: "kube-apiserver", Annotations: map[string]string{"role": "controller"}}
+	kubelet := &Supervisor{Name: "kubelet", Annotations: map[string]string{"role": "worker"}}
+	for _, s := range []*Supervisor{kubelet, apiserver, etcd} {
+		require.NoError(t, m.Register(s))
+	}
+
+	assert.Equal(t, []*Supervisor{etcd, apiserver}, m.FindByAnnotation("role", "controller"))
+	assert.Equal(t, []*Supervisor{kubelet}, m.FindByAnnotation("role", "worker"))
+	assert.Empty(t, m.FindByAnnotation("role", ""))
+	assert.Empty(t, m.FindByAnnotation("version", "1.0"))
+}
+
+func TestSupervisorManager_FindByBinPath(t *testing.T) {
+	binDir := t.TempDir()
+	etcdBin := filepath.Join(binDir, "etcd")
+	require.NoError(t, os.WriteFile(etcdBin, nil, 0755))
+	if err := os.Symlink(etcdBin, filepath.Join(binDir, "etcd-current")); err != nil {
+		t.Skipf("Failed to create symlink: %v", err)
+	}
+
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", BinPath: etcdBin}
+	linked := &Supervisor{Name: "etcd-linked", BinPath: filepath.Join(binDir, "etcd-current")}
+	resolved := &Supervisor{Name: "etcd-resolved", BinPath: "etcd", binaryPath: etcdBin}
+	kubelet := &Supervisor{Name: "kubelet", BinPath: filepath.Join(binDir, "kubelet")}
+	for _, s := range []*Supervisor{kubelet, resolved, linked, etcd} {
+		require.NoError(t, m.Register(s))
+	}
+
+	assert.Equal(t, []*Supervisor{etcd, linked, resolved}, m.FindByBinPath(etcdBin))
+	assert.Equal(t, []*Supervisor{etcd, linked, resolved}, m.FindByBinPath(filepath.Join(binDir, "etcd-current")))
+	assert.Equal(t, []*Supervisor{kubelet}, m.FindByBinPath(filepath.Join(binDir, "kubelet")))
+	assert.Empty(t, m.FindByBinPath(filepath.Join(binDir, "containerd")))
+}
+
+func TestSupervisorManager_ServeHTTP(t *testing.T) {
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", state: ProcessStateRunning}
+	kubelet := &Supervisor{Name: "kubelet", state: ProcessStateRestarting}
+	require.NoError(t, m.Register(etcd))
+	require.NoError(t, m.Register(kubelet))
+
+	get := func(t *testing.T, target string) (int, []SupervisorState) {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code == http.StatusNotFound {
+			return rec.Code, nil
+		}
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var states []SupervisorState
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&states))
+		return rec.Code, states
+	}
+
+	t.Run("all", func(t *testing.T) {
+		code, states := get(t, "/")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		if assert.Len(t, states, 2) {
+			assert.Equal(t, "etcd", states[0].Name)
+			assert.Equal(t, ProcessStateRunning, states[0].State)
+			assert.Equal(t, "kubelet", states[1].Name)
+			assert.Equal(t, ProcessStateRestarting, states[1].State)
+		}
+	})
+
+	t.Run("healthy_component", func(t *testing.T) {
+		code, states := get(t, "/?component=etcd")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, states, 1) {
+			assert.Equal(t, "etcd", states[0].Name)
+		}
+	})
+
+	t.Run("unhealthy_component", func(t *testing.T) {
+		code, _ := get(t, "/?component=kubelet")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+	})
+
+	t.Run("unknown_component", func(t *testing.T) {
+		code, _ := get(t, "/?component=konnectivity")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestSupervisorManager_StopAll(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	var mu sync.Mutex
+	var stopped []string
+	m := NewSupervisorManager()
+	m.GracefulStopOrder = []string{"kube-apiserver", "etcd", "unregistered"}
+	for _, name := range []string{"etcd", "kube-apiserver", "kubelet"} {
+		s := &Supervisor{
+			Name:    name,
+			BinPath: sleep.binPath,
+			Args:    sleep.binArgs,
+			RunDir:  t.TempDir(),
+			OnStop:  func() { mu.Lock(); defer mu.Unlock(); stopped = append(stopped, name) },
+		}
+		require.NoError(t, s.Supervise())
+		require.NoError(t, m.Register(s))
+	}
+	require.NoError(t, m.Register(&Supervisor{Name: "not-started"}))
+
+	require.NoError(t, m.StopAll())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"kube-apiserver", "etcd", "kubelet"}, stopped)
+}
+
+func TestSupervisorManager_WaitForAll(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	var probed atomic.Bool
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+	apiserver := &Supervisor{
+		Name:    "kube-apiserver",
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+		StartupProbe: func(context.Context) error {
+			if !probed.Load() {
+				return errors.New("not yet")
+			}
+			return nil
+		},
+		StartupProbeInterval: 10 * time.Millisecond,
+	}
+	for _, s := range []*Supervisor{etcd, apiserver} {
+		require.NoError(t, m.Register(s))
+		require.NoError(t, s.Supervise())
+		t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := m.WaitForAll(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "kube-apiserver is not ready")
+
+	probed.Store(true)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, m.WaitForAll(ctx))
+
+	require.NoError(t, etcd.Stop())
+	select {
+	case <-etcd.Ready():
+		assert.Fail(t, "Stopped supervisor shouldn't be ready")
+	default:
+	}
+}
+
+func TestSupervisorManager_Snapshot(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+	require.NoError(t, m.Register(etcd))
+	require.NoError(t, m.Register(&Supervisor{Name: "kubelet"}))
+	require.NoError(t, etcd.Supervise())
+	t.Cleanup(func() { assert.NoError(t, etcd.Stop(), "Failed to stop") })
+
+	start := time.Now()
+	states := m.Snapshot()
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	require.Len(t, states, 2)
+	assert.Equal(t, ProcessStateRunning, states["etcd"].State)
+	assert.WithinDuration(t, time.Now(), states["etcd"].LastUpdated, time.Minute)
+	assert.Equal(t, ProcessStateStopped, states["kubelet"].State)
+	assert.Zero(t, states["kubelet"].LastUpdated)
+}
+
+func TestSupervisorManager_OnComponentFailed(t *testing.T) {
+	fail := selectCmd(t,
+		cmd{"sh", []string{"-c", "exit 1"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "exit 1"}},
+	)
+
+	type failure struct {
+		name  string
+		state SupervisorState
+		err   error
+	}
+	failures := make(chan failure, 1)
+	m := NewSupervisorManager()
+	m.OnComponentFailed(func(name string, state SupervisorState) {
+		failures <- failure{name, state, m.StopAll()}
+	})
+
+	etcd := &Supervisor{
+		Name:           "etcd",
+		BinPath:        fail.binPath,
+		Args:           fail.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Millisecond,
+		MaxRestarts:    1,
+	}
+	require.NoError(t, m.Register(etcd))
+	require.NoError(t, etcd.Supervise())
+
+	failed := <-failures
+	assert.Equal(t, "etcd", failed.name)
+	assert.Equal(t, "etcd", failed.state.Name)
+	assert.Equal(t, 1, failed.state.Restarts)
+	assert.NoError(t, failed.err)
+	assert.False(t, etcd.IsRunning())
+}
+
+func TestSupervisorManager_Drain(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	m := NewSupervisorManager()
+	var drainErr error
+	var drainingState ProcessState
+	etcd := &Supervisor{
+		Name:    "etcd",
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+		OnDrain: func(context.Context) error {
+			drainingState = m.Snapshot()["etcd"].State
+			return drainErr
+		},
+	}
+	require.NoError(t, m.Register(etcd))
+	require.NoError(t, m.Register(&Supervisor{Name: "kubelet"}))
+
+	assert.ErrorContains(t, m.Drain(context.TODO(), "unregistered"), `no such component: "unregistered"`)
+	assert.ErrorContains(t, m.Drain(context.TODO(), "kubelet"), "kubelet can't be drained, as it has no OnDrain hook")
+	assert.ErrorIs(t, m.Drain(context.TODO(), "etcd"), ErrNotStarted)
+
+	require.NoError(t, etcd.Supervise())
+	t.Cleanup(func() { assert.NoError(t, etcd.Stop(), "Failed to stop") })
+	startedAt := etcd.Snapshot().StartedAt
+
+	t.Run("failure", func(t *testing.T) {
+		drainErr = assert.AnError
+		t.Cleanup(func() { drainErr = nil })
+
+		assert.ErrorIs(t, m.Drain(context.TODO(), "etcd"), assert.AnError)
+		assert.Equal(t, ProcessStateDraining, drainingState)
+		state := etcd.Snapshot()
+		assert.Equal(t, ProcessStateRunning, state.State)
+		assert.True(t, startedAt.Equal(state.StartedAt), "Process start time changed")
+	})
+
+	t.Run("success", func(t *testing.T) {
+		drainingState = ""
+		require.NoError(t, m.Drain(context.TODO(), "etcd"))
+		assert.Equal(t, ProcessStateDraining, drainingState)
+		state := etcd.Snapshot()
+		assert.Equal(t, ProcessStateDraining, state.State)
+		assert.NotZero(t, state.PID)
+		assert.True(t, etcd.IsRunning())
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		etcd.transitionState(ProcessStateDraining, ProcessStateRunning)
+		etcd.StopAfterDrain = true
+		require.NoError(t, m.Drain(context.TODO(), "etcd"))
+		assert.Equal(t, ProcessStateStopped, etcd.Snapshot().State)
+		assert.False(t, etcd.IsRunning())
+		require.NoError(t, etcd.Supervise())
+	})
+}
+
+func TestSupervisorManager_Pause(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Freezing processes is not supported on Windows")
+	}
+
+	sleep := selectCmd(t, cmd{"sleep", []string{"60"}})
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+	require.NoError(t, m.Register(etcd))
+	assert.ErrorContains(t, m.Pause("unregistered"), `no such component: "unregistered"`)
+	assert.ErrorIs(t, m.Pause("etcd"), ErrNotStarted)
+
+	require.NoError(t, etcd.Supervise())
+	t.Cleanup(func() { assert.NoError(t, etcd.Stop(), "Failed to stop") })
+	assert.Nil(t, m.Snapshot()["etcd"].PausedSince)
+
+	t.Run("manual", func(t *testing.T) {
+		require.NoError(t, m.Pause("etcd"))
+		pausedSince := m.Snapshot()["etcd"].PausedSince
+		require.NotNil(t, pausedSince)
+		assert.WithinDuration(t, time.Now(), *pausedSince, time.Minute)
+
+		require.NoError(t, m.Pause("etcd"), "Pause isn't idempotent")
+		assert.Equal(t, pausedSince, m.Snapshot()["etcd"].PausedSince)
+		assert.ErrorIs(t, etcd.Freeze(), ErrAlreadyFrozen)
+
+		require.NoError(t, m.Resume("etcd"))
+		require.NoError(t, m.Resume("etcd"), "Resume isn't idempotent")
+		assert.Nil(t, m.Snapshot()["etcd"].PausedSince)
+		assert.ErrorIs(t, etcd.Thaw(), ErrNotFrozen)
+	})
+
+	t.Run("max_duration", func(t *testing.T) {
+		m.MaxPauseDuration = 10 * time.Millisecond
+		t.Cleanup(func() { m.MaxPauseDuration = 0 })
+
+		require.NoError(t, m.Pause("etcd"))
+		assert.Eventually(t, func() bool {
+			return m.Snapshot()["etcd"].PausedSince == nil
+		}, 10*time.Second, 10*time.Millisecond)
+		assert.ErrorIs(t, etcd.Thaw(), ErrNotFrozen)
+	})
+}
+
+func TestSupervisorManager_ExportImport(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	exporter := NewSupervisorManager()
+	for _, name := range []string{"kubelet", "etcd"} {
+		require.NoError(t, exporter.Register(&Supervisor{
+			Name:        name,
+			BinPath:     sleep.binPath,
+			Args:        sleep.binArgs,
+			RunDir:      t.TempDir(),
+			TimeoutStop: 3 * time.Second,
+			Annotations: map[string]string{"role": "worker"},
+			OnStart:     func(int) {},
+		}))
+	}
+
+	data, err := exporter.Export()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Name: etcd")
+	assert.NotContains(t, string(data), "OnStart")
+
+	t.Run("roundtrip", func(t *testing.T) {
+		m := NewSupervisorManager()
+		require.NoError(t, m.Import(data))
+		t.Cleanup(func() { assert.NoError(t, m.StopAll()) })
+
+		for _, name := range []string{"etcd", "kubelet"} {
+			s, ok := m.Get(name)
+			if assert.True(t, ok, "%s not imported", name) {
+				assert.Equal(t, sleep.binArgs, s.Args)
+				assert.Equal(t, 3*time.Second, s.TimeoutStop)
+				assert.Equal(t, map[string]string{"role": "worker"}, s.Annotations)
+				assert.True(t, s.IsRunning(), "%s not running", name)
+			}
+		}
+
+		reexported, err := m.Export()
+		require.NoError(t, err)
+		assert.YAMLEq(t, string(data), string(reexported))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		m := NewSupervisorManager()
+		running := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+		require.NoError(t, m.Register(running))
+		require.NoError(t, running.Supervise())
+		t.Cleanup(func() { assert.NoError(t, running.Stop(), "Failed to stop") })
+
+		invalid := append(data, []byte("- Name: kube-router\n  ProcessPriority: 42\n")...)
+		err := m.Import(invalid)
+		if assert.Error(t, err) {
+			assert.ErrorContains(t, err, `supervisor "etcd" already registered`)
+			assert.ErrorContains(t, err, "invalid configuration for kube-router: process priority 42 out of range [-20, 19]")
+		}
+
+		_, ok := m.Get("kubelet")
+		assert.False(t, ok, "kubelet has been imported")
+		assert.True(t, running.IsRunning())
+	})
+
+	t.Run("start_failure", func(t *testing.T) {
+		m := NewSupervisorManager()
+		missing := fmt.Sprintf("- Name: zz-missing\n  BinPath: %q\n  RunDir: %q\n",
+			filepath.Join(t.TempDir(), "missing"), t.TempDir())
+		err := m.Import(append(slices.Clip(data), missing...))
+		assert.ErrorContains(t, err, "failed to supervise zz-missing")
+
+		assert.Empty(t, m.Snapshot(), "Supervisors haven't been unregistered")
+		for _, name := range []string{"etcd", "kubelet"} {
+			s, _ := exporter.Get(name)
+			assert.NoFileExists(t, filepath.Join(s.RunDir, name+".pid"), "%s hasn't been stopped", name)
+		}
+	})
+
+	t.Run("started", func(t *testing.T) {
+		m := NewSupervisorManager()
+		s := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+		require.NoError(t, m.Register(s))
+		require.NoError(t, s.Supervise())
+		t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+		require.NotEmpty(t, s.PidFile)
+		require.NotZero(t, s.TimeoutRespawn)
+
+		// Values changed while supervising are exported.
+		s.Annotate("role", "controller")
+
+		data, err := m.Export()
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "PidFile", "Derived PID file exported")
+		assert.NotContains(t, string(data), "TimeoutRespawn", "Default respawn timeout exported")
+		assert.Contains(t, string(data), "role: controller")
+	})
+
+	t.Run("confidential", func(t *testing.T) {
+		m := NewSupervisorManager()
+		require.NoError(t, m.Register(&Supervisor{Name: "etcd", Args: []string{"--password=secret"}, ConfidentialMode: true}))
+		data, err := m.Export()
+		assert.ErrorContains(t, err, "failed to export etcd: supervisors in confidential mode can't be exported")
+		assert.NotContains(t, string(data), "secret")
+	})
+
+	t.Run("unknown_field", func(t *testing.T) {
+		err := NewSupervisorManager().Import([]byte("- Name: etcd\n  Bogus: true\n"))
+		assert.ErrorContains(t, err, "failed to parse supervisor configurations")
+	})
+}
+
+func TestSupervisorManager_HealthReport(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	m := NewSupervisorManager()
+	assert.Equal(t, HealthReport{AllHealthy: true}, m.HealthReport())
+
+	for _, name := range []string{"etcd", "kube-apiserver"} {
+		s := &Supervisor{Name: name, BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+		require.NoError(t, m.Register(s))
+		require.NoError(t, s.Supervise())
+		t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+		time.Sleep(10 * time.Millisecond) // Ensure distinct start times.
+	}
+	require.NoError(t, m.Register(&Supervisor{Name: "kubelet"}))
+	require.NoError(t, m.Register(&Supervisor{Name: "containerd"}))
+
+	report := m.HealthReport()
+	assert.False(t, report.AllHealthy)
+	assert.Equal(t, 2, report.HealthyCount)
+	assert.Equal(t, 2, report.UnhealthyCount)
+	assert.Equal(t, []string{"containerd", "kubelet"}, report.UnhealthyComponents)
+	assert.Zero(t, report.TotalRestarts)
+	assert.Equal(t, "etcd", report.OldestComponent.Name)
+	assert.Equal(t, "kube-apiserver", report.NewestComponent.Name)
+
+	m.Unregister("kubelet")
+	m.Unregister("containerd")
+	assert.True(t, m.HealthReport().AllHealthy)
+}
+
+func TestSupervisorManager_SnapshotDiff(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+	require.NoError(t, m.Register(etcd))
+	require.NoError(t, m.Register(&Supervisor{Name: "kubelet"}))
+
+	prev := m.Snapshot()
+	assert.Empty(t, m.SnapshotDiff(prev))
+
+	require.NoError(t, etcd.Supervise())
+	t.Cleanup(func() { assert.NoError(t, etcd.Stop(), "Failed to stop") })
+	diffs := m.SnapshotDiff(prev)
+	if assert.Len(t, diffs, 1) {
+		assert.Equal(t, "etcd", diffs[0].ComponentName)
+		assert.Equal(t, StateChangeStarted, diffs[0].ChangeType)
+		assert.Equal(t, ProcessStateStopped, diffs[0].Before.State)
+		assert.Equal(t, ProcessStateRunning, diffs[0].After.State)
+	}
+
+	prev = m.Snapshot()
+	assert.Empty(t, m.SnapshotDiff(prev))
+
+	m.Unregister("etcd")
+	diffs = m.SnapshotDiff(prev)
+	if assert.Len(t, diffs, 1) {
+		assert.Equal(t, "etcd", diffs[0].ComponentName)
+		assert.Equal(t, StateChangeStopped, diffs[0].ChangeType)
+	}
+}
+
+func TestClassifyStateChange(t *testing.T) {
+	stopped := SupervisorState{State: ProcessStateStopped}
+	running := SupervisorState{State: ProcessStateRunning, PID: 42}
+	restarting := SupervisorState{State: ProcessStateRestarting}
+	respawned := SupervisorState{State: ProcessStateRunning, PID: 43, Restarts: 1}
+
+	for _, test := range []struct {
+		name          string
+		before, after SupervisorState
+		expected      StateChangeType
+	}{
+		{"started", stopped, running, StateChangeStarted},
+		{"stopped", running, stopped, StateChangeStopped},
+		{"crashed", running, restarting, StateChangeCrashed},
+		{"crashed_again", restarting, SupervisorState{State: ProcessStateRestarting, Restarts: 1}, StateChangeCrashed},
+		{"restarted", restarting, respawned, StateChangeRestarted},
+		{"restarted_between_polls", running, respawned, StateChangeRestarted},
+		{"draining", running, SupervisorState{State: ProcessStateDraining, PID: 42}, StateChangeUnchanged},
+		{"still_running", running, running, StateChangeUnchanged},
+		{"still_restarting", restarting, restarting, StateChangeUnchanged},
+		{"still_stopped", stopped, stopped, StateChangeUnchanged},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, classifyStateChange(test.before, test.after))
+		})
+	}
+}
+
+func TestSupervisorManager_WatchChanges(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	m := NewSupervisorManager()
+	etcd := &Supervisor{Name: "etcd", BinPath: sleep.binPath, Args: sleep.binArgs, RunDir: t.TempDir()}
+	require.NoError(t, m.Register(etcd))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	t.Cleanup(cancel)
+	watchers := []<-chan ManagerEvent{m.WatchChanges(ctx), m.WatchChanges(ctx)}
+
+	next := func(t *testing.T, events <-chan ManagerEvent) ManagerEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(10 * time.Second):
+			require.Fail(t, "Timed out waiting for event")
+			return ManagerEvent{}
+		}
+	}
+
+	require.NoError(t, etcd.Supervise())
+	require.NoError(t, etcd.Stop())
+
+	for _, events := range watchers {
+		event := next(t, events)
+		assert.Equal(t, StateChangeStarted, event.Type)
+		assert.Equal(t, "etcd", event.ComponentName)
+		assert.Equal(t, ProcessStateRunning, event.State.State)
+		assert.NotZero(t, event.State.PID)
+
+		event = next(t, events)
+		assert.Equal(t, StateChangeStopped, event.Type)
+		assert.Equal(t, ProcessStateStopped, event.State.State)
+	}
+
+	cancel()
+	for _, events := range watchers {
+		assert.Eventually(t, func() bool {
+			_, open := <-events
+			return !open
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestSupervisorManager_WatchChanges_SlowConsumer(t *testing.T) {
+	m := NewSupervisorManager()
+	ctx, cancel := context.WithCancel(context.TODO())
+	t.Cleanup(cancel)
+	events := m.WatchChanges(ctx)
+
+	stopped := SupervisorState{Name: "etcd", State: ProcessStateStopped}
+	running := SupervisorState{Name: "etcd", State: ProcessStateRunning}
+	for range 2 * watchBufferSize {
+		m.publishStateChange(&stopped, &running)
+	}
+	assert.Len(t, events, watchBufferSize)
+}
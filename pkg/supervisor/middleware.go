@@ -0,0 +1,235 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/k0sproject/k0s/internal/pkg/file"
+)
+
+// Middleware adds behavior to a supervisor by wrapping its lifecycle hooks.
+type Middleware func(*Supervisor) *Supervisor
+
+// Apply applies the given middlewares in order and returns the resulting
+// supervisor.
+func (s *Supervisor) Apply(middlewares ...Middleware) *Supervisor {
+	for _, middleware := range middlewares {
+		s = middleware(s)
+	}
+	return s
+}
+
+// HookFuncs are lifecycle hooks that can be layered on top of the existing
+// hooks of a supervisor.
+type HookFuncs struct {
+	OnStart func(pid int)
+	OnCrash func(CrashInfo)
+	OnStop  func()
+}
+
+// WithHooks returns a middleware which calls the given hooks after any
+// previously installed hooks.
+func WithHooks(hooks HookFuncs) Middleware {
+	return func(s *Supervisor) *Supervisor {
+		if next := hooks.OnStart; next != nil {
+			if prev := s.OnStart; prev != nil {
+				s.OnStart = func(pid int) { prev(pid); next(pid) }
+			} else {
+				s.OnStart = next
+			}
+		}
+		if next := hooks.OnCrash; next != nil {
+			if prev := s.OnCrash; prev != nil {
+				s.OnCrash = func(info CrashInfo) { prev(info); next(info) }
+			} else {
+				s.OnCrash = next
+			}
+		}
+		if next := hooks.OnStop; next != nil {
+			if prev := s.OnStop; prev != nil {
+				s.OnStop = func() { prev(); next() }
+			} else {
+				s.OnStop = next
+			}
+		}
+		return s
+	}
+}
+
+// WithPrometheusMetrics returns a middleware that counts the starts and
+// crashes of supervised processes. It also measures how long processes take
+// to pass their StartupProbe, if they have one at the time the middleware is
+// applied. The metrics are registered with reg and shared between all
+// supervisors using the same registerer. Fails if reg holds other collectors
+// under the same names.
+func WithPrometheusMetrics(reg prometheus.Registerer) (Middleware, error) {
+	starts, err := registerCounterVec(reg, prometheus.CounterOpts{
+		Namespace: "supervisor",
+		Name:      "starts_total",
+		Help:      "Number of times a supervised process has been started.",
+	})
+	if err != nil {
+		return nil, err
+	}
+	crashes, err := registerCounterVec(reg, prometheus.CounterOpts{
+		Namespace: "supervisor",
+		Name:      "crashes_total",
+		Help:      "Number of times a supervised process exited unexpectedly.",
+	})
+	if err != nil {
+		return nil, err
+	}
+	startDurations, err := registerCollector(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "supervisor",
+		Name:      "start_duration_seconds",
+		Help:      "Time the most recently started supervised process took to pass its startup probe.",
+	}, []string{"component"}))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(s *Supervisor) *Supervisor {
+		name := s.Name
+
+		var mu sync.Mutex
+		var startedAt time.Time
+		if probe := s.StartupProbe; probe != nil {
+			s.StartupProbe = func(ctx context.Context) error {
+				err := probe(ctx)
+				if err == nil {
+					mu.Lock()
+					startDurations.WithLabelValues(name).Set(time.Since(startedAt).Seconds())
+					mu.Unlock()
+				}
+				return err
+			}
+		}
+
+		return WithHooks(HookFuncs{
+			OnStart: func(int) {
+				mu.Lock()
+				startedAt = time.Now()
+				mu.Unlock()
+				starts.WithLabelValues(name).Inc()
+			},
+			OnCrash: func(CrashInfo) { crashes.WithLabelValues(name).Inc() },
+		})(s)
+	}, nil
+}
+
+func registerCounterVec(reg prometheus.Registerer, opts prometheus.CounterOpts) (*prometheus.CounterVec, error) {
+	return registerCollector(reg, prometheus.NewCounterVec(opts, []string{"component"}))
+}
+
+// registerCollector registers collector with reg, returning the already
+// registered collector of the same kind instead, if any.
+func registerCollector[C prometheus.Collector](reg prometheus.Registerer, collector C) (C, error) {
+	if err := reg.Register(collector); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		var zero C
+		return zero, fmt.Errorf("failed to register metrics: %w", err)
+	}
+	return collector, nil
+}
+
+// WithOTelTracing returns a middleware that records a span for each run of
+// the supervised process, from its start until it crashed or got stopped.
+func WithOTelTracing(provider trace.TracerProvider) Middleware {
+	tracer := provider.Tracer("github.com/k0sproject/k0s/pkg/supervisor")
+
+	return func(s *Supervisor) *Supervisor {
+		var mu sync.Mutex
+		var span trace.Span
+
+		name := s.Name
+		return WithHooks(HookFuncs{
+			OnStart: func(pid int) {
+				mu.Lock()
+				defer mu.Unlock()
+				_, span = tracer.Start(context.Background(), "supervised process",
+					trace.WithAttributes(
+						attribute.String("component", name),
+						attribute.Int("pid", pid),
+					),
+				)
+			},
+			OnCrash: func(info CrashInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				if span != nil {
+					span.SetAttributes(attribute.Int("exit_code", info.ExitCode))
+					span.SetStatus(codes.Error, "process exited unexpectedly")
+					span.End()
+					span = nil
+				}
+			},
+			OnStop: func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if span != nil {
+					span.End()
+					span = nil
+				}
+			},
+		})(s)
+	}
+}
+
+// WithCrashReporting returns a middleware that writes a crash report into dir
+// whenever the supervised process crashes.
+func WithCrashReporting(dir string) Middleware {
+	return func(s *Supervisor) *Supervisor {
+		return WithHooks(HookFuncs{
+			OnCrash: func(info CrashInfo) {
+				if err := s.writeCrashReport(dir, info); err != nil {
+					s.log.WithError(err).Warn("Failed to write crash report")
+				}
+			},
+		})(s)
+	}
+}
+
+func (s *Supervisor) writeCrashReport(dir string, info CrashInfo) error {
+	report, err := s.GenerateCrashReport()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.json.gz", s.Name, info.Time.UTC().Format("20060102T150405.000000000Z"))
+	return file.WriteContentAtomically(filepath.Join(dir, name), report, 0600)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply_ComposesMiddlewares(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) Middleware {
+		return WithHooks(HookFuncs{
+			OnStart: func(int) { mu.Lock(); defer mu.Unlock(); calls = append(calls, call+" started") },
+			OnStop:  func() { mu.Lock(); defer mu.Unlock(); calls = append(calls, call+" stopped") },
+		})
+	}
+
+	s := (&Supervisor{
+		Name:    t.Name(),
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}).Apply(record("first"), record("second"))
+
+	require.NoError(t, s.Supervise())
+	require.NoError(t, s.Stop())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"first started", "second started", "first stopped", "second stopped"}, calls)
+}
+
+func TestWithCrashReportingAndMetrics(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reportDir := t.TempDir()
+
+	metrics, err := WithPrometheusMetrics(reg)
+	require.NoError(t, err)
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "exit 1"}})
+	s := (&Supervisor{
+		Name:           "crasher",
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Hour,
+	}).Apply(metrics, WithCrashReporting(reportDir))
+
+	// Metrics are shared between supervisors.
+	otherMetrics, err := WithPrometheusMetrics(reg)
+	require.NoError(t, err)
+	_ = (&Supervisor{Name: "other"}).Apply(otherMetrics)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	var reports []string
+	require.Eventually(t, func() bool {
+		var err error
+		reports, err = filepath.Glob(filepath.Join(reportDir, "crasher-*.json.gz"))
+		require.NoError(t, err)
+		return len(reports) > 0
+	}, 10*time.Second, 50*time.Millisecond)
+
+	if stat, err := os.Stat(reports[0]); assert.NoError(t, err) {
+		assert.NotZero(t, stat.Size())
+	}
+
+	count, err := testutil.GatherAndCount(reg, "supervisor_starts_total", "supervisor_crashes_total")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestWithPrometheusMetrics_Conflict(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "supervisor",
+		Name:      "starts_total",
+		Help:      "Something else.",
+	})))
+
+	_, err := WithPrometheusMetrics(reg)
+	assert.ErrorContains(t, err, "failed to register metrics")
+}
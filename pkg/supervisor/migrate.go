@@ -0,0 +1,163 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/pkg/file"
+)
+
+// migrationRecord is written to the state file after a successful data
+// directory migration.
+type migrationRecord struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Time time.Time `json:"time"`
+}
+
+type stateFileContent struct {
+	Migration *migrationRecord `json:"migration,omitempty"`
+	Shutdowns []time.Duration  `json:"shutdowns,omitempty"`
+}
+
+// Migrate moves the supervisor's data directory to newDataDir. The supervised
+// process is stopped during the migration and supervised again afterwards, if
+// it was supervised before. Files are hard linked into the new directory
+// where possible, and copied otherwise. If the migration fails, the
+// supervisor keeps using its previous data directory.
+//
+// If StateFile is set, the migration is recorded in it, and repeated
+// migrations to the same directory won't copy the data again.
+func (s *Supervisor) Migrate(newDataDir string) error {
+	state, err := s.readStateFile()
+	if err != nil {
+		return err
+	}
+	migrated := state.Migration != nil && state.Migration.To == newDataDir
+	if migrated && s.DataDir == newDataDir {
+		return nil
+	}
+
+	wasSupervised := s.IsRunning()
+	if wasSupervised {
+		if err := s.Stop(); err != nil {
+			return err
+		}
+	}
+
+	oldDataDir := s.DataDir
+	s.DataDir = newDataDir
+	if !migrated {
+		err = copyDataDir(oldDataDir, newDataDir)
+		if err == nil && s.StateFile != "" {
+			state.Migration = &migrationRecord{From: oldDataDir, To: newDataDir, Time: time.Now()}
+			err = s.writeStateFile(state)
+		}
+		if err != nil {
+			s.DataDir = oldDataDir
+			err = fmt.Errorf("failed to migrate data directory from %s to %s: %w", oldDataDir, newDataDir, err)
+		}
+	}
+
+	if wasSupervised {
+		err = errors.Join(err, s.Supervise())
+	}
+	return err
+}
+
+func (s *Supervisor) readStateFile() (*stateFileContent, error) {
+	var state stateFileContent
+	if s.StateFile == "" {
+		return &state, nil
+	}
+
+	data, err := os.ReadFile(s.StateFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", s.StateFile, err)
+	}
+	return &state, nil
+}
+
+func (s *Supervisor) writeStateFile(state *stateFileContent) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return file.WriteContentAtomically(s.StateFile, data, 0600)
+}
+
+// copyDataDir replicates the directory tree at src into dst. Regular files are
+// hard linked if possible, and copied otherwise. Files that already exist in
+// dst are replaced, so that an interrupted copy can be repeated.
+func copyDataDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		case d.Type().IsRegular():
+			if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return file.Copy(path, target)
+
+		default:
+			return fmt.Errorf("unsupported file type: %s (%s)", path, d.Type())
+		}
+	})
+}
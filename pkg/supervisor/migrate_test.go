@@ -0,0 +1,115 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	oldDataDir, newDataDir := t.TempDir(), filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.MkdirAll(filepath.Join(oldDataDir, "member", "snap"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(oldDataDir, "member", "snap", "db"), []byte("db"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(oldDataDir, "config"), []byte("config"), 0644))
+
+	s := Supervisor{
+		Name:      t.Name(),
+		DataDir:   oldDataDir,
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	require.NoError(t, s.Migrate(newDataDir))
+	assert.Equal(t, newDataDir, s.DataDir)
+
+	content, err := os.ReadFile(filepath.Join(newDataDir, "member", "snap", "db"))
+	require.NoError(t, err)
+	assert.Equal(t, "db", string(content))
+	content, err = os.ReadFile(filepath.Join(newDataDir, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "config", string(content))
+	if stat, err := os.Stat(filepath.Join(newDataDir, "member")); assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0700), stat.Mode().Perm())
+	}
+
+	var state stateFileContent
+	content, err = os.ReadFile(s.StateFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(content, &state))
+	if assert.NotNil(t, state.Migration) {
+		assert.Equal(t, oldDataDir, state.Migration.From)
+		assert.Equal(t, newDataDir, state.Migration.To)
+	}
+
+	// Repeated migrations detect the migration record and skip the copy.
+	require.NoError(t, os.WriteFile(filepath.Join(oldDataDir, "new"), nil, 0644))
+	s.DataDir = oldDataDir
+	require.NoError(t, s.Migrate(newDataDir))
+	assert.Equal(t, newDataDir, s.DataDir)
+	assert.NoFileExists(t, filepath.Join(newDataDir, "new"))
+}
+
+func TestMigrate_Rollback(t *testing.T) {
+	oldDataDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(oldDataDir, "db"), []byte("db"), 0600))
+
+	// The new data directory can't be created, as its parent is a file.
+	parent := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(parent, nil, 0644))
+
+	s := Supervisor{
+		Name:      t.Name(),
+		DataDir:   oldDataDir,
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	assert.ErrorContains(t, s.Migrate(filepath.Join(parent, "data")), "failed to migrate data directory")
+	assert.Equal(t, oldDataDir, s.DataDir)
+	assert.NoFileExists(t, s.StateFile)
+}
+
+func TestMigrate_Supervised(t *testing.T) {
+	pingPong := pingpong.New(t)
+	oldDataDir, newDataDir := t.TempDir(), filepath.Join(t.TempDir(), "data")
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		DataDir: oldDataDir,
+		Args:    pingPong.BinArgs(),
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	require.NoError(t, pingPong.AwaitPing())
+	process := s.GetProcess()
+
+	require.NoError(t, s.Migrate(newDataDir))
+	assert.Equal(t, newDataDir, s.DataDir)
+	assert.DirExists(t, newDataDir)
+
+	// The process got restarted in the new data directory.
+	require.NoError(t, pingPong.AwaitPing())
+	assert.NotEqual(t, process.Pid, s.GetProcess().Pid)
+	assert.Equal(t, newDataDir, s.cmd.Dir)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// MountBind describes a bind mount in the private mount namespace of a
+// supervised process.
+type MountBind struct {
+	// The path that is mounted.
+	Source string `json:"source"`
+	// The path at which Source is mounted. It needs to exist.
+	Dest string `json:"dest"`
+	// Whether the mount is read-only.
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+func (s *Supervisor) validateMountBinds() error {
+	for _, bind := range s.MountBinds {
+		if !filepath.IsAbs(bind.Source) || !filepath.IsAbs(bind.Dest) {
+			return fmt.Errorf("bind mount paths need to be absolute: %q -> %q", bind.Source, bind.Dest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// setUpMountBinds makes the mounts of the current mount namespace private and
+// sets up the given bind mounts in it.
+func setUpMountBinds(binds []MountBind) error {
+	// Don't propagate any of the mounts back to the parent namespace.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+
+	for _, bind := range binds {
+		if err := unix.Mount(bind.Source, bind.Dest, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind mount %s to %s: %w", bind.Source, bind.Dest, err)
+		}
+		if bind.ReadOnly {
+			// The read-only flag is ignored when creating bind mounts.
+			err := unix.Mount("", bind.Dest, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, "")
+			if err != nil {
+				return fmt.Errorf("failed to remount %s read-only: %w", bind.Dest, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountBinds(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Bind mounts require root privileges")
+	}
+
+	source, dest := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "greeting"), []byte("hello"), 0644))
+
+	// Let the process report the content of the mount and whether it's
+	// writable.
+	outFile := filepath.Join(t.TempDir(), "out")
+	s := Supervisor{
+		Name:       t.Name(),
+		BinPath:    selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:     t.TempDir(),
+		Args:       []string{"-c", `{ cat "$0/greeting"; touch "$0/new" 2>/dev/null || echo " read-only"; } >"$1.tmp"; mv "$1.tmp" "$1"; exec sleep 10`, dest, outFile},
+		MountBinds: []MountBind{{Source: source, Dest: dest, ReadOnly: true}},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var out []byte
+	require.Eventually(t, func() bool {
+		var err error
+		out, err = os.ReadFile(outFile)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "hello read-only", strings.TrimSpace(string(out)))
+
+	// The mount isn't visible outside of the process's mount namespace.
+	assert.NoFileExists(t, filepath.Join(dest, "greeting"))
+}
+
+func TestMountBinds_RelativePath(t *testing.T) {
+	s := Supervisor{
+		Name:       t.Name(),
+		BinPath:    selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:     t.TempDir(),
+		MountBinds: []MountBind{{Source: "etc", Dest: "/etc"}},
+	}
+	assert.ErrorContains(t, s.Supervise(), "bind mount paths need to be absolute")
+}
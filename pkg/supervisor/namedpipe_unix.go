@@ -0,0 +1,108 @@
+//go:build unix
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// namedPipe is an [io.Writer] that writes to a FIFO on a best-effort basis.
+// It never blocks: Data is dropped if no reader is connected or if the pipe's
+// buffer is full.
+type namedPipe struct {
+	path    string
+	dropped *atomic.Int64 // counts dropped bytes
+
+	mu sync.Mutex
+	fd int // -1 if not connected to a reader
+}
+
+// openNamedPipe creates the FIFO at path, unless it exists already.
+func openNamedPipe(path string, dropped *atomic.Int64) (*namedPipe, error) {
+	if err := unix.Mkfifo(path, 0600); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("failed to create named pipe: %w", err)
+	}
+	if stat, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if stat.Mode().Type() != os.ModeNamedPipe {
+		return nil, fmt.Errorf("not a named pipe: %s", path)
+	}
+
+	return &namedPipe{path: path, dropped: dropped, fd: -1}, nil
+}
+
+// Write implements [io.Writer]. It never fails.
+func (p *namedPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Opening a FIFO for writing in non-blocking mode fails if there's no
+	// reader. Hence, try to connect on each write.
+	if p.fd < 0 {
+		if fd, err := unix.Open(p.path, unix.O_WRONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0); err == nil {
+			p.fd = fd
+		}
+	}
+
+	written := 0
+	for p.fd >= 0 && written < len(b) {
+		n, err := unix.Write(p.fd, b[written:])
+		if n > 0 {
+			written += n
+		}
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			// Keep the connection if the buffer is full. Otherwise, the
+			// reader has gone away.
+			if !errors.Is(err, unix.EAGAIN) {
+				p.closeLocked()
+			}
+			break
+		}
+	}
+
+	if dropped := len(b) - written; dropped > 0 {
+		p.dropped.Add(int64(dropped))
+	}
+	return len(b), nil
+}
+
+// Close implements [io.Closer].
+func (p *namedPipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closeLocked()
+}
+
+func (p *namedPipe) closeLocked() error {
+	if p.fd < 0 {
+		return nil
+	}
+	err := unix.Close(p.fd)
+	p.fd = -1
+	return err
+}
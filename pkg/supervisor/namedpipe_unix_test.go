@@ -0,0 +1,106 @@
+//go:build unix
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamedPipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+	var dropped atomic.Int64
+	pipe, err := openNamedPipe(path, &dropped)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, pipe.Close()) })
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe, stat.Mode().Type())
+
+	// Without a reader, everything is dropped.
+	n, err := pipe.Write([]byte("unread\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, int64(7), dropped.Load())
+
+	reader, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, reader.Close()) })
+
+	_, err = pipe.Write([]byte("read\n"))
+	assert.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err = reader.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "read\n", string(buf[:n]))
+	assert.Equal(t, int64(7), dropped.Load())
+
+	// Whatever doesn't fit into the pipe's buffer is dropped.
+	large := bytes.Repeat([]byte{'x'}, 1024*1024)
+	n, err = pipe.Write(large)
+	assert.NoError(t, err)
+	assert.Equal(t, len(large), n)
+	assert.Greater(t, dropped.Load(), int64(7))
+}
+
+func TestNamedPipe_NotAPipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	_, err := openNamedPipe(path, new(atomic.Int64))
+	assert.ErrorContains(t, err, "not a named pipe")
+}
+
+func TestNamedPipeOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+	require.NoError(t, unix.Mkfifo(path, 0600))
+	reader, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, reader.Close()) })
+
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo out; echo err >&2; exec sleep 10"}})
+	s := Supervisor{
+		Name:            t.Name(),
+		BinPath:         sh.binPath,
+		Args:            sh.binArgs,
+		RunDir:          t.TempDir(),
+		NamedPipeOutput: path,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var output []byte
+	buf := make([]byte, 16)
+	assert.Eventually(t, func() bool {
+		if n, _ := reader.Read(buf); n > 0 {
+			output = append(output, buf[:n]...)
+		}
+		return string(output) == "out\n"
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Zero(t, s.DroppedBytes())
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// startInNetNS starts cmd inside the network namespace at path. Namespaces are
+// a per-thread property, so the namespace is only switched for a dedicated,
+// locked OS thread from which the process is forked. The thread is only
+// handed back to the Go runtime if it could be switched back to its original
+// namespace. Otherwise it's terminated along with its goroutine.
+func startInNetNS(cmd *exec.Cmd, path string) error {
+	netns, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open network namespace: %w", err)
+	}
+	defer netns.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		restored := false
+		defer func() {
+			if restored {
+				runtime.UnlockOSThread()
+			}
+		}()
+
+		origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			restored = true
+			result <- fmt.Errorf("failed to open current network namespace: %w", err)
+			return
+		}
+		defer origin.Close()
+
+		if err := unix.Setns(int(netns.Fd()), unix.CLONE_NEWNET); err != nil {
+			restored = true
+			result <- fmt.Errorf("failed to join network namespace %s: %w", path, err)
+			return
+		}
+
+		err = cmd.Start()
+		restored = unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET) == nil
+		result <- err
+	}()
+
+	return <-result
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestNetNSPath(t *testing.T) {
+	ip, err := exec.LookPath("ip")
+	if err != nil {
+		t.Skip("ip not available: ", err)
+	}
+
+	name := fmt.Sprintf("k0s-supervisor-test-%d", os.Getpid())
+	if out, err := exec.Command(ip, "netns", "add", name).CombinedOutput(); err != nil {
+		t.Skipf("failed to create network namespace: %v: %s", err, out)
+	}
+	t.Cleanup(func() {
+		if out, err := exec.Command(ip, "netns", "delete", name).CombinedOutput(); err != nil {
+			t.Errorf("failed to delete network namespace: %v: %s", err, out)
+		}
+	})
+
+	netnsPath := filepath.Join("/run/netns", name)
+	var netns unix.Stat_t
+	require.NoError(t, unix.Stat(netnsPath, &netns))
+
+	readlink, err := exec.LookPath("readlink")
+	require.NoError(t, err)
+
+	var stdout strings.Builder
+	underTest := Supervisor{
+		Name:       t.Name(),
+		BinPath:    readlink,
+		DataDir:    t.TempDir(),
+		NetNSPath:  netnsPath,
+		ExecStdout: &stdout,
+	}
+	require.NoError(t, underTest.Exec("/proc/self/ns/net"))
+	assert.Equal(t, fmt.Sprintf("net:[%d]", netns.Ino), strings.TrimSpace(stdout.String()))
+
+	// The calling goroutine stays in the original network namespace.
+	current, err := os.Readlink("/proc/thread-self/ns/net")
+	require.NoError(t, err)
+	assert.NotEqual(t, fmt.Sprintf("net:[%d]", netns.Ino), current)
+}
+
+func TestNetNSPath_Invalid(t *testing.T) {
+	underTest := Supervisor{
+		Name:      t.Name(),
+		BinPath:   "true",
+		DataDir:   t.TempDir(),
+		NetNSPath: filepath.Join(t.TempDir(), "missing"),
+	}
+	assert.ErrorContains(t, underTest.Exec(), "failed to open network namespace")
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+)
+
+// NetworkPolicySpec restricts the outbound connections of a supervised
+// process. Connections are allowed if both their destination network and
+// port are allowed.
+type NetworkPolicySpec struct {
+	// The networks to which the process may connect, e.g. "10.96.0.0/12".
+	// Any network is allowed if empty.
+	AllowedCIDRs []string
+	// The TCP and UDP ports to which the process may connect. Any port is
+	// allowed if empty.
+	AllowedPorts []int
+}
+
+// validateNetworkPolicy checks if NetworkPolicy can be enforced.
+func (s *Supervisor) validateNetworkPolicy() error {
+	if s.NetworkPolicy == nil {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("network policies are not supported on %s", runtime.GOOS)
+	}
+	// The rules match the UID of the process, which must not be the one of k0s.
+	if s.UID == 0 {
+		return errors.New("network policies require the supervised process to run as a dedicated user")
+	}
+	for _, cidr := range s.NetworkPolicy.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid network policy: %w", err)
+		}
+	}
+	for _, port := range s.NetworkPolicy.AllowedPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid network policy: port %d out of range [1, 65535]", port)
+		}
+	}
+	return nil
+}
+
+// networkPolicyChain returns the name of the iptables chain that holds the
+// rules of NetworkPolicy. Chain names are limited to 28 characters.
+func (s *Supervisor) networkPolicyChain() string {
+	sum := sha256.Sum256([]byte(s.Name))
+	return "K0S-NETPOL-" + hex.EncodeToString(sum[:4])
+}
+
+// applyNetworkPolicy installs iptables rules that drop all outbound
+// connections of the supervised process's UID that aren't allowed by
+// NetworkPolicy, both for IPv4 and IPv6. As the rules match the UID, they're
+// installed before the process is started, so that there's no window in which
+// it's unrestricted. Supervisors must not share the UID of their processes.
+func (s *Supervisor) applyNetworkPolicy() error {
+	var v4, v6 []string
+	for _, cidr := range s.NetworkPolicy.AllowedCIDRs {
+		if ip, _, _ := net.ParseCIDR(cidr); ip.To4() != nil {
+			v4 = append(v4, cidr)
+		} else {
+			v6 = append(v6, cidr)
+		}
+	}
+
+	anyNetwork := len(s.NetworkPolicy.AllowedCIDRs) == 0
+	for _, family := range []struct {
+		binary string
+		cidrs  []string
+	}{{"iptables", v4}, {"ip6tables", v6}} {
+		// Clean up any leftovers, e.g. of a crashed k0s.
+		_ = s.removeNetworkPolicyRules(family.binary)
+
+		if err := s.applyNetworkPolicyRules(family.binary, family.cidrs, anyNetwork); err != nil {
+			_ = s.removeNetworkPolicyRules("iptables")
+			_ = s.removeNetworkPolicyRules("ip6tables")
+			return fmt.Errorf("failed to apply network policy: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Supervisor) applyNetworkPolicyRules(binary string, cidrs []string, anyNetwork bool) error {
+	chain := s.networkPolicyChain()
+	rules := [][]string{
+		{"-N", chain},
+		// Let through the traffic of allowed and inbound connections.
+		{"-A", chain, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+	}
+
+	var destinations [][]string
+	if anyNetwork {
+		destinations = [][]string{nil}
+	}
+	for _, cidr := range cidrs {
+		destinations = append(destinations, []string{"-d", cidr})
+	}
+	for _, destination := range destinations {
+		if len(s.NetworkPolicy.AllowedPorts) == 0 {
+			rules = append(rules, append(append([]string{"-A", chain}, destination...), "-j", "RETURN"))
+			continue
+		}
+		for _, port := range s.NetworkPolicy.AllowedPorts {
+			for _, protocol := range []string{"tcp", "udp"} {
+				rule := append([]string{"-A", chain}, destination...)
+				rules = append(rules, append(rule, "-p", protocol, "--dport", strconv.Itoa(port), "-j", "RETURN"))
+			}
+		}
+	}
+
+	rules = append(rules,
+		[]string{"-A", chain, "-j", "DROP"},
+		[]string{"-I", "OUTPUT", "-m", "owner", "--uid-owner", strconv.Itoa(s.UID), "-j", chain},
+	)
+
+	for _, rule := range rules {
+		if err := runCommand(binary, append([]string{"-w"}, rule...)...); err != nil {
+			return fmt.Errorf("%s %v: %w", binary, rule, err)
+		}
+	}
+	return nil
+}
+
+// removeNetworkPolicy removes the iptables rules installed by
+// applyNetworkPolicy.
+func (s *Supervisor) removeNetworkPolicy() {
+	for _, binary := range []string{"iptables", "ip6tables"} {
+		if err := s.removeNetworkPolicyRules(binary); err != nil {
+			s.log.WithError(err).Warnf("Failed to remove network policy via %s", binary)
+		}
+	}
+}
+
+func (s *Supervisor) removeNetworkPolicyRules(binary string) error {
+	chain := s.networkPolicyChain()
+	var errs []error
+	for _, rule := range [][]string{
+		{"-D", "OUTPUT", "-m", "owner", "--uid-owner", strconv.Itoa(s.UID), "-j", chain},
+		{"-F", chain},
+		{"-X", chain},
+	} {
+		if err := runCommand(binary, append([]string{"-w"}, rule...)...); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", rule, err))
+		}
+	}
+	return errors.Join(errs...)
+}
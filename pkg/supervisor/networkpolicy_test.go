@@ -0,0 +1,156 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIPTables writes fake iptables and ip6tables binaries into PATH that
+// record their invocations and fail if their args contain the value of the
+// FAKE_IPTABLES_FAIL environment variable.
+func fakeIPTables(t *testing.T) (callsFile string) {
+	binDir := t.TempDir()
+	callsFile = filepath.Join(t.TempDir(), "calls")
+	for _, name := range []string{"iptables", "ip6tables"} {
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, name), []byte(`#!/bin/sh
+echo "${0##*/} $*" >>"`+callsFile+`"
+case " $* " in
+*" $FAKE_IPTABLES_FAIL "*) echo "iptables: failure" >&2; exit 1 ;;
+esac
+`), 0700))
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_IPTABLES_FAIL", "nothing")
+	return callsFile
+}
+
+func readCalls(t *testing.T, callsFile string) []string {
+	calls, err := os.ReadFile(callsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(callsFile))
+	return strings.Split(strings.TrimSuffix(string(calls), "\n"), "\n")
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Requires a POSIX shell")
+	}
+
+	callsFile := fakeIPTables(t)
+	log, _ := logtest.NewNullLogger()
+	s := Supervisor{
+		Name: "etcd",
+		UID:  1000,
+		NetworkPolicy: &NetworkPolicySpec{
+			AllowedCIDRs: []string{"10.0.0.0/8", "fd00::/8"},
+			AllowedPorts: []int{2380},
+		},
+		log: log.WithField("component", t.Name()),
+	}
+	chain := s.networkPolicyChain()
+	assert.LessOrEqual(t, len(chain), 28)
+
+	removal := func(binary string) []string {
+		return []string{
+			binary + " -w -D OUTPUT -m owner --uid-owner 1000 -j " + chain,
+			binary + " -w -F " + chain,
+			binary + " -w -X " + chain,
+		}
+	}
+	rules := func(binary, cidr string) []string {
+		return []string{
+			binary + " -w -N " + chain,
+			binary + " -w -A " + chain + " -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN",
+			binary + " -w -A " + chain + " -d " + cidr + " -p tcp --dport 2380 -j RETURN",
+			binary + " -w -A " + chain + " -d " + cidr + " -p udp --dport 2380 -j RETURN",
+			binary + " -w -A " + chain + " -j DROP",
+			binary + " -w -I OUTPUT -m owner --uid-owner 1000 -j " + chain,
+		}
+	}
+
+	require.NoError(t, s.applyNetworkPolicy())
+	var expected []string
+	expected = append(expected, removal("iptables")...)
+	expected = append(expected, rules("iptables", "10.0.0.0/8")...)
+	expected = append(expected, removal("ip6tables")...)
+	expected = append(expected, rules("ip6tables", "fd00::/8")...)
+	assert.Equal(t, expected, readCalls(t, callsFile))
+
+	s.removeNetworkPolicy()
+	assert.Equal(t, append(removal("iptables"), removal("ip6tables")...), readCalls(t, callsFile))
+
+	t.Run("any_destination", func(t *testing.T) {
+		policy := s.NetworkPolicy
+		t.Cleanup(func() { s.NetworkPolicy = policy })
+		s.NetworkPolicy = &NetworkPolicySpec{AllowedPorts: []int{443}}
+		require.NoError(t, s.applyNetworkPolicy())
+		calls := readCalls(t, callsFile)
+		for _, binary := range []string{"iptables", "ip6tables"} {
+			assert.Contains(t, calls, binary+" -w -A "+chain+" -p tcp --dport 443 -j RETURN")
+			assert.Contains(t, calls, binary+" -w -A "+chain+" -p udp --dport 443 -j RETURN")
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		t.Setenv("FAKE_IPTABLES_FAIL", "DROP")
+		err := s.applyNetworkPolicy()
+		assert.ErrorContains(t, err, "failed to apply network policy: iptables")
+		assert.ErrorContains(t, err, "iptables: failure")
+		calls := readCalls(t, callsFile)
+		assert.Equal(t, append(removal("iptables"), removal("ip6tables")...), calls[len(calls)-6:], "Expected a cleanup")
+	})
+}
+
+func TestValidateNetworkPolicy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		s := Supervisor{UID: 1000, NetworkPolicy: &NetworkPolicySpec{}}
+		assert.ErrorContains(t, s.validateNetworkPolicy(), "network policies are not supported on "+runtime.GOOS)
+		return
+	}
+
+	for _, test := range []struct {
+		name, err string
+		uid       int
+		policy    NetworkPolicySpec
+	}{
+		{"valid", "", 1000, NetworkPolicySpec{AllowedCIDRs: []string{"10.0.0.0/8"}, AllowedPorts: []int{443}}},
+		{"root", "require the supervised process to run as a dedicated user", 0, NetworkPolicySpec{}},
+		{"cidr", "invalid network policy: invalid CIDR address: 10.0.0.1", 1000, NetworkPolicySpec{AllowedCIDRs: []string{"10.0.0.1"}}},
+		{"port", "invalid network policy: port 0 out of range [1, 65535]", 1000, NetworkPolicySpec{AllowedPorts: []int{0}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := Supervisor{UID: test.uid, NetworkPolicy: &test.policy}
+			if test.err == "" {
+				assert.NoError(t, s.validateNetworkPolicy())
+			} else {
+				assert.ErrorContains(t, s.validateNetworkPolicy(), test.err)
+			}
+		})
+	}
+}
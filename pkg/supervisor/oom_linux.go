@@ -0,0 +1,54 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// oomKilled checks the kernel log for an OOM kill of the given pid. Reading the
+// kernel log requires elevated privileges, so this may not be able to detect
+// OOM kills.
+func oomKilled(pid int) bool {
+	fd, err := unix.Open("/dev/kmsg", unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+
+	// The kernel reports OOM kills, both system-wide and for memory cgroups,
+	// as "Killed process <pid> (<name>) ...".
+	needle := []byte(fmt.Sprintf("Killed process %d ", pid))
+
+	// Each read returns a single record. EAGAIN signals the end of the log.
+	buf := make([]byte, 8192)
+	for {
+		n, err := unix.Read(fd, buf)
+		switch {
+		case errors.Is(err, unix.EPIPE):
+			continue // The record has been overwritten, skip it.
+		case err != nil:
+			return false
+		case bytes.Contains(buf[:n], needle):
+			return true
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import "sync"
+
+// outputBuffer is a ring buffer that remembers the most recent output lines
+// of a supervised process. It's safe for concurrent use.
+type outputBuffer struct {
+	mu    sync.Mutex
+	lines []string // ring storage; len(lines) determines the capacity
+	next  int      // index at which the next line will be stored
+	full  bool     // whether the ring storage has wrapped around
+	total uint64   // the number of lines that have been added overall
+}
+
+func newOutputBuffer(capacity int) *outputBuffer {
+	return &outputBuffer{lines: make([]string, capacity)}
+}
+
+func (b *outputBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.total++
+}
+
+// count returns the number of lines that have been added overall.
+func (b *outputBuffer) count() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// snapshot returns a copy of the buffered lines, oldest first.
+func (b *outputBuffer) snapshot() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshotLocked()
+}
+
+// linesSince returns a copy of the buffered lines that have been added after
+// the first n lines, oldest first, along with the number of lines that have
+// been added overall.
+func (b *outputBuffer) linesSince(n uint64) ([]string, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := b.snapshotLocked()
+	if newer := b.total - min(n, b.total); newer < uint64(len(lines)) {
+		lines = lines[len(lines)-int(newer):]
+	}
+	return lines, b.total
+}
+
+func (b *outputBuffer) snapshotLocked() []string {
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	return append(append([]string(nil), b.lines[b.next:]...), b.lines[:b.next]...)
+}
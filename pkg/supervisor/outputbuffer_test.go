@@ -0,0 +1,59 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	b := newOutputBuffer(3)
+	assert.Empty(t, b.snapshot())
+
+	b.add("a")
+	b.add("b")
+	assert.Equal(t, []string{"a", "b"}, b.snapshot())
+
+	b.add("c")
+	b.add("d")
+	assert.Equal(t, []string{"b", "c", "d"}, b.snapshot())
+}
+
+func TestOutputBuffer_LinesSince(t *testing.T) {
+	b := newOutputBuffer(3)
+	b.add("a")
+	mark := b.count()
+	assert.Equal(t, uint64(1), mark)
+
+	lines, total := b.linesSince(mark)
+	assert.Empty(t, lines)
+	assert.Equal(t, uint64(1), total)
+
+	b.add("b")
+	b.add("c")
+	lines, total = b.linesSince(mark)
+	assert.Equal(t, []string{"b", "c"}, lines)
+	assert.Equal(t, uint64(3), total)
+
+	b.add("d")
+	b.add("e")
+	lines, total = b.linesSince(mark)
+	assert.Equal(t, []string{"c", "d", "e"}, lines, "Should only return lines that are still buffered")
+	assert.Equal(t, uint64(5), total)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// perfCounter is a performance counter attached to the supervised process.
+type perfCounter interface {
+	read() (uint64, error)
+	close() error
+}
+
+// GetPerfCounters returns the most recently sampled values of PerfCounters.
+// The values are reset whenever the supervised process is restarted and are
+// retained after it exited. Counters that couldn't be attached are missing.
+func (s *Supervisor) GetPerfCounters() map[string]uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return maps.Clone(s.perfValues)
+}
+
+// startPerfCounters attaches PerfCounters to the process with the given pid
+// and samples them every PerfSampleInterval in the background. The returned
+// function takes a final sample and detaches the counters.
+func (s *Supervisor) startPerfCounters(ctx context.Context, pid int) (stop func()) {
+	s.mutex.Lock()
+	s.perfValues = nil
+	s.mutex.Unlock()
+
+	if len(s.PerfCounters) == 0 {
+		return func() {}
+	}
+
+	counters := make(map[string]perfCounter, len(s.PerfCounters))
+	for _, name := range s.PerfCounters {
+		counter, err := openPerfCounter(name, pid)
+		if err != nil {
+			s.log.WithError(err).Warnf("Failed to attach performance counter %s to pid %d", name, pid)
+			continue
+		}
+		counters[name] = counter
+	}
+
+	stopSampling := runInBackground(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(s.PerfSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.samplePerfCounters(counters)
+			}
+		}
+	})
+
+	return func() {
+		stopSampling()
+		s.samplePerfCounters(counters)
+		for name, counter := range counters {
+			if err := counter.close(); err != nil {
+				s.log.WithError(err).Warnf("Failed to detach performance counter %s", name)
+			}
+		}
+	}
+}
+
+func (s *Supervisor) samplePerfCounters(counters map[string]perfCounter) {
+	values := make(map[string]uint64, len(counters))
+	for name, counter := range counters {
+		value, err := counter.read()
+		if err != nil {
+			s.log.WithError(err).Debugf("Failed to read performance counter %s", name)
+			continue
+		}
+		values[name] = value
+	}
+
+	s.mutex.Lock()
+	s.perfValues = values
+	s.mutex.Unlock()
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerfCounters(t *testing.T) {
+	if probe, err := openPerfCounter("task-clock", os.Getpid()); err != nil {
+		t.Skip("Performance counters are unavailable:", err)
+	} else {
+		require.NoError(t, probe.close())
+	}
+
+	s := Supervisor{
+		Name:               t.Name(),
+		BinPath:            selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:             t.TempDir(),
+		Args:               []string{"-c", "while :; do :; done"},
+		PerfCounters:       []string{"task-clock"},
+		PerfSampleInterval: 10 * time.Millisecond,
+	}
+	require.NoError(t, s.Supervise())
+
+	require.Eventually(t, func() bool {
+		return s.GetPerfCounters()["task-clock"] > 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Stop())
+	assert.Contains(t, s.GetPerfCounters(), "task-clock", "Final sample is missing")
+}
+
+func TestPerfCounters_Unknown(t *testing.T) {
+	s := Supervisor{
+		Name:         t.Name(),
+		BinPath:      filepath.Join(t.TempDir(), "foo"),
+		RunDir:       t.TempDir(),
+		PerfCounters: []string{"cache-misses", "foo"},
+	}
+	assert.ErrorContains(t, s.Supervise(), `unknown performance counter: "foo"`)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// runPostStart calls PostStart for the freshly started process, killing it if
+// PostStart fails. The supervisor then treats the process as crashed.
+func (s *Supervisor) runPostStart() error {
+	if s.PostStart == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	process := s.cmd.Process
+	s.mutex.Unlock()
+
+	postStartErr := s.PostStart(process.Pid)
+	if postStartErr == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	log := s.log.WithError(postStartErr)
+	if err := process.Kill(); err != nil {
+		if !errors.Is(err, os.ErrProcessDone) {
+			log.Warnf("Failed to kill pid %d, whose post-start hook failed: %v", process.Pid, err)
+		}
+	} else {
+		log.Errorf("Killed pid %d, as its post-start hook failed", process.Pid)
+		s.stopReason = CrashReasonPostStartFailed
+	}
+	return fmt.Errorf("post-start hook failed: %w", postStartErr)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessPriority(t *testing.T) {
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:            t.Name(),
+		BinPath:         selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:          t.TempDir(),
+		Args:            []string{"-c", "exec sleep 10"},
+		ProcessPriority: 7,
+		OnStart:         func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	require.NoError(t, err)
+	// The nice value is the 19th field, the 17th after the parenthesized
+	// command name.
+	_, fields, ok := strings.Cut(string(stat), ") ")
+	require.True(t, ok, "Unexpected stat format: %s", stat)
+	assert.Equal(t, "7", strings.Fields(fields)[16])
+}
+
+func TestThreadIDs(t *testing.T) {
+	tids, err := threadIDs(os.Getpid())
+	require.NoError(t, err)
+	// The Go runtime always uses more than one thread.
+	assert.Greater(t, len(tids), 1)
+	assert.Contains(t, tids, os.Getpid())
+}
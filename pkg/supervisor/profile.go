@@ -0,0 +1,119 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"runtime"
+	"time"
+)
+
+// ErrNoProfiler is returned by [Supervisor.Profile] if the supervised process
+// exposes no pprof endpoint and perf isn't available either.
+var ErrNoProfiler = errors.New("no pprof endpoint and no perf")
+
+// The time to wait for a listening port to respond when probing it for a
+// pprof endpoint.
+const pprofProbeTimeout = time.Second
+
+// Profile captures a CPU profile of the supervised process for the given
+// duration and writes it in pprof format to output. The profile is fetched
+// from the /debug/pprof/profile endpoint, if the process exposes one on any
+// of its listening TCP ports. Otherwise, it's recorded using perf and
+// converted using perf_to_profile, both of which need to be in PATH. Linux
+// only.
+func (s *Supervisor) Profile(duration time.Duration, output io.Writer) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("CPU profiles are not supported on %s", runtime.GOOS)
+	}
+
+	pid := s.Snapshot().PID
+	if pid == 0 {
+		return s.errNotRunning()
+	}
+
+	addrs, err := listeningTCPAddrs(pid)
+	if err != nil {
+		return fmt.Errorf("failed to determine listening ports: %w", err)
+	}
+
+	if endpoint := findPprofEndpoint(addrs); endpoint != "" {
+		s.log.Infof("Fetching %s CPU profile of pid %d from %s", duration, pid, endpoint)
+		return fetchCPUProfile(endpoint, duration, output)
+	}
+
+	s.log.Infof("Recording %s CPU profile of pid %d using perf", duration, pid)
+	return recordCPUProfile(pid, duration, output)
+}
+
+// findPprofEndpoint returns the base URL of the first pprof endpoint served
+// on any of the given addresses, or the empty string if there's none.
+func findPprofEndpoint(addrs []netip.AddrPort) string {
+	client := http.Client{Timeout: pprofProbeTimeout}
+	for _, addr := range addrs {
+		if ip := addr.Addr(); ip.IsUnspecified() {
+			if ip.Is4() {
+				ip = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+			} else {
+				ip = netip.IPv6Loopback()
+			}
+			addr = netip.AddrPortFrom(ip, addr.Port())
+		}
+		endpoint := "http://" + addr.String() + "/debug/pprof/"
+		resp, err := client.Get(endpoint)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return endpoint
+		}
+	}
+	return ""
+}
+
+// fetchCPUProfile fetches a CPU profile of the given duration from the pprof
+// endpoint at the given base URL.
+func fetchCPUProfile(endpoint string, duration time.Duration, output io.Writer) error {
+	// Give the endpoint some leeway for collecting the profile.
+	ctx, cancel := context.WithTimeout(context.Background(), duration+30*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%sprofile?seconds=%d", endpoint, max(int(duration.Seconds()), 1))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to pprof endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch CPU profile from %s: %s", url, resp.Status)
+	}
+	if _, err := io.Copy(output, resp.Body); err != nil {
+		return fmt.Errorf("failed to fetch CPU profile from %s: %w", url, err)
+	}
+	return nil
+}
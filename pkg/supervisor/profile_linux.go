@@ -0,0 +1,161 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listeningTCPAddrs returns the addresses on which the process with the given
+// pid listens for TCP connections.
+func listeningTCPAddrs(pid int) ([]netip.AddrPort, error) {
+	fdDir := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sockets := make(map[string]bool)
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil {
+			continue // The fd has been closed in the meantime.
+		}
+		if inode, ok := strings.CutPrefix(target, "socket:["); ok {
+			sockets[strings.TrimSuffix(inode, "]")] = true
+		}
+	}
+
+	var addrs []netip.AddrPort
+	for _, table := range []string{"tcp", "tcp6"} {
+		data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "net", table))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // IPv6 is disabled.
+			}
+			return nil, err
+		}
+		listening, err := parseListeningSockets(data, sockets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s socket table: %w", table, err)
+		}
+		addrs = append(addrs, listening...)
+	}
+
+	return addrs, nil
+}
+
+// parseListeningSockets parses a socket table in the format of /proc/net/tcp
+// and returns the local addresses of the listening sockets whose inodes are
+// contained in sockets.
+func parseListeningSockets(table []byte, sockets map[string]bool) ([]netip.AddrPort, error) {
+	const stateListen = "0A"
+
+	var addrs []netip.AddrPort
+	lines := bufio.NewScanner(bytes.NewReader(table))
+	lines.Scan() // skip header
+	for lines.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(lines.Text())
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("invalid line: %q", lines.Text())
+		}
+		if fields[3] != stateListen || !sockets[fields[9]] {
+			continue
+		}
+		addr, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, lines.Err()
+}
+
+// parseProcNetAddr parses an address in the format used by /proc/net/tcp,
+// i.e. a hex encoded IP address in host byte order, in 32 bit words, followed
+// by a colon and a hex encoded port.
+func parseProcNetAddr(s string) (netip.AddrPort, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid address: %q", s)
+	}
+	ip, err := hex.DecodeString(ipHex)
+	if err != nil || (len(ip) != 4 && len(ip) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("invalid address: %q", s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid address: %q", s)
+	}
+
+	for word := ip; len(word) > 0; word = word[4:] {
+		binary.BigEndian.PutUint32(word, binary.NativeEndian.Uint32(word))
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
+
+// recordCPUProfile records a CPU profile of the process with the given pid
+// using perf and converts it into pprof format.
+func recordCPUProfile(pid int, duration time.Duration, output io.Writer) error {
+	perf, err := exec.LookPath("perf")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNoProfiler, err)
+	}
+	perfToProfile, err := exec.LookPath("perf_to_profile")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNoProfiler, err)
+	}
+
+	dir, err := os.MkdirTemp("", "k0s-profile-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	perfData, profile := filepath.Join(dir, "perf.data"), filepath.Join(dir, "profile.pb.gz")
+	seconds := strconv.FormatFloat(duration.Seconds(), 'f', -1, 64)
+	if err := runCommand(perf, "record", "-g", "-p", strconv.Itoa(pid), "-o", perfData, "--", "sleep", seconds); err != nil {
+		return fmt.Errorf("failed to record CPU profile: %w", err)
+	}
+	if err := runCommand(perfToProfile, "-i", perfData, "-o", profile); err != nil {
+		return fmt.Errorf("failed to convert CPU profile: %w", err)
+	}
+
+	f, err := os.Open(profile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(output, f)
+	return err
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcNetAddr(t *testing.T) {
+	for _, test := range []struct{ in, out string }{
+		{"0100007F:1F90", "127.0.0.1:8080"},
+		{"00000000:0016", "0.0.0.0:22"},
+		{"00000000000000000000000001000000:1F90", "[::1]:8080"},
+		{"0000000000000000FFFF00000100007F:01BB", "127.0.0.1:443"},
+	} {
+		addr, err := parseProcNetAddr(test.in)
+		if assert.NoError(t, err, test.in) {
+			assert.Equal(t, test.out, addr.String(), test.in)
+		}
+	}
+
+	_, err := parseProcNetAddr("0100007F")
+	assert.ErrorContains(t, err, "invalid address")
+}
+
+func TestListeningTCPAddrs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	addrs, err := listeningTCPAddrs(os.Getpid())
+	require.NoError(t, err)
+	assert.Contains(t, addrs, netip.MustParseAddrPort(l.Addr().String()))
+}
+
+func TestProfile_Endpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("profile for " + r.URL.Query().Get("seconds") + "s"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	addrs, err := listeningTCPAddrs(os.Getpid())
+	require.NoError(t, err)
+	endpoint := findPprofEndpoint(addrs)
+	require.Equal(t, server.URL+"/debug/pprof/", endpoint)
+
+	var profile bytes.Buffer
+	require.NoError(t, fetchCPUProfile(endpoint, 3*time.Second, &profile))
+	assert.Equal(t, "profile for 3s", profile.String())
+
+	server.Close()
+	err = fetchCPUProfile(endpoint, 3*time.Second, &profile)
+	assert.ErrorContains(t, err, "failed to connect to pprof endpoint")
+	assert.NotErrorIs(t, err, ErrNoProfiler)
+}
+
+func TestProfile_NoProfiler(t *testing.T) {
+	sleep := selectCmd(t, cmd{"sleep", []string{"60"}})
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}
+
+	var profile bytes.Buffer
+	assert.ErrorIs(t, s.Profile(time.Second, &profile), ErrNotRunning)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	t.Setenv("PATH", t.TempDir())
+
+	assert.ErrorIs(t, s.Profile(time.Second, &profile), ErrNoProfiler)
+	assert.Zero(t, profile.Len())
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"io"
+	"net/netip"
+	"time"
+)
+
+func listeningTCPAddrs(int) ([]netip.AddrPort, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func recordCPUProfile(int, time.Duration, io.Writer) error {
+	return errors.ErrUnsupported
+}
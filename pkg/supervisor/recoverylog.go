@@ -0,0 +1,92 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import "time"
+
+// RecoveryEvent is a lifecycle event of a supervised process.
+type RecoveryEvent string
+
+const (
+	// The supervised process has been started for the first time.
+	RecoveryEventStarted RecoveryEvent = "started"
+	// The supervised process exited unexpectedly or couldn't be started.
+	RecoveryEventCrashed RecoveryEvent = "crashed"
+	// The supervised process has been stopped along with the supervisor.
+	RecoveryEventStopped RecoveryEvent = "stopped"
+	// The supervised process has been respawned.
+	RecoveryEventRestarted RecoveryEvent = "restarted"
+)
+
+// maxRecoveryLogEntries is the number of events a supervisor remembers.
+const maxRecoveryLogEntries = 100
+
+// RecoveryLogEntry records a lifecycle event of a supervised process.
+type RecoveryLogEntry struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Event     RecoveryEvent `json:"event"`
+	PID       int           `json:"pid,omitempty"`
+	// The exit code of crashed or stopped processes.
+	ExitCode int `json:"exitCode,omitempty"`
+	// Why crashed processes exited.
+	CrashReason CrashReason `json:"crashReason,omitempty"`
+	// How long crashed or stopped processes have been running.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// GetRecoveryLog returns the most recent lifecycle events of the supervised
+// process, oldest first.
+func (s *Supervisor) GetRecoveryLog() []RecoveryLogEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]RecoveryLogEntry(nil), s.recoveryLog...)
+}
+
+// recordStarted records that the supervised process has been started or,
+// if restarted is true, respawned.
+func (s *Supervisor) recordStarted(pid int, restarted bool) {
+	entry := RecoveryLogEntry{Timestamp: time.Now(), Event: RecoveryEventStarted, PID: pid}
+	if restarted {
+		entry.Event = RecoveryEventRestarted
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addRecoveryLogEntryLocked(entry)
+}
+
+// recordStopped records that the supervised process has been stopped.
+func (s *Supervisor) recordStopped() {
+	entry := RecoveryLogEntry{Timestamp: time.Now(), Event: RecoveryEventStopped}
+	if state := s.cmd.ProcessState; state != nil {
+		entry.PID, entry.ExitCode = state.Pid(), state.ExitCode()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry.Duration = entry.Timestamp.Sub(s.startedAt)
+	s.addRecoveryLogEntryLocked(entry)
+}
+
+// addRecoveryLogEntryLocked appends entry to the recovery log, discarding the
+// oldest entries as needed. The caller needs to hold s.mutex.
+func (s *Supervisor) addRecoveryLogEntryLocked(entry RecoveryLogEntry) {
+	s.recoveryLog = append(s.recoveryLog, entry)
+	if len(s.recoveryLog) > maxRecoveryLogEntries {
+		s.recoveryLog = s.recoveryLog[len(s.recoveryLog)-maxRecoveryLogEntries:]
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryLog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Requires a POSIX shell")
+	}
+
+	// Crashes on the first run, keeps running on the second one.
+	marker := filepath.Join(t.TempDir(), "crashed")
+	sh := selectCmd(t, cmd{binPath: "sh"})
+	pids := make(chan int, 2)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           []string{"-c", `[ -f "$0" ] && exec sleep 60; touch "$0"; exit 3`, marker},
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: time.Millisecond,
+		OnStart:        func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	first, second := <-pids, <-pids
+	require.NoError(t, s.Stop())
+
+	log := s.GetRecoveryLog()
+	require.Len(t, log, 4)
+
+	assert.Equal(t, RecoveryEventStarted, log[0].Event)
+	assert.Equal(t, first, log[0].PID)
+
+	assert.Equal(t, RecoveryEventCrashed, log[1].Event)
+	assert.Equal(t, first, log[1].PID)
+	assert.Equal(t, 3, log[1].ExitCode)
+	assert.Equal(t, CrashReasonUnknown, log[1].CrashReason)
+	assert.Positive(t, log[1].Duration)
+
+	assert.Equal(t, RecoveryEventRestarted, log[2].Event)
+	assert.Equal(t, second, log[2].PID)
+
+	assert.Equal(t, RecoveryEventStopped, log[3].Event)
+	assert.Equal(t, second, log[3].PID)
+	assert.Positive(t, log[3].Duration)
+
+	for i := 1; i < len(log); i++ {
+		assert.False(t, log[i].Timestamp.Before(log[i-1].Timestamp), "Entry %d is out of order", i)
+	}
+
+	log[0].PID = -1
+	assert.Equal(t, first, s.GetRecoveryLog()[0].PID, "Should return a copy")
+}
+
+func TestRecoveryLog_Capacity(t *testing.T) {
+	var s Supervisor
+	for i := range maxRecoveryLogEntries + 10 {
+		s.addRecoveryLogEntryLocked(RecoveryLogEntry{PID: i})
+	}
+
+	log := s.GetRecoveryLog()
+	require.Len(t, log, maxRecoveryLogEntries)
+	assert.Equal(t, 10, log[0].PID)
+	assert.Equal(t, maxRecoveryLogEntries+9, log[len(log)-1].PID)
+}
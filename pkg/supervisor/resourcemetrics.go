@@ -0,0 +1,97 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ResourceMetricsSpec configures the Prometheus histograms that record the
+// resource usage of a supervised process over time.
+type ResourceMetricsSpec struct {
+	// The registerer with which the supervisor_cpu_usage_percent and
+	// supervisor_memory_rss_bytes histograms are registered. The histograms
+	// are shared between all supervisors using the same registerer, labeled
+	// by component. Resource metrics are disabled if nil.
+	MetricsRegisterer prometheus.Registerer `json:"-"`
+	// The interval in which the resource usage is sampled. Defaults to ten
+	// seconds.
+	PollInterval time.Duration `json:"pollInterval,omitempty"`
+}
+
+// startResourceMetrics samples the resource usage of the process with the
+// given PID into the resource metrics histograms until ctx is done or stop is
+// called. The component's previous samples are discarded, so that the
+// histograms only reflect the current run of the process.
+func (s *Supervisor) startResourceMetrics(ctx context.Context, pid int) (stop func()) {
+	reg := s.ResourceMetrics.MetricsRegisterer
+	if reg == nil {
+		return func() {}
+	}
+
+	cpu, err := registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "supervisor",
+		Name:      "cpu_usage_percent",
+		Help:      "CPU usage of a supervised process, in percent of a single CPU.",
+		Buckets:   []float64{1, 5, 10, 25, 50, 75, 100, 200, 400, 800},
+	}, []string{"component"}))
+	if err != nil {
+		s.log.WithError(err).Warn("Not recording resource metrics")
+		return func() {}
+	}
+	memory, err := registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "supervisor",
+		Name:      "memory_rss_bytes",
+		Help:      "Resident set size of a supervised process.",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 16),
+	}, []string{"component"}))
+	if err != nil {
+		s.log.WithError(err).Warn("Not recording resource metrics")
+		return func() {}
+	}
+	cpu.DeleteLabelValues(s.Name)
+	memory.DeleteLabelValues(s.Name)
+	cpuSamples, memorySamples := cpu.WithLabelValues(s.Name), memory.WithLabelValues(s.Name)
+
+	return runInBackground(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(s.ResourceMetrics.PollInterval)
+		defer ticker.Stop()
+
+		var prev ResourceUsage
+		var prevTime time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				usage, err := processResourceUsage(pid)
+				if err != nil {
+					s.log.WithError(err).Debugf("Failed to sample resource usage of pid %d", pid)
+					continue
+				}
+				memorySamples.Observe(float64(usage.MemoryBytes))
+				if !prevTime.IsZero() {
+					cpuSamples.Observe(100 * float64(usage.CPUTime-prev.CPUTime) / float64(now.Sub(prevTime)))
+				}
+				prev, prevTime = usage, now
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: selectCmd(t, cmd{"sleep", []string{"60"}}).binPath,
+		Args:    []string{"60"},
+		RunDir:  t.TempDir(),
+		ResourceMetrics: ResourceMetricsSpec{
+			MetricsRegisterer: reg,
+			PollInterval:      10 * time.Millisecond,
+		},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	samples := func(name string) uint64 {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() != name {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "component" && label.GetValue() == t.Name() {
+						return metric.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+		return 0
+	}
+
+	assert.Eventually(t, func() bool {
+		return samples("supervisor_memory_rss_bytes") >= 10 && samples("supervisor_cpu_usage_percent") >= 9
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// Restarting resets the histograms.
+	require.NoError(t, s.Stop())
+	assert.GreaterOrEqual(t, samples("supervisor_memory_rss_bytes"), uint64(10), "Stopping reset the histograms")
+	require.NoError(t, s.Supervise())
+	assert.Eventually(t, func() bool {
+		return samples("supervisor_memory_rss_bytes") < 10
+	}, 10*time.Second, 10*time.Millisecond)
+}
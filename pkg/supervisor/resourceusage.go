@@ -0,0 +1,37 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import "time"
+
+// ResourceUsage describes the resources consumed by a supervised process.
+type ResourceUsage struct {
+	// The CPU time the process has spent in user and system mode.
+	CPUTime time.Duration `json:"cpuTime"`
+	// The resident set size of the process, in bytes.
+	MemoryBytes uint64 `json:"memoryBytes"`
+}
+
+// GetResourceUsage returns the current resource usage of the supervised
+// process.
+func (s *Supervisor) GetResourceUsage() (ResourceUsage, error) {
+	pid := s.Snapshot().PID
+	if pid == 0 {
+		return ResourceUsage{}, s.errNotRunning()
+	}
+	return processResourceUsage(pid)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The kernel reports CPU times in clock ticks, whose frequency (USER_HZ) is 100
+// on all architectures.
+const clockTicksPerSecond = 100
+
+// processResourceUsage reads the resource usage of a process from
+// /proc/<pid>/stat, see proc(5).
+func processResourceUsage(pid int) (ResourceUsage, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+
+	// The command name may contain spaces and parentheses. Hence, the fields
+	// following it are located after the last closing parenthesis, starting
+	// with the third field.
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return ResourceUsage{}, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	fields := bytes.Fields(stat[end+1:])
+	field := func(n int) (uint64, error) {
+		if i := n - 3; i < len(fields) {
+			return strconv.ParseUint(string(fields[i]), 10, 64)
+		}
+		return 0, fmt.Errorf("stat of pid %d has no field %d", pid, n)
+	}
+
+	utime, err := field(14)
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	stime, err := field(15)
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	rss, err := field(24)
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+
+	return ResourceUsage{
+		CPUTime:     time.Duration(utime+stime) * time.Second / clockTicksPerSecond,
+		MemoryBytes: rss * uint64(os.Getpagesize()),
+	}, nil
+}
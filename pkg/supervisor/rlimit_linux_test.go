@@ -0,0 +1,46 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFilesLimit(t *testing.T) {
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:         t.TempDir(),
+		Args:           []string{"-c", "exec sleep 10"},
+		OpenFilesLimit: 512,
+		OnStart:        func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	limits, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`(?m)^Max open files\s+512\s+512\s+files\s*$`), string(limits))
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The sandboxes in which supervised processes can be run.
+const (
+	// Runs the supervised process inside a gVisor sandbox via runsc.
+	SandboxGVisor = "gvisor"
+)
+
+func (s *Supervisor) validateSandbox() error {
+	switch s.Sandbox {
+	case "":
+		return nil
+	case SandboxGVisor:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("sandboxes are not supported on %s", runtime.GOOS)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported sandbox: %q", s.Sandbox)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// wrapInGVisor rewrites cmd, so that it's executed via "runsc do" inside a
+// gVisor sandbox. As runsc needs to run as root, the credentials of cmd, if
+// any, are translated into user and group ID mappings, so that the process
+// becomes root inside the sandbox, but acts as the given user on the host.
+func wrapInGVisor(cmd *exec.Cmd, runsc string) error {
+	if runsc == "" {
+		runsc = "runsc"
+	}
+	runscPath, err := exec.LookPath(runsc)
+	if err != nil {
+		return fmt.Errorf("failed to find gVisor runtime: %w", err)
+	}
+
+	args := []string{runscPath, "--rootless=false", "do"}
+	if cmd.Dir != "" {
+		args = append(args, "--cwd="+cmd.Dir)
+	}
+	if attr := cmd.SysProcAttr; attr != nil && attr.Credential != nil {
+		args = append(args,
+			fmt.Sprintf("--uid-map=0 %d 1", attr.Credential.Uid),
+			fmt.Sprintf("--gid-map=0 %d 1", attr.Credential.Gid),
+		)
+		attr.Credential = nil
+	}
+	args = append(args, "--", cmd.Path)
+	args = append(args, cmd.Args[1:]...)
+
+	cmd.Path, cmd.Args = runscPath, args
+	return nil
+}
+
+// isGVisorCmdline returns whether cmdline is the one of a sandbox that has been
+// set up by wrapInGVisor to run binPath. The sandbox's runsc process is the
+// one whose PID is written to the PID file.
+func isGVisorCmdline(cmdline []string, runsc, binPath string) bool {
+	if runsc == "" {
+		runsc = "runsc"
+	}
+	if path, err := exec.LookPath(runsc); err != nil || cmdline[0] != path {
+		return false
+	}
+	if path, err := exec.LookPath(binPath); err == nil {
+		binPath = path
+	}
+
+	for i, arg := range cmdline {
+		if arg == "--" {
+			return i+1 < len(cmdline) && cmdline[i+1] == binPath
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandbox_GVisor(t *testing.T) {
+	// A fake runsc that records its args and runs the sandboxed command.
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	runsc := filepath.Join(dir, "runsc")
+	require.NoError(t, os.WriteFile(runsc, []byte(`#!/bin/sh
+printf '%s\n' "$@" >"`+argsFile+`.tmp"
+mv "`+argsFile+`.tmp" "`+argsFile+`"
+while [ "$1" != -- ]; do shift; done
+shift
+exec "$@"
+`), 0700))
+
+	sh := selectCmd(t, cmd{binPath: "sh"}).binPath
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh,
+		RunDir:         t.TempDir(),
+		DataDir:        t.TempDir(),
+		Args:           []string{"-c", "exec sleep 10"},
+		TimeoutRespawn: 1 * time.Hour,
+		Sandbox:        SandboxGVisor,
+		SandboxBinary:  runsc,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var args []byte
+	require.Eventually(t, func() bool {
+		var err error
+		args, err = os.ReadFile(argsFile)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	expected := []string{"--rootless=false", "do", "--cwd=" + s.DataDir}
+	if os.Geteuid() == 0 {
+		expected = append(expected, "--uid-map=0 0 1", "--gid-map=0 0 1")
+	}
+	expected = append(expected, "--", sh, "-c", "exec sleep 10")
+	assert.Equal(t, expected, strings.Split(strings.TrimSuffix(string(args), "\n"), "\n"))
+	assert.Equal(t, ProcessStateRunning, s.Snapshot().State)
+}
+
+func TestSandbox_Invalid(t *testing.T) {
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: "true",
+		RunDir:  t.TempDir(),
+		Sandbox: "kata",
+	}
+	assert.ErrorContains(t, s.Supervise(), `unsupported sandbox: "kata"`)
+}
+
+func TestSandbox_GVisorCleanupPIDFile(t *testing.T) {
+	dir := t.TempDir()
+	runsc := filepath.Join(dir, "runsc")
+	require.NoError(t, os.WriteFile(runsc, nil, 0700))
+	sh := selectCmd(t, cmd{binPath: "sh"}).binPath
+
+	// Start some k0s-managed process that looks like a sandboxed one. The
+	// trailing no-op prevents the shell from replacing itself with sleep.
+	prevCmd := exec.Command(sh, "-c", "sleep 60; :", "--", sh)
+	prevCmd.Args[0] = runsc
+	prevCmd.Env = append(os.Environ(), k0sManaged)
+	require.NoError(t, prevCmd.Start())
+	t.Cleanup(func() { _ = prevCmd.Process.Kill() })
+
+	s := Supervisor{
+		Name:          t.Name(),
+		BinPath:       sh,
+		RunDir:        t.TempDir(),
+		Sandbox:       SandboxGVisor,
+		SandboxBinary: runsc,
+		TimeoutStop:   1 * time.Second,
+	}
+	s.PidFile = filepath.Join(s.RunDir, s.Name+".pid")
+	require.NoError(t, os.WriteFile(s.PidFile, []byte(strconv.Itoa(prevCmd.Process.Pid)+"\n"), 0644))
+
+	// Expect the previous process to be recognized and terminated.
+	require.NoError(t, s.maybeKillPidFile())
+	assert.ErrorContains(t, prevCmd.Wait(), "signal: terminated")
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errInvalidSignature is returned if a binary has no valid signature.
+var errInvalidSignature = errors.New("invalid signature")
+
+// validateBinarySignature parses the RSA public key from SigningCert.
+func (s *Supervisor) validateBinarySignature() error {
+	if !s.RequireBinarySignature {
+		return nil
+	}
+
+	block, _ := pem.Decode([]byte(s.SigningCert))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return errors.New("signing certificate is not a PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid signing certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("signing certificate has no RSA public key, but %s", cert.PublicKeyAlgorithm)
+	}
+
+	s.signingKey = key
+	return nil
+}
+
+// verifySignature checks that the detached signature in <path>.sig is a valid
+// signature of the SHA-256 hash of the file at path.
+func verifySignature(path string, key *rsa.PublicKey) error {
+	signature, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSignature, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to compute hash of %s: %w", path, err)
+	}
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h.Sum(nil), signature); err != nil {
+		return fmt.Errorf("%w: %s: %w", errInvalidSignature, path, err)
+	}
+	return nil
+}
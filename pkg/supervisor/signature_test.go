@@ -0,0 +1,134 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "bin")
+	require.NoError(t, os.WriteFile(path, []byte("binary"), 0600))
+
+	err = verifySignature(path, &key.PublicKey)
+	assert.ErrorIs(t, err, errInvalidSignature)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	signFile(t, key, path)
+	assert.NoError(t, verifySignature(path, &key.PublicKey))
+
+	require.NoError(t, os.WriteFile(path, []byte("tampered"), 0600))
+	assert.ErrorIs(t, verifySignature(path, &key.PublicKey), errInvalidSignature)
+}
+
+func TestRequireBinarySignature(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test binary is a shell script")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert := selfSignedCert(t, key)
+
+	bin := filepath.Join(t.TempDir(), "bin")
+	require.NoError(t, os.WriteFile(bin, []byte("#!/bin/sh\nexec sleep 60\n"), 0700))
+
+	t.Run("valid", func(t *testing.T) {
+		signFile(t, key, bin)
+		t.Cleanup(func() { require.NoError(t, os.Remove(bin+".sig")) })
+
+		s := Supervisor{
+			Name:                   t.Name(),
+			BinPath:                bin,
+			RunDir:                 t.TempDir(),
+			RequireBinarySignature: true,
+			SigningCert:            cert,
+		}
+		require.NoError(t, s.Supervise())
+		assert.NoError(t, s.Stop())
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		crashes := make(chan CrashInfo, 1)
+		s := Supervisor{
+			Name:                   t.Name(),
+			BinPath:                bin,
+			RunDir:                 t.TempDir(),
+			RequireBinarySignature: true,
+			SigningCert:            cert,
+			OnCrash:                func(info CrashInfo) { crashes <- info },
+		}
+		assert.ErrorIs(t, s.Supervise(), errInvalidSignature)
+		assert.Equal(t, CrashReasonInvalidSignature, (<-crashes).Reason)
+	})
+
+	t.Run("invalid_cert", func(t *testing.T) {
+		s := Supervisor{
+			Name:                   t.Name(),
+			BinPath:                bin,
+			RunDir:                 t.TempDir(),
+			RequireBinarySignature: true,
+		}
+		assert.ErrorContains(t, s.Supervise(), "signing certificate is not a PEM encoded certificate")
+
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		s.SigningCert = selfSignedCert(t, ecKey)
+		assert.ErrorContains(t, s.Supervise(), "signing certificate has no RSA public key, but ECDSA")
+	})
+}
+
+func signFile(t *testing.T, key *rsa.PrivateKey, path string) {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	hash := sha256.Sum256(content)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path+".sig", signature, 0600))
+}
+
+func selfSignedCert(t *testing.T, key crypto.Signer) string {
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: t.Name()},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
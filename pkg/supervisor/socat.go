@@ -0,0 +1,90 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+)
+
+func (s *Supervisor) validateSocatProxy() error {
+	if len(s.SocatProxy) == 0 {
+		return nil
+	}
+	for local, remote := range s.SocatProxy {
+		for _, port := range []int{local, remote} {
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("port %d out of range [1, 65535]", port)
+			}
+		}
+	}
+	if _, err := exec.LookPath("socat"); err != nil {
+		return fmt.Errorf("socat is required to forward ports: %w", err)
+	}
+	return nil
+}
+
+// startSocatProxies starts a socat sidecar for each port in s.SocatProxy.
+func (s *Supervisor) startSocatProxies() error {
+	socat, err := exec.LookPath("socat")
+	if err != nil {
+		return err
+	}
+
+	localPorts := make([]int, 0, len(s.SocatProxy))
+	for local := range s.SocatProxy {
+		localPorts = append(localPorts, local)
+	}
+	slices.Sort(localPorts)
+
+	for _, local := range localPorts {
+		sidecar := &Supervisor{
+			Name:    s.Name + "-socat-" + strconv.Itoa(local),
+			BinPath: socat,
+			RunDir:  s.RunDir,
+			DataDir: s.DataDir,
+			Args: []string{
+				fmt.Sprintf("TCP-LISTEN:%d,fork,reuseaddr", local),
+				fmt.Sprintf("TCP:127.0.0.1:%d", s.SocatProxy[local]),
+			},
+			UID:            s.UID,
+			GID:            s.GID,
+			TimeoutStop:    s.TimeoutStop,
+			TimeoutRespawn: s.TimeoutRespawn,
+			DisableLogging: s.DisableLogging,
+		}
+		if err := sidecar.Supervise(); err != nil {
+			return fmt.Errorf("failed to forward port %d: %w", local, err)
+		}
+		s.sidecars = append(s.sidecars, sidecar)
+	}
+
+	return nil
+}
+
+// stopSidecars stops all sidecars in reverse order.
+func (s *Supervisor) stopSidecars() {
+	for i := len(s.sidecars) - 1; i >= 0; i-- {
+		sidecar := s.sidecars[i]
+		if err := sidecar.Stop(); err != nil {
+			s.log.WithError(err).Warnf("Failed to stop %s", sidecar.Name)
+		}
+	}
+	s.sidecars = nil
+}
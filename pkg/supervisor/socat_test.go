@@ -0,0 +1,92 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocatProxy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake socat requires a POSIX shell")
+	}
+
+	// A fake socat that records its args.
+	binDir, argsDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "socat"), []byte(`#!/bin/sh
+printf '%s\n' "$@" >"`+argsDir+`/$1.tmp"
+mv "`+argsDir+`/$1.tmp" "`+argsDir+`/$1"
+exec sleep 100
+`), 0700))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:       t.Name(),
+		BinPath:    pingPong.BinPath(),
+		RunDir:     t.TempDir(),
+		Args:       pingPong.BinArgs(),
+		SocatProxy: map[int]int{8080: 80, 6443: 443},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	for local, expected := range map[string][]string{
+		"TCP-LISTEN:8080,fork,reuseaddr": {"TCP-LISTEN:8080,fork,reuseaddr", "TCP:127.0.0.1:80"},
+		"TCP-LISTEN:6443,fork,reuseaddr": {"TCP-LISTEN:6443,fork,reuseaddr", "TCP:127.0.0.1:443"},
+	} {
+		var args []byte
+		require.Eventually(t, func() bool {
+			var err error
+			args, err = os.ReadFile(filepath.Join(argsDir, local))
+			return err == nil
+		}, 10*time.Second, 10*time.Millisecond)
+		assert.Equal(t, expected, strings.Fields(string(args)))
+	}
+
+	sidecars := s.sidecars
+	require.Len(t, sidecars, 2)
+	require.NoError(t, s.Stop())
+	for _, sidecar := range sidecars {
+		assert.Equal(t, ProcessStateStopped, sidecar.Snapshot().State)
+	}
+	assert.Nil(t, s.sidecars)
+}
+
+func TestSocatProxy_Invalid(t *testing.T) {
+	s := Supervisor{
+		Name:       t.Name(),
+		BinPath:    "true",
+		RunDir:     t.TempDir(),
+		SocatProxy: map[int]int{8080: 0},
+	}
+	assert.ErrorContains(t, s.Supervise(), "port 0 out of range")
+
+	t.Setenv("PATH", t.TempDir())
+	s.SocatProxy = map[int]int{8080: 80}
+	assert.ErrorContains(t, s.Supervise(), "socat is required to forward ports")
+}
@@ -0,0 +1,107 @@
+//go:build unix
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// The first file descriptor passed via socket activation.
+const listenFDsStart = 3
+
+// activatedSocket is a file descriptor passed via systemd socket activation.
+type activatedSocket struct {
+	fd   int
+	name string
+}
+
+// parseActivatedSockets parses the socket activation environment variables,
+// as described in sd_listen_fds(3).
+func parseActivatedSockets(getenv func(string) string, pid int) []activatedSocket {
+	if listenPID, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || listenPID != pid {
+		return nil
+	}
+	listenFDs, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || listenFDs < 1 {
+		return nil
+	}
+
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	sockets := make([]activatedSocket, listenFDs)
+	for i := range sockets {
+		sockets[i].fd = listenFDsStart + i
+		if i < len(names) {
+			sockets[i].name = names[i]
+		}
+	}
+	return sockets
+}
+
+type activatedFile struct {
+	name string
+	file *os.File
+}
+
+// activatedFiles returns the files passed to k0s via socket activation. They
+// are kept open for the lifetime of k0s, so that they can be passed on to
+// every restarted process. It's a variable, so that tests can replace it.
+var activatedFiles = sync.OnceValue(func() []activatedFile {
+	var files []activatedFile
+	for _, socket := range parseActivatedSockets(os.Getenv, os.Getpid()) {
+		// Don't leak the sockets into processes they're not meant for.
+		syscall.CloseOnExec(socket.fd)
+		files = append(files, activatedFile{socket.name, os.NewFile(uintptr(socket.fd), socket.name)})
+	}
+	return files
+})
+
+// passActivatedSockets passes the sockets that systemd passed to k0s for the
+// supervised component on to cmd. Sockets are assigned to components by their
+// name, i.e. the FileDescriptorName of the socket unit needs to match the
+// supervisor's name.
+//
+// The socket activation protocol requires LISTEN_PID to be the PID of the
+// process that receives the sockets, which is unknown before the process is
+// started. Hence, the process is started via a shell that sets LISTEN_PID to
+// its own PID and then replaces itself with the actual binary.
+func (s *Supervisor) passActivatedSockets(cmd *exec.Cmd) {
+	var names []string
+	for _, f := range activatedFiles() {
+		if f.name == s.Name {
+			cmd.ExtraFiles = append(cmd.ExtraFiles, f.file)
+			names = append(names, f.name)
+		}
+	}
+	if len(names) == 0 {
+		s.log.Warn("No sockets have been passed via socket activation")
+		return
+	}
+
+	cmd.Env = mergeEnv(cmd.Env, []string{
+		"LISTEN_FDS=" + strconv.Itoa(len(names)),
+		"LISTEN_FDNAMES=" + strings.Join(names, ":"),
+	})
+	cmd.Args = append([]string{"/bin/sh", "-c", `LISTEN_PID=$$ exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
@@ -0,0 +1,95 @@
+//go:build unix
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseActivatedSockets(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+
+	assert.Equal(t, []activatedSocket{
+		{3, "etcd"}, {4, "kube-apiserver"}, {5, ""},
+	}, parseActivatedSockets(env(map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "3",
+		"LISTEN_FDNAMES": "etcd:kube-apiserver",
+	}), 42))
+
+	assert.Empty(t, parseActivatedSockets(env(map[string]string{
+		"LISTEN_PID": "43",
+		"LISTEN_FDS": "1",
+	}), 42), "Sockets are meant for another process")
+	assert.Empty(t, parseActivatedSockets(env(map[string]string{
+		"LISTEN_FDS": "1",
+	}), 42), "LISTEN_PID is required")
+	assert.Empty(t, parseActivatedSockets(env(map[string]string{
+		"LISTEN_PID": "42",
+		"LISTEN_FDS": "0",
+	}), 42))
+}
+
+func TestPassActivatedSockets(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, r.Close()) })
+	t.Cleanup(func() { _ = w.Close() })
+
+	oldActivatedFiles := activatedFiles
+	t.Cleanup(func() { activatedFiles = oldActivatedFiles })
+	activatedFiles = func() []activatedFile {
+		return []activatedFile{
+			{"other", os.Stdin},
+			{t.Name(), w},
+		}
+	}
+
+	log, _ := logtest.NewNullLogger()
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: "/bin/sh",
+		DataDir: t.TempDir(),
+		log:     log.WithField("component", t.Name()),
+	}
+	cmd, err := s.newCmd(context.TODO(), []string{"-c", `echo "$LISTEN_PID $$ $LISTEN_FDS $LISTEN_FDNAMES" && echo activated >&3`})
+	require.NoError(t, err)
+	s.passActivatedSockets(cmd)
+
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	pid := strconv.Itoa(cmd.ProcessState.Pid())
+	assert.Equal(t, pid+" "+pid+" 1 "+t.Name(), strings.TrimSpace(string(out)))
+
+	require.NoError(t, w.Close())
+	activated, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "activated\n", string(activated))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	stackDumpTimeout = 5 * time.Second
+	// The interval in which the output of a process is checked for stack dumps.
+	stackDumpPollInterval = 100 * time.Millisecond
+)
+
+// DumpStack asks the supervised process to dump the stacks of its goroutines
+// by sending it SIGQUIT, and returns its output from then on, once it
+// contains a goroutine dump. Intended for debugging deadlocked Go processes.
+// Note that Go processes exit after dumping their stacks, unless they handle
+// SIGQUIT on their own, and are respawned as usual. As only the most recent
+// output lines of a process are retained, long dumps are truncated. Not
+// supported on Windows.
+func (s *Supervisor) DumpStack() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", errors.New("stack dumps are not supported on windows")
+	}
+	if s.DisableLogging || s.SyslogIdentifier != "" {
+		return "", errors.New("the output of the process isn't captured")
+	}
+
+	s.mutex.Lock()
+	var process *os.Process
+	if s.state.hasProcess() && s.cmd != nil {
+		process = s.cmd.Process
+	}
+	output := s.output
+	s.mutex.Unlock()
+	if process == nil {
+		return "", s.errNotRunning()
+	}
+
+	mark := output.count()
+	if err := process.Signal(syscall.SIGQUIT); err != nil {
+		return "", fmt.Errorf("failed to send SIGQUIT to pid %d: %w", process.Pid, err)
+	}
+	s.log.Infof("Sent SIGQUIT to pid %d to dump its stacks", process.Pid)
+
+	ticker := time.NewTicker(stackDumpPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(stackDumpTimeout)
+
+	var lines []string
+	var total uint64
+	for {
+		select {
+		case <-ticker.C:
+			prevTotal := total
+			lines, total = output.linesSince(mark)
+			// Wait for the dump to be complete, i.e. the output to settle.
+			if total == prevTotal && containsGoroutineDump(lines) {
+				return strings.Join(lines, "\n"), nil
+			}
+		case <-timeout:
+			if containsGoroutineDump(lines) {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", fmt.Errorf("pid %d didn't dump its stacks within %s", process.Pid, stackDumpTimeout)
+		}
+	}
+}
+
+func containsGoroutineDump(lines []string) bool {
+	return slices.ContainsFunc(lines, func(line string) bool {
+		return strings.HasPrefix(line, "goroutine 1 [")
+	})
+}
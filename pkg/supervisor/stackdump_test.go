@@ -0,0 +1,59 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpStack(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Stack dumps are not supported on Windows")
+	}
+
+	// A process that mimics a Go process which handles SIGQUIT.
+	sh := selectCmd(t, cmd{binPath: "sh"})
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sh.binPath,
+		RunDir:  t.TempDir(),
+		Args: []string{"-c", `
+trap 'printf "SIGQUIT: quit\n\ngoroutine 1 [running]:\nmain.main()\n" >&2' QUIT
+echo ready
+while :; do sleep 0.01; done
+`},
+	}
+
+	_, err := s.DumpStack()
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	require.Eventually(t, func() bool {
+		return slices.Contains(s.output.snapshot(), "ready")
+	}, 10*time.Second, 10*time.Millisecond)
+
+	dump, err := s.DumpStack()
+	require.NoError(t, err)
+	assert.Equal(t, "SIGQUIT: quit\n\ngoroutine 1 [running]:\nmain.main()", dump)
+}
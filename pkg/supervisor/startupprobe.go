@@ -0,0 +1,185 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// portPollInterval is the interval in which WaitUntilPort tries to connect.
+var portPollInterval = 500 * time.Millisecond
+
+// Ready returns a channel that's closed once the supervised process has been
+// started and passed its StartupProbe, if any. Once the process exits, a new
+// channel is returned for the next process.
+func (s *Supervisor) Ready() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ready == nil {
+		s.ready = make(chan struct{})
+	}
+	return s.ready
+}
+
+// markReady closes the channel returned by Ready.
+func (s *Supervisor) markReady() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ready == nil {
+		s.ready = make(chan struct{})
+	}
+	if !s.isReady {
+		close(s.ready)
+		s.isReady = true
+	}
+}
+
+// markUnready lets Ready return a new channel, if the current one is closed.
+func (s *Supervisor) markUnready() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isReady {
+		s.ready, s.isReady = nil, false
+	}
+}
+
+// probeStartup starts to poll StartupProbe for the given process in the
+// background. The returned function stops polling and waits until the probing
+// goroutine is done. The process is ready right away if there's no probe.
+func (s *Supervisor) probeStartup(ctx context.Context, process *os.Process) (stop func()) {
+	if s.StartupProbe == nil {
+		s.markReady()
+		return func() {}
+	}
+	return runInBackground(ctx, func(ctx context.Context) { s.pollStartupProbe(ctx, process) })
+}
+
+// watchSlowStart logs a warning if the process with the given PID isn't ready
+// within SlowStartThreshold, and an error after twice that time. The returned
+// function stops watching and waits until the watching goroutine is done.
+func (s *Supervisor) watchSlowStart(ctx context.Context, pid int) (stop func()) {
+	threshold := s.SlowStartThreshold
+	if threshold <= 0 {
+		return func() {}
+	}
+
+	startedAt, ready := time.Now(), s.Ready()
+	return runInBackground(ctx, func(ctx context.Context) {
+		warn := time.NewTimer(threshold)
+		defer warn.Stop()
+		escalate := time.NewTimer(2 * threshold)
+		defer escalate.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+				return
+			case <-warn.C:
+				s.log.Warnf("Pid %d isn't ready after %s", pid, time.Since(startedAt).Truncate(time.Millisecond))
+			case <-escalate.C:
+				s.log.Errorf("Pid %d still isn't ready after %s", pid, time.Since(startedAt).Truncate(time.Millisecond))
+				return
+			}
+		}
+	})
+}
+
+// pollStartupProbe polls StartupProbe until it succeeds. Kills the process if
+// it doesn't succeed within StartupProbeTimeout.
+func (s *Supervisor) pollStartupProbe(ctx context.Context, process *os.Process) {
+	ctx, cancel := context.WithTimeout(ctx, s.StartupProbeTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(s.StartupProbeInterval)
+	defer ticker.Stop()
+
+	var err error
+	for {
+		if err = s.StartupProbe(ctx); err == nil {
+			s.log.Infof("Startup probe for pid %d succeeded", process.Pid)
+			s.markReady()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.killUnstarted(process, err)
+			}
+			return
+		case <-ticker.C:
+			s.log.WithError(err).Debugf("Startup probe for pid %d failed", process.Pid)
+		}
+	}
+}
+
+// killUnstarted kills the given process, as its startup probe didn't succeed
+// in time.
+func (s *Supervisor) killUnstarted(process *os.Process, probeErr error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cmd == nil || s.cmd.Process != process {
+		return // The process has already been respawned.
+	}
+
+	log := s.log.WithError(probeErr)
+	if err := process.Kill(); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return
+		}
+		log.Warnf("Failed to kill pid %d, whose startup probe didn't succeed within %s: %v", process.Pid, s.StartupProbeTimeout, err)
+		return
+	}
+	log.Errorf("Killed pid %d, as its startup probe didn't succeed within %s", process.Pid, s.StartupProbeTimeout)
+	s.stopReason = CrashReasonStartupTimeout
+}
+
+// WaitUntilPort blocks until a TCP connection to the given port on localhost
+// can be established, or until ctx is done. It's meant for components that
+// are ready as soon as they listen, and can be used as their StartupProbe:
+//
+//	s.StartupProbe = func(ctx context.Context) error {
+//		return s.WaitUntilPort(ctx, 6443)
+//	}
+func (s *Supervisor) WaitUntilPort(ctx context.Context, port int) error {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	ticker := time.NewTicker(portPollInterval)
+	defer ticker.Stop()
+
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			return conn.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s is not listening on port %d: %w", s.Name, port, errors.Join(ctx.Err(), err))
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupProbe(t *testing.T) {
+	pingPong := pingpong.New(t)
+	var probes atomic.Int32
+	crashes := make(chan CrashInfo, 1)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+		StartupProbe: func(context.Context) error {
+			if probes.Add(1) < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		},
+		StartupProbeTimeout:  10 * time.Second,
+		StartupProbeInterval: 10 * time.Millisecond,
+		OnCrash:              func(info CrashInfo) { crashes <- info },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	assert.Eventually(t, func() bool { return probes.Load() >= 3 }, 10*time.Second, 10*time.Millisecond)
+	require.NoError(t, pingPong.AwaitPing())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), probes.Load(), "Expected probing to stop after success")
+	select {
+	case info := <-crashes:
+		assert.Fail(t, "Unexpected crash", "%+v", info)
+	default:
+	}
+}
+
+func TestStartupProbe_Timeout(t *testing.T) {
+	pingPong := pingpong.New(t)
+	crashes := make(chan CrashInfo, 1)
+	pids := make(chan int, 2)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+		StartupProbe: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		StartupProbeTimeout: 100 * time.Millisecond,
+		TimeoutRespawn:      time.Millisecond,
+		OnStart:             func(pid int) { pids <- pid },
+		OnCrash: func(info CrashInfo) {
+			select {
+			case crashes <- info:
+			default:
+			}
+		},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	pid := <-pids
+	select {
+	case info := <-crashes:
+		assert.Equal(t, pid, info.PID)
+		assert.Equal(t, CrashReasonStartupTimeout, info.Reason)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Process hasn't been killed")
+	}
+
+	select {
+	case respawned := <-pids:
+		assert.NotEqual(t, pid, respawned)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "Process hasn't been respawned")
+	}
+}
+
+func TestStartupProbe_SlowStart(t *testing.T) {
+	hook := new(logtest.Hook)
+	std := logrus.StandardLogger()
+	oldHooks := std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	t.Cleanup(func() { std.ReplaceHooks(oldHooks) })
+
+	hasEntry := func(level logrus.Level) bool {
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == level && strings.Contains(entry.Message, "ready after") {
+				return true
+			}
+		}
+		return false
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	pingPong := pingpong.New(t)
+	metrics, err := WithPrometheusMetrics(reg)
+	require.NoError(t, err)
+	var passed atomic.Bool
+	s := (&Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+		StartupProbe: func(context.Context) error {
+			if !hasEntry(logrus.ErrorLevel) {
+				return errors.New("not yet")
+			}
+			passed.Store(true)
+			return nil
+		},
+		StartupProbeTimeout:  10 * time.Second,
+		StartupProbeInterval: 10 * time.Millisecond,
+		SlowStartThreshold:   50 * time.Millisecond,
+	}).Apply(metrics)
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	require.Eventually(t, passed.Load, 10*time.Second, 10*time.Millisecond)
+	assert.True(t, hasEntry(logrus.WarnLevel), "Expected a warning about the slow start")
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	if assert.Len(t, families, 2) { // starts and start duration
+		assert.Equal(t, "supervisor_start_duration_seconds", families[0].GetName())
+		if metrics := families[0].GetMetric(); assert.Len(t, metrics, 1) {
+			assert.GreaterOrEqual(t, metrics[0].GetGauge().GetValue(), 0.1)
+		}
+	}
+}
+
+func TestSlowStartThreshold_WithoutProbe(t *testing.T) {
+	hook := new(logtest.Hook)
+	std := logrus.StandardLogger()
+	oldHooks := std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	t.Cleanup(func() { std.ReplaceHooks(oldHooks) })
+
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+	s := Supervisor{
+		Name:               t.Name(),
+		BinPath:            sleep.binPath,
+		Args:               sleep.binArgs,
+		RunDir:             t.TempDir(),
+		SlowStartThreshold: 10 * time.Millisecond,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	// Without a startup probe, the process is ready right away.
+	<-s.Ready()
+	time.Sleep(50 * time.Millisecond)
+	for _, entry := range hook.AllEntries() {
+		assert.NotContains(t, entry.Message, "ready after")
+	}
+}
+
+func TestPostStart(t *testing.T) {
+	sh := selectCmd(t, cmd{binPath: "sh"})
+
+	var calls atomic.Int32
+	postStartPIDs := make(chan int, 3)
+	pids := make(chan int, 3)
+	crashes := make(chan CrashInfo, 3)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           []string{"-c", "exec sleep 60"},
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: time.Millisecond,
+		PostStart: func(pid int) error {
+			postStartPIDs <- pid
+			if calls.Add(1) == 2 {
+				return errors.New("not listening")
+			}
+			return nil
+		},
+		OnStart: func(pid int) { pids <- pid },
+		OnCrash: func(info CrashInfo) { crashes <- info },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	pid := <-pids
+	require.Equal(t, pid, <-postStartPIDs)
+	p, err := os.FindProcess(pid)
+	require.NoError(t, err)
+	require.NoError(t, p.Kill())
+
+	var failedPID int
+	select {
+	case failedPID = <-postStartPIDs:
+		assert.NotEqual(t, pid, failedPID)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Process hasn't been respawned")
+	}
+
+	// Skip the crash of the killed process.
+	<-crashes
+	select {
+	case info := <-crashes:
+		assert.Equal(t, failedPID, info.PID)
+		assert.Equal(t, CrashReasonPostStartFailed, info.Reason)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Process hasn't been killed")
+	}
+
+	select {
+	case respawned := <-pids:
+		assert.NotEqual(t, pid, respawned)
+		assert.NotEqual(t, failedPID, respawned, "OnStart called for failed process")
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Process hasn't been respawned")
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestPostStart_FirstStart(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	postStartErr := errors.New("not listening")
+	var onStartCalled atomic.Bool
+	s := Supervisor{
+		Name:      t.Name(),
+		BinPath:   sleep.binPath,
+		Args:      sleep.binArgs,
+		RunDir:    t.TempDir(),
+		PostStart: func(pid int) error { return postStartErr },
+		OnStart:   func(pid int) { onStartCalled.Store(true) },
+	}
+	assert.ErrorIs(t, s.Supervise(), postStartErr)
+	assert.False(t, onStartCalled.Load(), "OnStart called for failed process")
+	assert.NoFileExists(t, s.PidFile)
+	assert.ErrorIs(t, s.Stop(), ErrNotStarted)
+}
+
+func TestWaitUntilPort(t *testing.T) {
+	oldInterval := portPollInterval
+	portPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { portPollInterval = oldInterval })
+
+	// Reserve a free port and release it again.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	s := Supervisor{Name: t.Name()}
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		err := s.WaitUntilPort(ctx, port)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "is not listening on port")
+	})
+
+	t.Run("listening", func(t *testing.T) {
+		listening := make(chan net.Listener, 1)
+		time.AfterFunc(50*time.Millisecond, func() {
+			l, err := net.Listen("tcp", l.Addr().String())
+			if assert.NoError(t, err) {
+				listening <- l
+			} else {
+				close(listening)
+			}
+		})
+		t.Cleanup(func() {
+			if l, ok := <-listening; ok {
+				assert.NoError(t, l.Close())
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+		defer cancel()
+		assert.NoError(t, s.WaitUntilPort(ctx, port))
+	})
+}
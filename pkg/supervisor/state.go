@@ -0,0 +1,342 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/internal/pkg/file"
+)
+
+// ProcessState describes the lifecycle state of a supervised process.
+type ProcessState string
+
+const (
+	// The supervisor is not running.
+	ProcessStateStopped ProcessState = "stopped"
+	// The supervised process has been started and is running.
+	ProcessStateRunning ProcessState = "running"
+	// The supervised process exited or failed to start and is about to be
+	// respawned.
+	ProcessStateRestarting ProcessState = "restarting"
+	// The supervised process is running, but is being or has been drained.
+	ProcessStateDraining ProcessState = "draining"
+)
+
+// hasProcess returns whether the supervised process is running in state p.
+func (p ProcessState) hasProcess() bool {
+	return p == ProcessStateRunning || p == ProcessStateDraining
+}
+
+// maxCrashHistory is the number of crashes a supervisor remembers.
+const maxCrashHistory = 100
+
+// SupervisorState is a point-in-time view of a supervisor.
+type SupervisorState struct {
+	Name            string            `json:"name"`
+	BinPath         string            `json:"binPath"`
+	Args            []string          `json:"args,omitempty"`
+	ResolvedBinPath string            `json:"resolvedBinPath,omitempty"`
+	State           ProcessState      `json:"state"`
+	PID             int               `json:"pid,omitempty"`
+	Restarts        int               `json:"restarts"`
+	StartedAt       time.Time         `json:"startedAt"`
+	LastUpdated     time.Time         `json:"lastUpdated"`
+	PausedSince     *time.Time        `json:"pausedSince,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// CrashReason classifies why a supervised process exited.
+type CrashReason string
+
+const (
+	// The process has been killed by the kernel's OOM killer.
+	CrashReasonOOMKill CrashReason = "OOMKill"
+	// The process has been terminated because of an invalid memory access.
+	CrashReasonSegfault CrashReason = "Segfault"
+	// The process exited successfully on its own.
+	CrashReasonNormalExit CrashReason = "NormalExit"
+	// The process has been killed by the supervisor, as it didn't terminate
+	// in time after being asked to.
+	CrashReasonTimeoutKill CrashReason = "TimeoutKill"
+	// The process terminated after being asked to by the supervisor.
+	CrashReasonUserRequested CrashReason = "UserRequested"
+	// The process has been killed by the supervisor, as its startup probe
+	// didn't succeed in time.
+	CrashReasonStartupTimeout CrashReason = "StartupTimeout"
+	// The process has been killed by the supervisor, as its post-start hook
+	// failed.
+	CrashReasonPostStartFailed CrashReason = "PostStartFailed"
+	// The process hasn't been started, as its binary didn't match the
+	// expected checksum.
+	CrashReasonChecksumMismatch CrashReason = "ChecksumMismatch"
+	// The process hasn't been started, as its binary had no valid signature.
+	CrashReasonInvalidSignature CrashReason = "InvalidSignature"
+	// None of the above.
+	CrashReasonUnknown CrashReason = "Unknown"
+)
+
+// CrashInfo describes an unexpected exit of a supervised process.
+type CrashInfo struct {
+	Time     time.Time   `json:"time"`
+	PID      int         `json:"pid"`
+	ExitCode int         `json:"exitCode"`
+	Signal   string      `json:"signal,omitempty"`
+	Reason   CrashReason `json:"reason"`
+}
+
+// newCrashInfo describes the exit of a process. If the supervisor asked the
+// process to terminate, requested is the reason for it.
+func newCrashInfo(state *os.ProcessState, requested CrashReason) CrashInfo {
+	info := CrashInfo{
+		Time:     time.Now(),
+		PID:      state.Pid(),
+		ExitCode: state.ExitCode(),
+		Reason:   requested,
+	}
+
+	status, _ := state.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		info.Signal = status.Signal().String()
+	}
+
+	if info.Reason == "" {
+		info.Reason = classifyExit(info.PID, status)
+	}
+	return info
+}
+
+func classifyExit(pid int, status syscall.WaitStatus) CrashReason {
+	switch {
+	case status.Signaled():
+		switch status.Signal() {
+		case syscall.SIGSEGV, syscall.SIGBUS:
+			return CrashReasonSegfault
+		case syscall.SIGKILL:
+			if oomKilled(pid) {
+				return CrashReasonOOMKill
+			}
+		}
+	case status.Exited() && status.ExitStatus() == 0:
+		return CrashReasonNormalExit
+	}
+
+	return CrashReasonUnknown
+}
+
+// Snapshot returns the current state of the supervisor.
+func (s *Supervisor) Snapshot() SupervisorState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshotLocked()
+}
+
+// snapshotLocked returns the current state of the supervisor. The caller
+// needs to hold s.mutex.
+func (s *Supervisor) snapshotLocked() SupervisorState {
+	state := SupervisorState{
+		Name:            s.Name,
+		BinPath:         s.BinPath,
+		ResolvedBinPath: s.binaryPath,
+		State:           s.state,
+		Restarts:        s.restarts,
+		StartedAt:       s.startedAt,
+		LastUpdated:     s.updatedAt,
+		Annotations:     maps.Clone(s.Annotations),
+	}
+	if !s.ConfidentialMode {
+		state.Args = append([]string(nil), s.Args...)
+	}
+	if state.State == "" {
+		state.State = ProcessStateStopped
+	}
+	if state.State.hasProcess() && s.cmd != nil && s.cmd.Process != nil {
+		state.PID = s.cmd.Process.Pid
+	}
+	return state
+}
+
+// loggableArgs returns args as they may appear in log messages. In
+// ConfidentialMode, each argument is replaced by a placeholder.
+func (s *Supervisor) loggableArgs(args []string) []string {
+	if !s.ConfidentialMode {
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i := range redacted {
+		redacted[i] = "[REDACTED]"
+	}
+	return redacted
+}
+
+// Annotate attaches the given annotation to the supervisor, replacing any
+// previous value for key. It's included in the supervisor's state right away.
+// The output of the supervised process is logged with the annotation as a
+// field once the process got restarted, and the supervisor's own log entries
+// include it once the supervisor got restarted.
+func (s *Supervisor) Annotate(key, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Annotations == nil {
+		s.Annotations = make(map[string]string)
+	}
+	s.Annotations[key] = value
+}
+
+// annotationFieldsLocked returns the supervisor's annotations as log fields.
+// The caller needs to hold s.mutex.
+func (s *Supervisor) annotationFieldsLocked() logrus.Fields {
+	fields := make(logrus.Fields, len(s.Annotations))
+	for key, value := range s.Annotations {
+		fields[key] = value
+	}
+	return fields
+}
+
+// Uptime returns for how long the supervised process has been running since
+// it has been started or restarted for the last time. Returns zero if the
+// process isn't running.
+func (s *Supervisor) Uptime() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.state.hasProcess() {
+		return 0
+	}
+	return time.Since(s.startedAt)
+}
+
+// IsStable returns whether the supervised process has been running for at
+// least UptimeWindow without being restarted.
+func (s *Supervisor) IsStable() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state.hasProcess() && time.Since(s.startedAt) >= s.UptimeWindow
+}
+
+// Summary returns a one-line description of the supervisor, in the form
+// "<name> pid=<pid> restarts=<restarts> uptime=<uptime> state=<state>
+// bin=<path>". The PID is zero and the uptime is zero seconds unless the
+// process is running. The uptime is truncated to seconds. The binary is
+// omitted if the process has never been started.
+func (s *Supervisor) Summary() string {
+	s.mutex.Lock()
+	state := s.snapshotLocked()
+	s.mutex.Unlock()
+
+	var uptime time.Duration
+	if state.State.hasProcess() {
+		uptime = time.Since(state.StartedAt).Truncate(time.Second)
+	}
+
+	summary := fmt.Sprintf("%s pid=%d restarts=%d uptime=%s state=%s", state.Name, state.PID, state.Restarts, uptime, state.State)
+	if state.ResolvedBinPath != "" {
+		summary += " bin=" + state.ResolvedBinPath
+	}
+	return summary
+}
+
+// setState records a state transition of the supervised process.
+func (s *Supervisor) setState(state ProcessState) {
+	s.mutex.Lock()
+	before := s.snapshotLocked()
+	s.setStateLocked(state)
+	snapshot, m := s.snapshotLocked(), s.manager
+	s.mutex.Unlock()
+
+	s.updateStatusFile(&snapshot)
+	if m != nil {
+		m.publishStateChange(&before, &snapshot)
+	}
+}
+
+// transitionState records a state transition of the supervised process, if
+// it's currently in the from state. Returns whether the transition happened.
+func (s *Supervisor) transitionState(from, to ProcessState) bool {
+	s.mutex.Lock()
+	if s.state != from {
+		s.mutex.Unlock()
+		return false
+	}
+	before := s.snapshotLocked()
+	s.setStateLocked(to)
+	snapshot, m := s.snapshotLocked(), s.manager
+	s.mutex.Unlock()
+
+	s.updateStatusFile(&snapshot)
+	if m != nil {
+		m.publishStateChange(&before, &snapshot)
+	}
+	return true
+}
+
+// setStateLocked records a state transition of the supervised process. The
+// caller needs to hold s.mutex and to update the status file afterwards.
+func (s *Supervisor) setStateLocked(state ProcessState) {
+	now := time.Now()
+	// Going back from draining to running isn't a restart.
+	if state == ProcessStateRunning && s.state != ProcessStateDraining {
+		s.startedAt = now
+	}
+	s.state, s.updatedAt = state, now
+}
+
+// updateStatusFile writes the given state to StatusFile, if configured.
+func (s *Supervisor) updateStatusFile(snapshot *SupervisorState) {
+	if s.StatusFile != "" {
+		if err := writeStatusFile(s.StatusFile, snapshot); err != nil {
+			s.log.WithError(err).Warnf("Failed to write status file %s", s.StatusFile)
+		}
+	}
+}
+
+// writeStatusFile atomically replaces the status file with the given state.
+func writeStatusFile(path string, state *SupervisorState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return file.WriteContentAtomically(path, data, 0644)
+}
+
+// recordCrash remembers an unexpected exit of the supervised process.
+func (s *Supervisor) recordCrash(info CrashInfo) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.crashes = append(s.crashes, info)
+	if len(s.crashes) > maxCrashHistory {
+		s.crashes = s.crashes[len(s.crashes)-maxCrashHistory:]
+	}
+
+	entry := RecoveryLogEntry{
+		Timestamp:   info.Time,
+		Event:       RecoveryEventCrashed,
+		PID:         info.PID,
+		ExitCode:    info.ExitCode,
+		CrashReason: info.Reason,
+	}
+	if info.PID != 0 {
+		entry.Duration = info.Time.Sub(s.startedAt)
+	}
+	s.addRecoveryLogEntryLocked(entry)
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCrashInfo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Signals are not supported on Windows")
+	}
+
+	sh := selectCmd(t, cmd{binPath: "sh"}).binPath
+	for _, test := range []struct {
+		name, script string
+		reason       CrashReason
+	}{
+		{"normal_exit", "exit 0", CrashReasonNormalExit},
+		{"failure", "exit 1", CrashReasonUnknown},
+		{"segfault", "kill -SEGV $$", CrashReasonSegfault},
+		{"sigterm", "kill -TERM $$", CrashReasonUnknown},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := exec.Command(sh, "-c", test.script)
+			_ = cmd.Run()
+			require.NotNil(t, cmd.ProcessState)
+
+			info := newCrashInfo(cmd.ProcessState, "")
+			assert.Equal(t, cmd.ProcessState.Pid(), info.PID)
+			assert.Equal(t, test.reason, info.Reason)
+		})
+	}
+
+	cmd := exec.Command(sh, "-c", "exit 0")
+	require.NoError(t, cmd.Run())
+	assert.Equal(t, CrashReasonUserRequested, newCrashInfo(cmd.ProcessState, CrashReasonUserRequested).Reason)
+}
+
+func TestCrashReason_TerminateProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Graceful shutdown is not implemented on Windows")
+	}
+
+	for _, test := range []struct {
+		name          string
+		ignoreSIGTERM bool
+		reason        CrashReason
+	}{
+		{"user_requested", false, CrashReasonUserRequested},
+		{"timeout_kill", true, CrashReasonTimeoutKill},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pingPong := pingpong.New(t)
+			pingPong.IgnoreGracefulShutdownRequest = test.ignoreSIGTERM
+
+			crashes := make(chan CrashInfo, 1)
+			s := Supervisor{
+				Name:    t.Name(),
+				BinPath: pingPong.BinPath(),
+				RunDir:  t.TempDir(),
+				Args:    pingPong.BinArgs(),
+				// Don't respawn the process during the test.
+				TimeoutRespawn: 1 * time.Minute,
+				TimeoutStop:    10 * time.Millisecond,
+				OnCrash:        func(info CrashInfo) { crashes <- info },
+			}
+			require.NoError(t, s.Supervise())
+			t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+			require.NoError(t, pingPong.AwaitPing())
+			s.terminateProcess()
+			assert.Equal(t, test.reason, (<-crashes).Reason)
+		})
+	}
+}
+
+func TestStatusFile(t *testing.T) {
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:       t.Name(),
+		BinPath:    pingPong.BinPath(),
+		RunDir:     t.TempDir(),
+		Args:       pingPong.BinArgs(),
+		StatusFile: filepath.Join(t.TempDir(), "status.json"),
+	}
+
+	readStatus := func() (state SupervisorState) {
+		data, err := os.ReadFile(s.StatusFile)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &state))
+		return state
+	}
+
+	require.NoError(t, s.Supervise())
+	require.NoError(t, pingPong.AwaitPing())
+	state := readStatus()
+	assert.Equal(t, t.Name(), state.Name)
+	assert.Equal(t, ProcessStateRunning, state.State)
+	assert.Equal(t, s.GetProcess().Pid, state.PID)
+
+	require.NoError(t, s.Stop())
+	state = readStatus()
+	assert.Equal(t, ProcessStateStopped, state.State)
+	assert.Zero(t, state.PID)
+}
+
+func TestIsStable(t *testing.T) {
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:         t.Name(),
+		BinPath:      pingPong.BinPath(),
+		RunDir:       t.TempDir(),
+		Args:         pingPong.BinArgs(),
+		UptimeWindow: 100 * time.Millisecond,
+	}
+	assert.False(t, s.IsStable(), "Stopped supervisor should not be stable")
+	assert.Zero(t, s.Uptime())
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	require.NoError(t, pingPong.AwaitPing())
+
+	assert.Eventually(t, s.IsStable, 10*time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, s.Uptime(), 100*time.Millisecond)
+
+	s.UptimeWindow = 0
+	assert.True(t, s.IsStable(), "Running process should be stable without an uptime window")
+}
+
+func TestSummary(t *testing.T) {
+	s := Supervisor{Name: "foo"}
+	assert.Equal(t, "foo pid=0 restarts=0 uptime=0s state=stopped", s.Summary())
+
+	s.restarts = 3
+	s.setState(ProcessStateRestarting)
+	assert.Equal(t, "foo pid=0 restarts=3 uptime=0s state=restarting", s.Summary())
+
+	pingPong := pingpong.New(t)
+	pids := make(chan int, 1)
+	s = Supervisor{
+		Name:    "bar",
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+		OnStart: func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	assert.Regexp(t, fmt.Sprintf(`^bar pid=%d restarts=0 uptime=\d+s state=running bin=\S+$`, pid), s.Summary())
+}
+
+func TestAnnotate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	hook := new(logtest.Hook)
+	std := logrus.StandardLogger()
+	oldHooks := std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	t.Cleanup(func() { std.ReplaceHooks(oldHooks) })
+
+	// Returns the fields of the last logged output line of the process.
+	lastOutput := func() logrus.Fields {
+		entries := hook.AllEntries()
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Data["component"] == t.Name() && entries[i].Message == "out" {
+				return entries[i].Data
+			}
+		}
+		return nil
+	}
+
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo out; exec sleep 60"}})
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Millisecond,
+		OnStart:        func(pid int) { pids <- pid },
+	}
+	s.Annotate("node", "worker-0")
+	assert.Equal(t, map[string]string{"node": "worker-0"}, s.Snapshot().Annotations)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	<-pids
+	if entry := hook.LastEntry(); assert.NotNil(t, entry) {
+		assert.Equal(t, "worker-0", entry.Data["node"])
+	}
+	require.Eventually(t, func() bool { return lastOutput() != nil }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "worker-0", lastOutput()["node"])
+	assert.NotContains(t, lastOutput(), "zone")
+
+	// The output of the restarted process includes the new annotation.
+	s.Annotate("zone", "a")
+	assert.Equal(t, map[string]string{"node": "worker-0", "zone": "a"}, s.Snapshot().Annotations)
+	require.NoError(t, s.GetProcess().Kill())
+	<-pids
+	require.Eventually(t, func() bool { return lastOutput()["zone"] == "a" }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "worker-0", lastOutput()["node"])
+
+	report, err := s.GenerateCrashReport()
+	require.NoError(t, err)
+	gz, err := gzip.NewReader(bytes.NewReader(report))
+	require.NoError(t, err)
+	var decoded CrashReport
+	require.NoError(t, json.NewDecoder(gz).Decode(&decoded))
+	assert.Equal(t, map[string]string{"node": "worker-0", "zone": "a"}, decoded.State.Annotations)
+}
+
+func TestConfidentialMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	hook := new(logtest.Hook)
+	std := logrus.StandardLogger()
+	oldHooks := std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	oldLevel := std.GetLevel()
+	std.SetLevel(logrus.DebugLevel)
+	t.Cleanup(func() { std.ReplaceHooks(oldHooks); std.SetLevel(oldLevel) })
+
+	const secret = "s3cr3t-t0k3n"
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "exec sleep 60", secret}})
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:             t.Name(),
+		BinPath:          sh.binPath,
+		Args:             sh.binArgs,
+		RunDir:           t.TempDir(),
+		StatusFile:       filepath.Join(t.TempDir(), "status.json"),
+		ConfidentialMode: true,
+		OnStart:          func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	<-pids
+
+	assert.Nil(t, s.Snapshot().Args)
+	status, err := os.ReadFile(s.StatusFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(status), secret)
+
+	report, err := s.GenerateCrashReport()
+	require.NoError(t, err)
+	gz, err := gzip.NewReader(bytes.NewReader(report))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.NotContains(t, string(decoded), secret)
+
+	var redacted bool
+	for _, entry := range hook.AllEntries() {
+		line, err := entry.String()
+		require.NoError(t, err)
+		assert.NotContains(t, line, secret)
+		redacted = redacted || strings.Contains(line, "[REDACTED]")
+	}
+	assert.True(t, redacted, "Expected the arguments to be logged in redacted form")
+}
+
+func TestSnapshot_ResolvedBinPath(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+	expected, err := exec.LookPath(sleep.binPath)
+	require.NoError(t, err)
+	expected, err = filepath.Abs(expected)
+	require.NoError(t, err)
+
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: filepath.Base(sleep.binPath),
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}
+	assert.Empty(t, s.Snapshot().ResolvedBinPath)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	assert.Equal(t, expected, s.Snapshot().ResolvedBinPath)
+	assert.True(t, strings.HasSuffix(s.Summary(), " bin="+expected), "Unexpected summary: %s", s.Summary())
+}
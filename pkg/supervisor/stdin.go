@@ -0,0 +1,43 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"slices"
+)
+
+// SendInput writes data, followed by a newline, to the stdin of the
+// supervised process. Requires OpenStdin to be set. The input is always sent
+// to the current process, i.e. to the restarted one after a restart.
+func (s *Supervisor) SendInput(data []byte) error {
+	s.mutex.Lock()
+	stdin := s.stdin
+	running := s.state.hasProcess()
+	s.mutex.Unlock()
+
+	if !s.OpenStdin {
+		return errors.New("stdin is not open")
+	}
+	if !running || stdin == nil {
+		return s.errNotRunning()
+	}
+
+	// A single write, so that concurrent inputs don't interleave.
+	_, err := stdin.Write(append(slices.Clip(data), '\n'))
+	return err
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Requires cat")
+	}
+
+	cat := selectCmd(t, cmd{binPath: "cat"})
+	pids := make(chan int, 2)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        cat.binPath,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: time.Millisecond,
+		OpenStdin:      true,
+		OnStart:        func(pid int) { pids <- pid },
+	}
+	assert.ErrorIs(t, s.SendInput([]byte("too early")), ErrNotStarted)
+
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	require.NoError(t, s.SendInput([]byte("hello")))
+	require.NoError(t, s.SendInput([]byte("world")))
+	assert.Eventually(t, func() bool {
+		return slices.Equal([]string{"hello", "world"}, s.output.snapshot())
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// Input is sent to the restarted process.
+	process, err := os.FindProcess(pid)
+	require.NoError(t, err)
+	require.NoError(t, process.Kill())
+	<-pids
+	assert.Eventually(t, func() bool {
+		return s.SendInput([]byte("again")) == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return slices.Contains(s.output.snapshot(), "again")
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestSendInput_NotOpen(t *testing.T) {
+	s := Supervisor{Name: t.Name()}
+	assert.ErrorContains(t, s.SendInput([]byte("input")), "stdin is not open")
+}
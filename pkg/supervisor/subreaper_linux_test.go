@@ -0,0 +1,55 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildSubreaper(t *testing.T) {
+	// Orphan a grandchild and let it report its new parent. It waits a while
+	// for being re-parented to the supervised process.
+	ppidFile := filepath.Join(t.TempDir(), "ppid")
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:         t.TempDir(),
+		Args:           []string{"-c", `(sh -c 'for i in $(seq 100); do [ "$(cut -d" " -f4 /proc/$$/stat)" = "$1" ] && break; sleep 0.1; done; cut -d" " -f4 /proc/$$/stat >"$0.tmp"; mv "$0.tmp" "$0"' "$0" $$ &); exec sleep 20`, ppidFile},
+		ChildSubreaper: true,
+		OnStart:        func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	var ppid []byte
+	require.Eventually(t, func() bool {
+		var err error
+		ppid, err = os.ReadFile(ppidFile)
+		return err == nil
+	}, 15*time.Second, 10*time.Millisecond)
+	assert.Equal(t, strconv.Itoa(pid), strings.TrimSpace(string(ppid)))
+}
@@ -18,24 +18,46 @@ package supervisor
 
 import (
 	"context"
+	"crypto/rsa"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"runtime"
-	"sort"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/k0sproject/k0s/internal/pkg/dir"
 	"github.com/k0sproject/k0s/pkg/constant"
 )
 
+// SupervisedProcess is the part of [Supervisor] that components use to manage
+// their processes. It allows for the supervisor to be replaced in tests.
+type SupervisedProcess interface {
+	Supervise() error
+	Stop() error
+	GetProcess() *os.Process
+	IsRunning() bool
+	Snapshot() SupervisorState
+}
+
+var _ SupervisedProcess = (*Supervisor)(nil)
+
 // Supervisor is dead simple and stupid process supervisor, just tries to keep the process running in a while-true loop
 type Supervisor struct {
 	Name           string
@@ -48,33 +70,422 @@ type Supervisor struct {
 	GID            int
 	TimeoutStop    time.Duration
 	TimeoutRespawn time.Duration
+	// Whether to learn how long the supervised process takes to shut down
+	// gracefully, and to use that instead of TimeoutStop, see
+	// MaxTimeoutStop. The learned durations are recorded in StateFile, if
+	// configured, so that they survive restarts of k0s.
+	AdaptiveTimeout bool
+	// The upper bound of the learned stop timeout in AdaptiveTimeout mode.
+	// Defaults to one minute.
+	MaxTimeoutStop time.Duration
+	// The maximum number of times the supervised process is respawned after
+	// it exited or failed to start. Zero means no limit.
+	MaxRestarts int
+	// Whether to verify that BinPath matches BinaryChecksum each time before
+	// the supervised process is started. Processes with a mismatching binary
+	// are reported via OnCrash instead of being started.
+	ValidateBinaryChecksum bool
+	// The hex encoded SHA-256 checksum of BinPath.
+	BinaryChecksum string
+	// Whether to verify the detached signature of BinPath each time before
+	// the supervised process is started. The signature is read from a file
+	// next to the binary with an additional ".sig" extension. It's an RSA
+	// PKCS #1 v1.5 signature of the binary's SHA-256 hash, as created by
+	// openssl dgst -sha256 -sign. Processes with an invalid signature are
+	// reported via OnCrash instead of being started.
+	RequireBinarySignature bool
+	// The PEM encoded certificate whose RSA public key verifies the binary
+	// signature. Required if RequireBinarySignature is set.
+	SigningCert string
+	// Whether to stop the supervised process along with all of its
+	// descendants by signaling its whole process group, instead of just the
+	// process itself. Processes that are still running after TimeoutStop are
+	// killed. Not supported on Windows.
+	KillProcessGroup bool
 	// For those components having env prefix convention such as ETCD_xxx, we should keep the prefix.
 	KeepEnvPrefix bool
 	// A function to clean some leftovers before starting or restarting the supervised process
 	CleanBeforeFn func() error
+	// The nice value of the supervised process, ranging from -20 (highest
+	// priority) to 19 (lowest priority). Zero leaves the priority unchanged.
+	// It's applied right after the process has been started. On Linux, where
+	// it's a per-thread attribute, it's applied to all threads the process
+	// created in the meantime, and inherited by the ones it creates later on.
+	ProcessPriority int
+	// The memory mappings to include in core dumps of the supervised process,
+	// as a bit mask, see core(5). Zero leaves the default unchanged. Linux
+	// only.
+	CoredumpFilter uint32
+	// The maximum number of file descriptors the supervised process may
+	// open, i.e. both the soft and the hard RLIMIT_NOFILE. The limit is
+	// applied right after the process has been started. Zero leaves the
+	// limits unchanged. Linux only.
+	OpenFilesLimit uint64
+	// A file that is created (or touched) at each OS boot. PID files older
+	// than this file are stale leftovers from a previous boot and will be
+	// removed instead of trying to kill the process they point to. PID files
+	// are never considered stale while this file doesn't exist. Files in
+	// /proc are rejected, as their modification times don't reflect the boot
+	// time.
+	BootStampFile string
+	// Suppresses all log output of the supervised process as well as the
+	// supervisor's own log messages. The output is still written to
+	// StdoutFile, StderrFile and NamedPipeOutput, and the most recent lines
+	// are still remembered for TerminationLog and crash reports.
+	DisableLogging bool
+	// The cgroup v2 directory into which the supervised process is moved
+	// after it has been started. Created if it doesn't exist.
+	CgroupPath string
+	// The name of a cgroup group that the supervised process shares with
+	// other supervisors. The process is put into a child cgroup of the
+	// group's cgroup, which is subject to the limits configured in
+	// [DefaultCgroupGroupRegistry]. Overrides CgroupPath.
+	CgroupGroup string
+	// The sandbox in which the supervised process is run, if any. Only
+	// [SandboxGVisor] is supported, which is Linux only.
+	Sandbox string
+	// The runsc binary used to run the supervised process inside a gVisor
+	// sandbox. Defaults to "runsc", looked up in PATH.
+	SandboxBinary string
+	// The CRIU binary used by [Supervisor.Checkpoint] and
+	// [Supervisor.Restore]. Defaults to "criu", looked up in PATH.
+	CRIUBinary string
+	// Path to a Linux network namespace file, e.g. /proc/1/ns/net or
+	// /run/netns/<name>, in which the supervised process is started.
+	NetNSPath string
+	// The CPU quota of the supervised process's cgroup, in CPUs, e.g. 0.5
+	// means 50% of one CPU. Requires a cgroup. Zero means unlimited.
+	CgroupCPUQuota float64
+	// The CPU scheduling period for CgroupCPUQuota, in microseconds.
+	// Defaults to 100000.
+	CgroupCPUPeriodUs uint64
+	// The block I/O limits of the supervised process's cgroup, in the format
+	// of the cgroup v2 io.max file, e.g. "8:0 rbps=1048576 wiops=120". Instead
+	// of its major and minor number, the device may be given by its path,
+	// e.g. "/dev/sda". Multiple devices go on separate lines. Requires a
+	// cgroup. Linux only.
+	CgroupIOMax string
+	// The maximum time to wait for the output streams of the supervised
+	// process to be closed after it exited, e.g. because they have been
+	// inherited by lingering child processes. Zero means no limit.
+	WaitDelay time.Duration
+	// Polled after the supervised process has been started, until it
+	// succeeds. The process is killed and respawned if the probe doesn't
+	// succeed within StartupProbeTimeout, e.g. to detect processes that hang
+	// during their initialization. The probe is called with a context that
+	// is done when the process exits or the timeout expires.
+	StartupProbe func(ctx context.Context) error
+	// The time the supervised process is given to pass StartupProbe after it
+	// has been started. Defaults to one minute.
+	StartupProbeTimeout time.Duration
+	// The interval in which StartupProbe is polled. Defaults to one second.
+	StartupProbeInterval time.Duration
+	// The time after which a warning is logged if the supervised process
+	// isn't ready yet, i.e. hasn't passed StartupProbe. An error is logged
+	// after twice that time. This is purely observational, the process isn't
+	// killed because of it. Note that StartupProbe kills processes after
+	// StartupProbeTimeout, though.
+	SlowStartThreshold time.Duration
+	// Called whenever the supervised process has been started.
+	OnStart func(pid int)
+	// Called synchronously right after the supervised process has been
+	// started, before OnStart, to validate that it started correctly. If it
+	// returns an error, the process is killed and not considered started.
+	// Supervise returns the error for the first start, later ones are
+	// respawned as if they crashed. In contrast to StartupProbe, it's called
+	// only once per start.
+	PostStart func(pid int) error
+	// Called whenever the supervised process exited unexpectedly.
+	OnCrash func(CrashInfo)
+	// Called after the supervised process has been stopped.
+	OnStop func()
+	// Asks the supervised process to stop accepting new work and returns
+	// once it finished its current work. Called by
+	// [SupervisorManager.Drain]. Components without it can't be drained.
+	OnDrain func(ctx context.Context) error
+	// Whether [SupervisorManager.Drain] stops the supervisor once the
+	// supervised process has been drained.
+	StopAfterDrain bool
+	// Receive the output of commands run via Exec.
+	ExecStdout, ExecStderr io.Writer
+	// Logs Go panic stack traces in the output of the supervised process as
+	// a single error entry with a panic_trace field, instead of line by line.
+	CapturePanicOutput bool
+	// Files to which the output of the supervised process is appended, in
+	// addition to logging it. Both may point to the same file.
+	StdoutFile, StderrFile string
+	// The size in bytes after which StdoutFile and StderrFile are rotated
+	// and compressed. Zero disables rotation.
+	MaxLogFileSize int64
+	// The number of rotated log files to keep. Defaults to 5.
+	MaxLogFiles int
+	// The fraction of output lines of the supervised process to log, ranging
+	// from 0 to 1, e.g. 0.1 logs about every tenth line. The lines to log are
+	// picked randomly. Zero logs all lines. Doesn't affect StdoutFile and
+	// StderrFile.
+	LogSampleRate float64
+	// The interval in which the number of output lines that have been
+	// dropped by LogSampleRate is logged. Defaults to one minute.
+	LogSampleReportInterval time.Duration
+	// Whether to start with empty StdoutFile and StderrFile each time the
+	// supervised process is started. The output of the previous run is
+	// preserved in <name>-<timestamp>.log.
+	TruncateStaleOutputFiles bool
+	// Path to a named pipe to which the standard output of the supervised
+	// process is written, for consumers that stream it. The pipe is created
+	// if it doesn't exist. Output is dropped while no reader is connected or
+	// the pipe is full, see [Supervisor.DroppedBytes]. Not supported on
+	// Windows.
+	NamedPipeOutput string
+	// The identifier with which the output of the supervised process is sent
+	// to the local syslog daemon, if not empty. Standard output is logged
+	// with the info priority, standard error with the err priority. The
+	// output is then neither logged nor written to StdoutFile or StderrFile.
+	// Not supported on Windows.
+	SyslogIdentifier string
+	// The maximum disk usage of DataDir. Zero means no limit.
+	MaxDiskUsageBytes int64
+	// The interval in which the disk usage of DataDir is checked. Defaults to
+	// one minute.
+	DiskCheckInterval time.Duration
+	// Called with the current disk usage whenever a check finds that DataDir
+	// exceeds MaxDiskUsageBytes.
+	OnDiskFull func(usage int64)
+	// Whether to restart the supervised process when DataDir exceeds
+	// MaxDiskUsageBytes, e.g. to let CleanBeforeFn start over with a clean
+	// state.
+	RestartOnDiskFull bool
+	// Files whose changes cause the supervised process to be restarted, e.g.
+	// its configuration files. Symlinks are followed. Changes are debounced
+	// for TimeoutRespawn.
+	AutoRestartOnFileChange []string
+	// Path to a file in which the supervisor records data directory
+	// migrations, so that repeated migrations are detected, as well as the
+	// shutdown durations learned in AdaptiveTimeout mode. Optional.
+	StateFile string
+	// Configuration that is passed to the supervised process as a YAML file,
+	// e.g. {"data-dir": "/var/lib/k0s"}. The file is written to RunDir each
+	// time the process is started and removed once it exited. Its path is
+	// passed after ConfigFileArg, as a separate argument.
+	ConfigMap map[string]string
+	// The argument with which the path to the ConfigMap file is passed,
+	// e.g. "--config-file".
+	ConfigFileArg string
+	// Keep Args out of log messages, snapshots, status files and crash
+	// reports, as they may contain secrets. The supervised process is still
+	// started with the actual arguments.
+	ConfidentialMode bool
+	// Path to a file in dotenv format, whose variables are added to the
+	// environment of the supervised process. They take precedence over the
+	// environment of k0s, but not over component specific variables.
+	EnvironmentFile string
+	// Whether the supervised process inherits the environment of k0s.
+	// Defaults to true. Otherwise, the process only gets the variables of
+	// EnvironmentFile and a PATH with the bin directory in DataDir. Note
+	// that processes on Windows may need SYSTEMROOT to be set.
+	IncludeParentEnv *bool
+	// The format of the supervisor's log output, either "json" or "text".
+	// Uses the format of the global logger if empty.
+	LogFormat string
+	// Records Kubernetes events for starts and crashes of the supervised
+	// process, if set. The events refer to NodeRef.
+	EventRecorder record.EventRecorder
+	// The node to which recorded events refer.
+	NodeRef *corev1.ObjectReference
+	// Receives a SupervisorStartedEvent, SupervisorCrashedEvent or
+	// SupervisorStoppedEvent for each lifecycle transition of the supervised
+	// process, if set.
+	EventBus EventBus
+	// Whether to pass on the sockets that have been passed to k0s via systemd
+	// socket activation whose names match the supervisor's name, so that they
+	// stay open while the supervised process is being restarted.
+	SocketActivation bool
+	// Paths of Unix sockets on which the supervisor listens on behalf of the
+	// supervised process. Each started process inherits the listening
+	// sockets as file descriptors, in the given order, following the ones
+	// passed via SocketActivation. They stay bound while the process is being
+	// restarted, so that no connections are refused in the meantime. Not
+	// supported on Windows.
+	InheritedListeners []string
+	// Whether restarted processes join the process group of their
+	// predecessor, if it still exists, instead of getting a new one. Along
+	// with InheritedListeners, this allows descendants of the previous
+	// process to keep serving their connections while the new process takes
+	// over the socket. Only works for components that serve a single socket,
+	// hence InheritedListeners needs to contain exactly one path. Not
+	// supported on Windows.
+	WarmRestartMode bool
+	// A file whose modification time is updated every HeartbeatInterval while
+	// the supervised process is running, so that external monitors can
+	// detect crashed or hung supervisors by its age. Created if it doesn't
+	// exist.
+	HeartbeatFile string
+	// The interval in which HeartbeatFile is updated. Defaults to ten
+	// seconds.
+	HeartbeatInterval time.Duration
+	// The names of the hardware or software performance counters to attach
+	// to the supervised process, as listed by perf list, e.g. "cache-misses"
+	// or "branch-misses". Use [Supervisor.GetPerfCounters] to read them.
+	// Requires CAP_PERFMON or a kernel.perf_event_paranoid setting of at most
+	// 1. Linux only.
+	PerfCounters []string
+	// The interval in which PerfCounters are sampled. Defaults to ten
+	// seconds.
+	PerfSampleInterval time.Duration
+	// Records the resource usage of the supervised process in Prometheus
+	// histograms, see [ResourceMetricsSpec]. Linux only.
+	ResourceMetrics ResourceMetricsSpec
+	// The URL of an etcd server in which the supervisor maintains a lease
+	// while the supervised process is running, e.g. for distributed
+	// monitoring. The supervisor's state is written as JSON into LeaseKey,
+	// bound to the lease. Once the process isn't running anymore, the lease
+	// isn't renewed, so that the key expires.
+	LeaseEndpoint string
+	// The time to live of the lease, in whole seconds. Defaults to ten
+	// seconds.
+	LeaseTTL time.Duration
+	// The key bound to the lease. Defaults to "/k0s/supervisors/<name>".
+	LeaseKey string
+	// Restricts the outbound connections of the supervised process via
+	// iptables rules matching its UID. The rules are installed before each
+	// start and removed after the process exited. The process must run with
+	// a dedicated UID. The process isn't started if the rules can't be
+	// installed. Linux only.
+	NetworkPolicy *NetworkPolicySpec
+	// A channel that needs to be closed before the supervised process is
+	// asked to terminate when the supervisor is stopped, e.g. to shut down
+	// components that depend on it first. The supervisor waits at most
+	// TimeoutStop for it.
+	ShutdownBarrier <-chan struct{}
+	// An audit log to which a JSON line is written for each call of Stop,
+	// Freeze, Thaw, SetUID and SetGID, including the calling user and the
+	// result. Entries are written synchronously, regardless of
+	// ConfidentialMode.
+	AccessLog io.Writer
+	// Whether to connect the stdin of the supervised process to a pipe,
+	// so that input can be sent to it via [Supervisor.SendInput]. Otherwise,
+	// stdin is connected to the null device.
+	OpenStdin bool
+	// Path to a file to which the supervisor's state is written as JSON on
+	// each state transition. The file is replaced atomically.
+	StatusFile string
+	// Path to a file to which the most recent output of the supervised
+	// process is written each time it exits, e.g. /dev/termination-log, so
+	// that Kubernetes can report it as the termination message of the pod.
+	TerminationLog string
+	// The maximum number of bytes written to TerminationLog. Defaults to
+	// 4096.
+	TerminationLogMaxBytes int
+	// Whether to make the supervised process a child subreaper, so that its
+	// orphaned descendants are re-parented to it instead of to init. Note
+	// that the process itself is responsible for reaping them. The process is
+	// started via [TrampolineCommand]. Linux only.
+	ChildSubreaper bool
+	// Whether to pass the span context given to SuperviseContext on to the
+	// supervised process via environment variables, so that OpenTelemetry
+	// aware processes can create child spans in the same trace.
+	PropagateTrace bool
+	// The format in which the span context is propagated, either
+	// [TracePropagationW3C] (TRACEPARENT and TRACESTATE) or
+	// [TracePropagationB3] (B3). Defaults to [TracePropagationW3C].
+	TracePropagationFormat string
+	// The bind mounts to set up for the supervised process. If there are any,
+	// the process is started in a private mount namespace, via
+	// [TrampolineCommand]. Linux only.
+	MountBinds []MountBind
+	// The time to wait before the supervised process is started for the
+	// first time, e.g. to stagger the starts of multiple supervisors.
+	// Supervise returns right away, so errors of the first start aren't
+	// returned by it, and the process is respawned instead.
+	StartupDelay time.Duration
+	// The time the supervised process needs to run without being restarted
+	// in order to be considered stable. See [Supervisor.IsStable].
+	UptimeWindow time.Duration
+	// Local TCP ports that are forwarded to other ports on 127.0.0.1, e.g.
+	// to make the listening ports of the supervised process reachable for
+	// debugging. Each port is forwarded by a supervised socat process, which
+	// is started after the supervised process and stopped before it.
+	SocatProxy map[int]int
+	// Arbitrary metadata attached to the supervisor. It's included in its
+	// state and added as fields to its log entries. Use
+	// [Supervisor.Annotate] to add annotations while supervising.
+	Annotations map[string]string
 
 	cmd            *exec.Cmd
+	state          ProcessState
+	restarts       int
+	startedAt      time.Time
+	updatedAt      time.Time
+	crashes        []CrashInfo
+	recoveryLog    []RecoveryLogEntry
+	frozen         bool
+	output         *outputBuffer
+	stdoutFile     *logFile
+	stderrFile     *logFile
+	waitResult     <-chan error
+	logWriters     []*logWriter
+	binaryPath     string
+	stopReason     CrashReason
+	binaryInode    uint64
+	debugger       *SupervisorDebugger
+	sidecars       []*Supervisor
+	manager        *SupervisorManager
+	adoptee        *handoverState
+	derivedFields  map[string]derivedField
+	syslogOut      *syslogOutput
+	namedPipe      *namedPipe
+	leaseClient    leaseClient
+	signingKey     *rsa.PublicKey
+	liveBinary     *os.File
+	perfValues     map[string]uint64
+	spanContext    trace.SpanContext
+	shutdowns      []time.Duration
+	listeners      []*os.File
+	processGroup   int
+	stdin          io.WriteCloser
+	ready          chan struct{}
+	isReady        bool
+	droppedBytes   atomic.Int64
+	started        atomic.Bool
 	done           chan bool
 	log            logrus.FieldLogger
 	mutex          sync.Mutex
 	startStopMutex sync.Mutex
+	accessLogMutex sync.Mutex
 	cancel         context.CancelFunc
 }
 
 const k0sManaged = "_K0S_MANAGED=yes"
 
+// maxOutputLines is the number of output lines a supervisor remembers.
+const maxOutputLines = 200
+
+// guardRestartDelay is the time to wait before the supervisor loop is
+// restarted after a panic.
+var guardRestartDelay = 5 * time.Second
+
 // processWaitQuit waits for a process to exit or a shut down signal
 // returns true if shutdown is requested
 func (s *Supervisor) processWaitQuit(ctx context.Context) bool {
-	waitresult := make(chan error)
-	go func() {
-		waitresult <- s.cmd.Wait()
-	}()
+	waitresult := s.waitResult
 
 	defer os.Remove(s.PidFile)
 
 	select {
 	case <-ctx.Done():
+		s.awaitShutdownBarrier()
+		// A frozen process wouldn't react to SIGTERM.
+		s.ensureThawed()
+		shutdownStarted := time.Now()
+		if s.KillProcessGroup {
+			if s.stopProcessGroup(waitresult) {
+				s.recordShutdown(time.Since(shutdownStarted))
+			}
+			s.waitResult = nil
+			s.flushLogWriters()
+			s.recordStopped()
+			return true
+		}
 		for {
 			if runtime.GOOS == "windows" {
 				// Graceful shutdown not implemented on Windows. This requires
@@ -100,24 +511,180 @@ func (s *Supervisor) processWaitQuit(ctx context.Context) bool {
 				}
 			}
 			select {
-			case <-time.After(s.TimeoutStop):
+			case <-time.After(s.stopTimeout()):
 				continue
 			case <-waitresult:
+				if runtime.GOOS != "windows" {
+					s.recordShutdown(time.Since(shutdownStarted))
+				}
+				s.waitResult = nil
+				s.flushLogWriters()
+				s.recordStopped()
 				return true
 			}
 		}
 	case err := <-waitresult:
+		s.waitResult = nil
+		s.flushLogWriters()
+		s.ensureThawed()
 		if err != nil {
 			s.log.WithError(err).Warn("Failed to wait for process")
+		} else if s.cmd.ProcessState == nil {
+			// The exit status of adopted processes is unknown.
+			s.log.Warn("Adopted process exited")
 		} else {
 			s.log.Warnf("Process exited: %s", s.cmd.ProcessState)
 		}
+		if s.cmd.ProcessState != nil {
+			s.mutex.Lock()
+			requested := s.stopReason
+			s.mutex.Unlock()
+			info := newCrashInfo(s.cmd.ProcessState, requested)
+			s.recordCrash(info)
+			s.recordCrashedEvent(info)
+			if s.OnCrash != nil {
+				s.OnCrash(info)
+			}
+		}
 	}
 	return false
 }
 
+// awaitShutdownBarrier blocks until ShutdownBarrier is closed, but at most for
+// TimeoutStop.
+func (s *Supervisor) awaitShutdownBarrier() {
+	if s.ShutdownBarrier == nil {
+		return
+	}
+
+	s.log.Info("Waiting for the shutdown barrier to be lifted")
+	timeout := time.NewTimer(s.TimeoutStop)
+	defer timeout.Stop()
+	select {
+	case <-s.ShutdownBarrier:
+	case <-timeout.C:
+		s.log.Warnf("Shutdown barrier hasn't been lifted within %s, shutting down anyway", s.TimeoutStop)
+	}
+}
+
+// validate fills in the defaults of the supervisor's configuration and checks
+// it, without starting anything.
+func (s *Supervisor) validate() error {
+	if s.TimeoutStop == 0 {
+		s.TimeoutStop = 5 * time.Second
+	}
+	if s.TimeoutRespawn == 0 {
+		s.TimeoutRespawn = 5 * time.Second
+	}
+	if s.AdaptiveTimeout && s.MaxTimeoutStop == 0 {
+		s.MaxTimeoutStop = time.Minute
+	}
+	if p := filepath.Clean(s.BootStampFile); p == "/proc" || strings.HasPrefix(p, "/proc/") {
+		return fmt.Errorf("boot stamp file %s is in procfs", s.BootStampFile)
+	}
+	if s.ProcessPriority < -20 || s.ProcessPriority > 19 {
+		return fmt.Errorf("process priority %d out of range [-20, 19]", s.ProcessPriority)
+	}
+	if s.LogSampleRate < 0 || s.LogSampleRate > 1 {
+		return fmt.Errorf("log sample rate %v out of range [0, 1]", s.LogSampleRate)
+	}
+	if s.LogSampleReportInterval == 0 {
+		s.LogSampleReportInterval = time.Minute
+	}
+	if s.StartupProbeTimeout == 0 {
+		s.StartupProbeTimeout = time.Minute
+	}
+	if s.StartupProbeInterval == 0 {
+		s.StartupProbeInterval = time.Second
+	}
+	if s.HeartbeatInterval == 0 {
+		s.HeartbeatInterval = 10 * time.Second
+	}
+	if s.ResourceMetrics.PollInterval == 0 {
+		s.ResourceMetrics.PollInterval = 10 * time.Second
+	}
+	if s.ResourceMetrics.MetricsRegisterer != nil && runtime.GOOS != "linux" {
+		return fmt.Errorf("resource metrics are not supported on %s", runtime.GOOS)
+	}
+	if s.TerminationLogMaxBytes == 0 {
+		s.TerminationLogMaxBytes = defaultTerminationLogMaxBytes
+	}
+	if s.PerfSampleInterval == 0 {
+		s.PerfSampleInterval = 10 * time.Second
+	}
+	if err := s.validatePerfCounters(); err != nil {
+		return err
+	}
+	if err := s.validateCgroupCPUQuota(); err != nil {
+		return err
+	}
+	if err := s.validateCgroupIOMax(); err != nil {
+		return err
+	}
+	if err := s.validateSandbox(); err != nil {
+		return err
+	}
+	if err := s.validateSocatProxy(); err != nil {
+		return err
+	}
+	if err := s.validateConfigMap(); err != nil {
+		return err
+	}
+	if err := s.validateBinaryChecksum(); err != nil {
+		return err
+	}
+	if err := s.validateBinarySignature(); err != nil {
+		return err
+	}
+	if err := s.validateLease(); err != nil {
+		return err
+	}
+	if err := s.validateNetworkPolicy(); err != nil {
+		return err
+	}
+	if s.ChildSubreaper && runtime.GOOS != "linux" {
+		return fmt.Errorf("child subreapers are not supported on %s", runtime.GOOS)
+	}
+	if len(s.MountBinds) > 0 && runtime.GOOS != "linux" {
+		return fmt.Errorf("bind mounts are not supported on %s", runtime.GOOS)
+	}
+	if err := s.validateMountBinds(); err != nil {
+		return err
+	}
+	if err := validateTracePropagationFormat(s.TracePropagationFormat); err != nil {
+		return err
+	}
+	if s.KillProcessGroup && runtime.GOOS == "windows" {
+		return errors.New("process groups are not supported on windows")
+	}
+	if s.SyslogIdentifier != "" && runtime.GOOS == "windows" {
+		return errors.New("syslog is not supported on windows")
+	}
+	if s.CoredumpFilter != 0 && runtime.GOOS != "linux" {
+		return fmt.Errorf("core dump filters are not supported on %s", runtime.GOOS)
+	}
+	if s.OpenFilesLimit != 0 && runtime.GOOS != "linux" {
+		return fmt.Errorf("open files limits are not supported on %s", runtime.GOOS)
+	}
+	if err := s.validateInheritedListeners(); err != nil {
+		return err
+	}
+	if s.EventRecorder != nil && s.NodeRef == nil {
+		return errors.New("a node reference is required to record events")
+	}
+	return nil
+}
+
 // Supervise Starts supervising the given process
 func (s *Supervisor) Supervise() error {
+	return s.SuperviseContext(context.Background())
+}
+
+// SuperviseContext starts supervising the given process, just like Supervise.
+// If PropagateTrace is set, the span context of traceCtx, if any, is passed on
+// to the supervised process. Apart from that, traceCtx is not retained, i.e.
+// supervision continues after it's done.
+func (s *Supervisor) SuperviseContext(traceCtx context.Context) error {
 	s.startStopMutex.Lock()
 	defer s.startStopMutex.Unlock()
 	// check if it is already started
@@ -125,113 +692,579 @@ func (s *Supervisor) Supervise() error {
 		s.log.Warn("Already started")
 		return nil
 	}
-	s.log = logrus.WithField("component", s.Name)
+	s.mutex.Lock()
+	supplied := s.serializableFieldsLocked()
+	s.mutex.Unlock()
+	defer s.recordDerivedFields(supplied)
+	s.spanContext = trace.SpanContextFromContext(traceCtx)
+	if s.DisableLogging {
+		log := logrus.New()
+		log.SetOutput(io.Discard)
+		log.SetLevel(logrus.PanicLevel)
+		s.log = log.WithField("component", s.Name)
+	} else {
+		s.log = logrus.WithField("component", s.Name)
+		if s.LogFormat != "" {
+			log, err := newFormattedLogger(s.LogFormat)
+			if err != nil {
+				return err
+			}
+			s.log = log.WithField("component", s.Name)
+		}
+	}
+	s.mutex.Lock()
+	if len(s.Annotations) > 0 {
+		s.log = s.log.WithFields(s.annotationFieldsLocked())
+	}
+	s.mutex.Unlock()
 	s.PidFile = path.Join(s.RunDir, s.Name) + ".pid"
 	if err := dir.Init(s.RunDir, constant.RunDirMode); err != nil {
 		s.log.Warnf("failed to initialize dir: %v", err)
 		return err
 	}
 
-	if s.TimeoutStop == 0 {
-		s.TimeoutStop = 5 * time.Second
+	if err := s.validate(); err != nil {
+		return err
 	}
-	if s.TimeoutRespawn == 0 {
-		s.TimeoutRespawn = 5 * time.Second
+	s.loadShutdowns()
+
+	// The process to be adopted is in the PID file.
+	if s.adoptee == nil {
+		if err := s.maybeKillPidFile(); err != nil {
+			return err
+		}
 	}
 
-	if err := s.maybeKillPidFile(); err != nil {
-		return err
+	// Undo everything acquired below, unless the supervisor loop took over.
+	cgroupPath, cgroupAcquired, supervising := s.CgroupPath, false, false
+	defer func() {
+		if supervising {
+			return
+		}
+		s.closeInheritedListeners()
+		s.closeLeaseClient()
+		s.closeLogFiles()
+		if cgroupAcquired {
+			s.leaveCgroupGroup()
+			s.CgroupPath = cgroupPath
+		}
+		s.closeNamedPipe()
+		if s.cancel != nil {
+			s.cancel()
+			s.cancel = nil
+		}
+	}()
+
+	if s.NamedPipeOutput != "" {
+		pipe, err := openNamedPipe(s.NamedPipeOutput, &s.droppedBytes)
+		if err != nil {
+			return err
+		}
+		s.namedPipe = pipe
+	}
+
+	if s.CgroupGroup != "" {
+		groupPath, err := DefaultCgroupGroupRegistry.acquire(s.CgroupGroup)
+		if err != nil {
+			return err
+		}
+		s.CgroupPath, cgroupAcquired = filepath.Join(groupPath, s.Name), true
 	}
 
+	s.mutex.Lock()
+	s.restarts = 0
+	if s.output == nil {
+		s.output = newOutputBuffer(maxOutputLines)
+	}
+	s.mutex.Unlock()
+
 	var ctx context.Context
 	ctx, s.cancel = context.WithCancel(context.Background())
+	if err := s.openLogFiles(ctx); err != nil {
+		return err
+	}
+	if err := s.openLeaseClient(); err != nil {
+		return err
+	}
+	if err := s.openInheritedListeners(); err != nil {
+		return err
+	}
+	adopted := s.adoptee != nil && s.adoptProcess()
 	started := make(chan error)
 	s.done = make(chan bool)
+	supervising = true
 
-	go func() {
+	// Label the goroutines of this supervisor, so that they can be told apart
+	// in profiles.
+	go pprof.Do(ctx, pprof.Labels("supervisor", s.Name), func(ctx context.Context) {
+		var monitors sync.WaitGroup
+		if s.MaxDiskUsageBytes > 0 {
+			monitors.Add(1)
+			go func() { defer monitors.Done(); s.monitorDiskUsage(ctx) }()
+		}
+		if len(s.AutoRestartOnFileChange) > 0 {
+			monitors.Add(1)
+			go func() { defer monitors.Done(); s.watchFiles(ctx) }()
+		}
+
+		restarts := 0
 		defer func() {
+			monitors.Wait()
+			s.closeLogFiles()
+			s.closeSyslog()
+			s.closeNamedPipe()
+			s.closeLeaseClient()
+			s.closeInheritedListeners()
+			if s.CgroupGroup != "" {
+				s.leaveCgroupGroup()
+			}
+			s.setState(ProcessStateStopped)
+			if restarts > 0 {
+				s.publishEvent(SupervisorStoppedEvent{Name: s.Name})
+				if s.OnStop != nil {
+					s.OnStop()
+				}
+			}
 			close(s.done)
 		}()
 
 		s.log.Info("Starting to supervise")
-		restarts := 0
-		for {
+		started := started
+		if adopted {
+			// The supervisor loop re-attaches to the adopted process.
+			started <- nil
+			started = nil
 			s.mutex.Lock()
-
-			var err error
-			if s.CleanBeforeFn != nil {
-				err = s.CleanBeforeFn()
+			restarts = s.restarts + 1
+			s.mutex.Unlock()
+		} else if s.StartupDelay > 0 {
+			// Let Supervise return, so that the supervisor can be stopped
+			// during the delay.
+			started <- nil
+			started = nil
+			s.log.Infof("Delaying start by %s", s.StartupDelay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.StartupDelay):
 			}
-			if err != nil {
-				s.log.Warnf("Failed to clean before running the process %s: %s", s.BinPath, err)
-			} else {
-				s.cmd = exec.Command(s.BinPath, s.Args...)
-				s.cmd.Dir = s.DataDir
-				s.cmd.Env = getEnv(s.DataDir, s.Name, s.KeepEnvPrefix)
-
-				// detach from the process group so children don't
-				// get signals sent directly to parent.
-				s.cmd.SysProcAttr = DetachAttr(s.UID, s.GID)
-
-				const maxLogChunkLen = 16 * 1024
-				s.cmd.Stdout = &logWriter{
-					log: s.log.WithField("stream", "stdout"),
-					buf: make([]byte, maxLogChunkLen),
+		}
+		for {
+			recovered := s.guard(func() { s.superviseLoop(ctx, started, &restarts) })
+			if recovered == nil {
+				return
+			}
+			if restarts == 0 && started != nil {
+				started <- fmt.Errorf("supervisor panicked: %v", recovered)
+				// Supervise will cancel the context now.
+				if s.waitResult != nil {
+					s.processWaitQuit(ctx)
 				}
-				s.cmd.Stderr = &logWriter{
-					log: s.log.WithField("stream", "stderr"),
-					buf: make([]byte, maxLogChunkLen),
+				return
+			}
+
+			s.log.Infof("Restarting supervisor in %s", guardRestartDelay)
+			select {
+			case <-ctx.Done():
+				if s.waitResult != nil {
+					s.processWaitQuit(ctx)
 				}
+				return
+			case <-time.After(guardRestartDelay):
+			}
+		}
+	})
+
+	if err := <-started; err != nil {
+		// Reset the supervisor, so that it may be started again.
+		s.cancel()
+		s.cancel = nil
+		<-s.done
+		if cgroupAcquired {
+			s.CgroupPath = cgroupPath
+		}
+		return err
+	}
+	s.started.Store(true)
+
+	if len(s.SocatProxy) > 0 {
+		if err := s.startSocatProxies(); err != nil {
+			s.log.WithError(err).Error("Failed to start port forwarding")
+		}
+	}
+
+	return nil
+}
+
+// newFormattedLogger creates a dedicated logger with the given format. It
+// inherits the output, level and hooks of the standard logger.
+func newFormattedLogger(format string) (*logrus.Logger, error) {
+	log := logrus.New()
+	switch format {
+	case "json":
+		log.SetFormatter(&logrus.JSONFormatter{})
+	case "text":
+		log.SetFormatter(&logrus.TextFormatter{})
+	default:
+		return nil, fmt.Errorf("unsupported log format: %q", format)
+	}
+
+	std := logrus.StandardLogger()
+	log.SetOutput(std.Out)
+	log.SetLevel(std.GetLevel())
+	log.ReplaceHooks(std.Hooks)
+	return log, nil
+}
+
+// guard runs fn and recovers from any panic, returning the recovered value.
+func (s *Supervisor) guard(fn func()) (recovered any) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			s.log.WithField("stack", string(debug.Stack())).Errorf("Supervisor panicked: %v", recovered)
+		}
+	}()
+	fn()
+	return nil
+}
 
-				err = s.cmd.Start()
+// absBinaryPath returns the absolute path of a binary executed in dir.
+func absBinaryPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	// Relative paths are evaluated relative to the working directory.
+	if abs, err := filepath.Abs(filepath.Join(dir, path)); err == nil {
+		return abs
+	}
+	return path
+}
+
+// runInBackground runs fn in a separate goroutine. The returned function
+// cancels the context passed to fn and waits for fn to return.
+func runInBackground(ctx context.Context, fn func(context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+	return func() { cancel(); <-done }
+}
+
+// superviseLoop keeps the supervised process running until ctx is done. If
+// the process of a previous, panicked loop is still running, the loop
+// re-attaches to it instead of starting a new one. The result of the first
+// start is sent to started, unless it's nil. Failed first starts are then
+// respawned like any other.
+func (s *Supervisor) superviseLoop(ctx context.Context, started chan<- error, restarts *int) {
+	for respawns := 0; ; respawns++ {
+		if s.waitResult != nil {
+			s.log.Infof("Re-attaching to pid %d", s.cmd.Process.Pid)
+			quit := s.processWaitQuit(ctx)
+			s.markUnready()
+			if quit {
+				return
 			}
-			s.mutex.Unlock()
-			if err != nil {
-				s.log.Warnf("Failed to start: %s", err)
-				if restarts == 0 {
-					started <- err
-					return
+			s.setState(ProcessStateRestarting)
+			s.checkBinary()
+		} else if err := s.startProcess(); err != nil {
+			if errors.Is(err, errChecksumMismatch) {
+				s.log.WithError(err).Error("Refusing to start a corrupted or tampered binary")
+				info := CrashInfo{Time: time.Now(), ExitCode: -1, Reason: CrashReasonChecksumMismatch}
+				s.recordCrash(info)
+				if s.OnCrash != nil {
+					s.OnCrash(info)
+				}
+			} else if errors.Is(err, errInvalidSignature) {
+				s.log.WithError(err).Error("Refusing to start a binary without a valid signature")
+				info := CrashInfo{Time: time.Now(), ExitCode: -1, Reason: CrashReasonInvalidSignature}
+				s.recordCrash(info)
+				if s.OnCrash != nil {
+					s.OnCrash(info)
 				}
 			} else {
-				err := os.WriteFile(s.PidFile, []byte(strconv.Itoa(s.cmd.Process.Pid)+"\n"), constant.PidFileMode)
-				if err != nil {
-					s.log.Warnf("Failed to write file %s: %v", s.PidFile, err)
+				s.log.Warnf("Failed to start: %s", err)
+			}
+			if *restarts == 0 && started != nil {
+				started <- err
+				return
+			}
+			s.setState(ProcessStateRestarting)
+		} else {
+			s.setState(ProcessStateRunning)
+			if s.ProcessPriority != 0 {
+				s.setPriority(s.cmd.Process.Pid)
+			}
+			if s.CoredumpFilter != 0 {
+				if err := setCoredumpFilter(s.cmd.Process.Pid, s.CoredumpFilter); err != nil {
+					s.log.WithError(err).Warn("Failed to set core dump filter")
 				}
-				if restarts == 0 {
-					s.log.Infof("Started successfully, go nuts pid %d", s.cmd.Process.Pid)
-					started <- nil
+			}
+			if s.OpenFilesLimit != 0 {
+				if err := setOpenFilesLimit(s.cmd.Process.Pid, s.OpenFilesLimit); err != nil {
+					s.log.WithError(err).Warn("Failed to set open files limit")
+				}
+			}
+			if s.CgroupPath != "" {
+				if err := s.joinCgroup(s.cmd.Process.Pid); err != nil {
+					s.log.WithError(err).Warn("Failed to join cgroup")
 				} else {
-					s.log.Infof("Restarted (%d)", restarts)
+					if s.CgroupCPUQuota > 0 {
+						if err := s.setCgroupCPUQuota(); err != nil {
+							s.log.WithError(err).Warn("Failed to set CPU quota")
+						}
+					}
+					if s.CgroupIOMax != "" {
+						if err := s.setCgroupIOMax(); err != nil {
+							s.log.WithError(err).Warn("Failed to set I/O limits")
+						}
+					}
+				}
+			}
+			if err := s.runPostStart(); err != nil {
+				// The process has been killed, and isn't considered started.
+				if *restarts == 0 && started != nil {
+					started <- err
+					// Supervise will cancel the context now.
+					s.processWaitQuit(ctx)
+					return
 				}
-				restarts++
 				if s.processWaitQuit(ctx) {
 					return
 				}
+			} else if s.superviseStarted(ctx, started, restarts) {
+				return
 			}
+			s.setState(ProcessStateRestarting)
+			s.checkBinary()
+		}
 
-			// TODO Maybe some backoff thingy would be nice
-			s.log.Infof("respawning in %s", s.TimeoutRespawn.String())
+		if s.MaxRestarts > 0 && respawns >= s.MaxRestarts {
+			s.log.Errorf("Giving up, as the maximum of %d restarts has been reached", s.MaxRestarts)
+			s.reportFailure()
+			return
+		}
 
-			select {
-			case <-ctx.Done():
-				s.log.Debug("respawn cancelled")
-				return
-			case <-time.After(s.TimeoutRespawn):
-				s.log.Debug("respawning")
+		// TODO Maybe some backoff thingy would be nice
+		s.log.Infof("respawning in %s", s.TimeoutRespawn.String())
+
+		select {
+		case <-ctx.Done():
+			s.log.Debug("respawn cancelled")
+			return
+		case <-time.After(s.TimeoutRespawn):
+			s.log.Debug("respawning")
+		}
+	}
+}
+
+// superviseStarted supervises the freshly started process, until it exited.
+// Returns whether the supervisor should quit.
+func (s *Supervisor) superviseStarted(ctx context.Context, started chan<- error, restarts *int) bool {
+	err := os.WriteFile(s.PidFile, []byte(strconv.Itoa(s.cmd.Process.Pid)+"\n"), constant.PidFileMode)
+	if err != nil {
+		s.log.Warnf("Failed to write file %s: %v", s.PidFile, err)
+	}
+	s.recordStartedEvent(s.cmd.Process.Pid)
+	s.recordStarted(s.cmd.Process.Pid, *restarts > 0)
+	if s.OnStart != nil {
+		s.OnStart(s.cmd.Process.Pid)
+	}
+	if *restarts == 0 {
+		s.log.Infof("Started successfully, go nuts pid %d", s.cmd.Process.Pid)
+		if started != nil {
+			started <- nil
+		}
+	} else {
+		s.log.Infof("Restarted (%d)", *restarts)
+		s.mutex.Lock()
+		s.restarts = *restarts
+		s.mutex.Unlock()
+	}
+	*restarts++
+	stopProbing := s.probeStartup(ctx, s.cmd.Process)
+	stopSlowStartWatch := s.watchSlowStart(ctx, s.cmd.Process.Pid)
+	stopHeartbeat := s.startHeartbeat(ctx)
+	stopLeaseRenewal := s.startLeaseRenewal(ctx)
+	stopPerfSampling := s.startPerfCounters(ctx, s.cmd.Process.Pid)
+	stopResourceMetrics := s.startResourceMetrics(ctx, s.cmd.Process.Pid)
+	quit := s.processWaitQuit(ctx)
+	s.writeTerminationLog()
+	stopResourceMetrics()
+	stopPerfSampling()
+	stopLeaseRenewal()
+	stopHeartbeat()
+	stopSlowStartWatch()
+	stopProbing()
+	s.markUnready()
+	return quit
+}
+
+// startProcess starts a new instance of the supervised process.
+func (s *Supervisor) startProcess() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.CleanBeforeFn != nil {
+		if err := s.CleanBeforeFn(); err != nil {
+			return fmt.Errorf("failed to clean before running the process %s: %w", s.BinPath, err)
+		}
+	}
+
+	args, configFile := s.Args, ""
+	if len(s.ConfigMap) > 0 {
+		if configFile, err = s.writeConfigFile(); err != nil {
+			return err
+		}
+		args = append(slices.Clip(args), s.ConfigFileArg, configFile)
+	}
+	removeConfigFile := func() {
+		if configFile != "" {
+			if err := os.Remove(configFile); err != nil {
+				s.log.WithError(err).Warn("Failed to remove config file")
 			}
 		}
+	}
+	// Once started, the file is removed after the process exited.
+	defer func() {
+		if err != nil {
+			removeConfigFile()
+		}
+	}()
+
+	cmd, err := s.newCmd(context.Background(), args)
+	if err != nil {
+		return err
+	}
+	s.log.Debugf("Starting %s with args %q", cmd.Path, s.loggableArgs(args))
+	binaryPath := cmd.Path
+	if s.ValidateBinaryChecksum && s.BinaryChecksum != "" {
+		if err := verifyChecksum(binaryPath, s.BinaryChecksum); err != nil {
+			return err
+		}
+	}
+	if s.RequireBinarySignature {
+		if err := verifySignature(binaryPath, s.signingKey); err != nil {
+			return err
+		}
+	}
+	if s.Sandbox == SandboxGVisor {
+		if err := wrapInGVisor(cmd, s.SandboxBinary); err != nil {
+			return err
+		}
+	}
+	if s.ChildSubreaper || len(s.MountBinds) > 0 {
+		if err := wrapInTrampoline(cmd, s.ChildSubreaper, s.MountBinds); err != nil {
+			return err
+		}
+	}
+	if s.SocketActivation {
+		s.passActivatedSockets(cmd)
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, s.listeners...)
+	if s.WarmRestartMode {
+		s.joinProcessGroup(cmd)
+	}
+	s.cmd = cmd
+	s.stopReason = ""
+	s.cmd.WaitDelay = s.WaitDelay
+
+	if s.TruncateStaleOutputFiles {
+		s.truncateStaleLogFiles()
+	}
+	s.logWriters = nil
+	if s.SyslogIdentifier != "" {
+		if err := s.reconnectSyslog(); err != nil {
+			return err
+		}
+		s.cmd.Stdout = s.syslogOut.stdout
+		s.cmd.Stderr = s.syslogOut.stderr
+	} else {
+		s.cmd.Stdout = s.outputWriter("stdout", s.stdoutFile, s.namedPipe)
+		s.cmd.Stderr = s.outputWriter("stderr", s.stderrFile, nil)
+	}
+	s.stdin = nil
+	if s.OpenStdin {
+		if s.stdin, err = s.cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+
+	if s.NetworkPolicy != nil {
+		if err := s.applyNetworkPolicy(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.startCmd(s.cmd); err != nil {
+		if s.NetworkPolicy != nil {
+			s.removeNetworkPolicy()
+		}
+		return err
+	}
+
+	// The executable can't be determined if the process has been started via
+	// a wrapper that replaces itself with the binary later on.
+	s.binaryPath, s.binaryInode = absBinaryPath(cmd.Dir, binaryPath), 0
+	if s.cmd.Path == binaryPath {
+		s.binaryInode = executableInode(s.log, s.cmd.Process.Pid)
+	}
+	if s.WarmRestartMode && s.processGroup == 0 {
+		s.processGroup = s.cmd.Process.Pid
+	}
+
+	// Wait for the process in the background. The result is buffered, so
+	// that a re-attached supervisor loop is able to pick it up.
+	waitResult, cmd := make(chan error, 1), s.cmd
+	go func() {
+		err := cmd.Wait()
+		removeConfigFile()
+		if s.NetworkPolicy != nil {
+			s.removeNetworkPolicy()
+		}
+		waitResult <- err
 	}()
-	return <-started
+	s.waitResult = waitResult
+
+	return nil
+}
+
+// SuperviseWithRetry calls Supervise up to attempts times, until it succeeds
+// or ctx is done. This bridges short windows in which the binary is not
+// available, e.g. while it's being replaced during an upgrade. The span
+// context of ctx is propagated as described for SuperviseContext.
+func (s *Supervisor) SuperviseWithRetry(ctx context.Context, attempts int) error {
+	const retryDelay = 500 * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		err := s.SuperviseContext(ctx)
+		if err == nil || attempt >= attempts {
+			return err
+		}
+
+		s.log.WithError(err).Infof("Failed to start, retrying in %s (attempt %d of %d)", retryDelay, attempt+1, attempts)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-time.After(retryDelay):
+		}
+	}
 }
 
 // Stop stops the supervised
-func (s *Supervisor) Stop() error {
+func (s *Supervisor) Stop() (err error) {
+	defer func() { s.audit("Stop", err) }()
 	s.startStopMutex.Lock()
 	defer s.startStopMutex.Unlock()
-	if s.cancel == nil || s.log == nil {
-		s.log.Warn("Not started")
+	if s.cancel == nil {
+		if !s.started.Load() {
+			return ErrNotStarted
+		}
+		s.log.Warn("Already stopped")
 		return nil
 	}
+	s.detachDebugger()
+	s.stopSidecars()
 	s.log.Debug("Sending stop message")
 
 	s.cancel()
@@ -243,54 +1276,226 @@ func (s *Supervisor) Stop() error {
 	return nil
 }
 
+// IsRunning returns whether the supervisor has been started and hasn't been
+// stopped since. Note that the supervised process itself might be about to be
+// respawned.
+func (s *Supervisor) IsRunning() bool {
+	s.startStopMutex.Lock()
+	defer s.startStopMutex.Unlock()
+	return s.cancel != nil
+}
+
+// errNotRunning returns the error for operations that require the supervised
+// process to be running, depending on whether Supervise has ever been called.
+func (s *Supervisor) errNotRunning() error {
+	if !s.started.Load() {
+		return ErrNotStarted
+	}
+	return ErrNotRunning
+}
+
+// outputWriter returns the writer for the given output stream of the
+// supervised process. The caller needs to hold s.mutex.
+func (s *Supervisor) outputWriter(stream string, file *logFile, pipe *namedPipe) io.Writer {
+	const maxLogChunkLen = 16 * 1024
+	w := &logWriter{
+		buf:           make([]byte, maxLogChunkLen),
+		output:        s.output,
+		capturePanics: s.CapturePanicOutput,
+
+		sampleRate:     s.LogSampleRate,
+		reportInterval: s.LogSampleReportInterval,
+		reportedAt:     time.Now(),
+	}
+	// Without logging, the output is still remembered for termination logs
+	// and crash reports.
+	if !s.DisableLogging {
+		// Include the annotations that have been added in the meantime.
+		w.log = s.log.WithFields(s.annotationFieldsLocked()).WithField("stream", stream)
+	}
+	s.logWriters = append(s.logWriters, w)
+	writers := []io.Writer{w}
+	if file != nil {
+		writers = append(writers, file)
+	}
+	if pipe != nil {
+		writers = append(writers, pipe)
+	}
+
+	if len(writers) == 1 {
+		return writers[0]
+	}
+	return io.MultiWriter(writers...)
+}
+
+// DroppedBytes returns the number of bytes of output that couldn't be written
+// to NamedPipeOutput.
+func (s *Supervisor) DroppedBytes() int64 {
+	return s.droppedBytes.Load()
+}
+
+func (s *Supervisor) closeNamedPipe() {
+	if s.namedPipe == nil {
+		return
+	}
+	if err := s.namedPipe.Close(); err != nil {
+		s.log.WithError(err).Warnf("Failed to close named pipe %s", s.NamedPipeOutput)
+	}
+	s.namedPipe = nil
+}
+
+// flushLogWriters flushes the log writers of the exited process.
+func (s *Supervisor) flushLogWriters() {
+	for _, w := range s.logWriters {
+		w.flush()
+	}
+	if s.syslogOut != nil {
+		s.syslogOut.flush()
+	}
+}
+
+// newCmd prepares a command that executes the supervisor's binary with the
+// given args in the environment of the supervised process. The command is
+// bound to ctx, see [exec.CommandContext].
+func (s *Supervisor) newCmd(ctx context.Context, args []string) (*exec.Cmd, error) {
+	var fileEnv []string
+	if s.EnvironmentFile != "" {
+		var err error
+		if fileEnv, err = parseEnvFile(s.EnvironmentFile); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, s.BinPath, args...)
+	cmd.Dir = s.DataDir
+	if s.IncludeParentEnv == nil || *s.IncludeParentEnv {
+		cmd.Env = getEnv(s.DataDir, s.Name, s.KeepEnvPrefix, fileEnv)
+	} else {
+		cmd.Env = getCleanEnv(s.DataDir, s.Name, s.KeepEnvPrefix, fileEnv)
+	}
+	if s.PropagateTrace {
+		cmd.Env = append(cmd.Env, traceEnv(s.spanContext, s.TracePropagationFormat)...)
+	}
+
+	// detach from the process group so children don't
+	// get signals sent directly to parent.
+	cmd.SysProcAttr = DetachAttr(s.UID, s.GID)
+
+	return cmd, nil
+}
+
+// Exec runs the supervisor's binary once with the given args in the same
+// environment as the supervised process, and waits for it to exit. Its output
+// is written to ExecStdout and ExecStderr.
+func (s *Supervisor) Exec(args ...string) error {
+	return s.ExecContext(context.Background(), args...)
+}
+
+// ExecContext is like Exec, but terminates the binary gracefully once ctx is
+// done: It's sent SIGTERM first, and killed if it's still running after
+// TimeoutStop. On Windows, it's killed right away.
+func (s *Supervisor) ExecContext(ctx context.Context, args ...string) error {
+	cmd, err := s.newCmd(ctx, args)
+	if err != nil {
+		return err
+	}
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	if cmd.WaitDelay = s.TimeoutStop; cmd.WaitDelay == 0 {
+		cmd.WaitDelay = 5 * time.Second
+	}
+	cmd.Stdout = s.ExecStdout
+	cmd.Stderr = s.ExecStderr
+	if err := s.startCmd(cmd); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+// startCmd starts cmd, inside the network namespace at NetNSPath, if any.
+func (s *Supervisor) startCmd(cmd *exec.Cmd) error {
+	if s.NetNSPath == "" {
+		return cmd.Start()
+	}
+	return startInNetNS(cmd, s.NetNSPath)
+}
+
 // Prepare the env for exec:
+// - merge the env from the environment file, if any
 // - handle component specific env
 // - inject k0s embedded bins into path
-func getEnv(dataDir, component string, keepEnvPrefix bool) []string {
-	env := os.Environ()
-	componentPrefix := fmt.Sprintf("%s_", strings.ToUpper(component))
+func getEnv(dataDir, component string, keepEnvPrefix bool, fileEnv []string) []string {
+	return buildEnv(os.Environ(), dataDir, component, keepEnvPrefix, fileEnv)
+}
 
-	// put the component specific env vars in the front.
-	sort.Slice(env, func(i, j int) bool { return strings.HasPrefix(env[i], componentPrefix) })
+// getCleanEnv is like getEnv, but ignores the environment of k0s. PATH only
+// contains the bin directory in the data dir, unless it's set by fileEnv.
+func getCleanEnv(dataDir, component string, keepEnvPrefix bool, fileEnv []string) []string {
+	env := buildEnv(nil, dataDir, component, keepEnvPrefix, fileEnv)
+	if !slices.ContainsFunc(env, func(e string) bool { return strings.HasPrefix(e, "PATH=") }) {
+		env = append(env, "PATH="+path.Join(dataDir, "bin"))
+	}
+	return env
+}
 
-	overrides := map[string]struct{}{}
-	i := 0
-	for _, e := range env {
-		kv := strings.SplitN(e, "=", 2)
-		k, v := kv[0], kv[1]
-		// if there is already a correspondent component specific env, skip it.
-		if _, ok := overrides[k]; ok {
-			continue
+func buildEnv(parentEnv []string, dataDir, component string, keepEnvPrefix bool, fileEnv []string) []string {
+	env := mergeEnv(parentEnv, fileEnv)
+	componentPrefix := fmt.Sprintf("%s_", strings.ToUpper(component))
+	managedKey, _, _ := strings.Cut(k0sManaged, "=")
+
+	// Determines the generic env var that a component specific one overrides.
+	override := func(k string) (string, bool) {
+		k1, ok := strings.CutPrefix(k, componentPrefix)
+		if !ok || k1 == "" || k1 == managedKey {
+			return "", false
 		}
-		if strings.HasPrefix(k, componentPrefix) {
-			var shouldOverride bool
-			k1 := strings.TrimPrefix(k, componentPrefix)
-			switch k1 {
-			// always override proxy env
-			case "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY":
-				shouldOverride = true
-			default:
-				if !keepEnvPrefix {
-					shouldOverride = true
-				}
-			}
-			if shouldOverride {
-				k = k1
-				overrides[k] = struct{}{}
-			}
+		switch k1 {
+		// always override proxy env
+		case "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY":
+			return k1, true
+		default:
+			return k1, !keepEnvPrefix
 		}
+	}
+
+	result := make([]string, 0, len(env)+1)
+	result = append(result, k0sManaged)
+	add := func(k, v string) {
 		switch k {
 		case "PATH":
-			env[i] = fmt.Sprintf("PATH=%s", dir.PathListJoin(path.Join(dataDir, "bin"), v))
+			result = append(result, fmt.Sprintf("PATH=%s", dir.PathListJoin(path.Join(dataDir, "bin"), v)))
 		default:
-			env[i] = fmt.Sprintf("%s=%s", k, v)
+			result = append(result, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	// put the component specific env vars in the front.
+	overrides := map[string]struct{}{}
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		if k1, ok := override(k); ok {
+			overrides[k1] = struct{}{}
+			add(k1, v)
+		}
+	}
+
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		if _, ok := override(k); ok {
+			continue
+		}
+		// if there is already a correspondent component specific env, skip it.
+		if _, ok := overrides[k]; ok || k == managedKey {
+			continue
 		}
-		i++
+		add(k, v)
 	}
-	env = append([]string{k0sManaged}, env...)
-	i++
 
-	return env[:i]
+	return result
 }
 
 // GetProcess returns the last started process
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func FuzzGetEnv(f *testing.F) {
+	// getEnv merges the given env into the environment of the test process.
+	// Clear it, so that the fuzzer has full control.
+	oldEnv := os.Environ()
+	f.Cleanup(func() {
+		os.Clearenv()
+		for _, e := range oldEnv {
+			key, val, _ := strings.Cut(e, "=")
+			assert.NoError(f, os.Setenv(key, val))
+		}
+	})
+	os.Clearenv()
+
+	for _, seed := range []struct {
+		env           []string
+		component     string
+		keepEnvPrefix bool
+	}{
+		{[]string{"PATH=/usr/bin:/bin", "HOME=/root"}, "kubelet", false},
+		{[]string{"PATH=/bin", "ETCD_PATH=/usr/local/bin", "ETCD_DATA_DIR=/var/lib/etcd"}, "etcd", true},
+		{[]string{"HTTPS_PROXY=1.2.3.4:8888", "KUBELET_HTTPS_PROXY=a.b.c:1080", "KUBELET_NO_PROXY=10.0.0.0/8"}, "kubelet", true},
+		{[]string{"FOO_FOO_BAR=1", "FOO_BAR=2", "BAR=3"}, "foo", false},
+		{[]string{"_K0S_MANAGED=no", "FOO__K0S_MANAGED=no", "FOO_=empty"}, "foo", false},
+		{[]string{"k1=v1", "k1=v2", "FOO_k1=foo_v1"}, "foo", false},
+	} {
+		f.Add(strings.Join(seed.env, "\n"), seed.component, seed.keepEnvPrefix)
+	}
+
+	dataDir := filepath.Join("var", "lib", "k0s")
+	binDir := path.Join(dataDir, "bin")
+
+	f.Fuzz(func(t *testing.T, rawEnv, component string, keepEnvPrefix bool) {
+		var env []string
+		for _, e := range strings.Split(rawEnv, "\n") {
+			// Keys may neither be empty nor contain NUL bytes.
+			if k, _, ok := strings.Cut(e, "="); ok && k != "" && !strings.ContainsRune(e, 0) {
+				env = append(env, e)
+			}
+		}
+		if strings.Contains(rawEnv, binDir) {
+			t.Skip("The environment already contains the bin directory")
+		}
+
+		actual := getEnv(dataDir, component, keepEnvPrefix, env)
+		assert.Equal(t, actual, getEnv(dataDir, component, keepEnvPrefix, env), "Not deterministic")
+
+		actualVars := make(map[string]string, len(actual))
+		for _, e := range actual {
+			k, v, ok := strings.Cut(e, "=")
+			require.True(t, ok, "Not a key/value pair: %q", e)
+			require.NotContains(t, actualVars, k, "Duplicate key %q in %v", k, actual)
+			actualVars[k] = v
+		}
+
+		// The last occurrence of a key in the input wins.
+		inputVars := make(map[string]string, len(env))
+		for _, e := range env {
+			k, v, _ := strings.Cut(e, "=")
+			inputVars[k] = v
+		}
+
+		// Component specific vars override generic ones.
+		prefix := strings.ToUpper(component) + "_"
+		override := func(k string) (string, bool) {
+			k, ok := strings.CutPrefix(k, prefix)
+			if !ok || k == "" || k == "_K0S_MANAGED" {
+				return "", false
+			}
+			switch k {
+			case "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY":
+				return k, true
+			default:
+				return k, !keepEnvPrefix
+			}
+		}
+		expected := make(map[string]string, len(inputVars))
+		for k, v := range inputVars {
+			if _, ok := override(k); !ok {
+				expected[k] = v
+			}
+		}
+		for k, v := range inputVars {
+			if k, ok := override(k); ok {
+				expected[k] = v
+			}
+		}
+		if p, ok := expected["PATH"]; ok {
+			expected["PATH"] = binDir + string(os.PathListSeparator) + p
+		}
+		expected["_K0S_MANAGED"] = "yes"
+
+		assert.Equal(t, expected, actualVars)
+
+		if p, ok := actualVars["PATH"]; ok {
+			var binDirs int
+			for _, elem := range filepath.SplitList(p) {
+				if elem == binDir {
+					binDirs++
+				}
+			}
+			assert.Equal(t, 1, binDirs, "The bin directory should be in PATH exactly once: %q", p)
+		}
+	})
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package supervisor
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -24,6 +26,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"runtime/pprof"
 	"sort"
 	"strings"
 	"sync"
@@ -32,6 +35,8 @@ import (
 	"time"
 
 	"github.com/k0sproject/k0s/internal/testutil/pingpong"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -94,10 +99,11 @@ func TestSupervisorStart(t *testing.T) {
 			err := s.proc.Supervise()
 			if s.expectedErrMsg != "" {
 				assert.ErrorContains(t, err, s.expectedErrMsg)
+				assert.ErrorIs(t, s.proc.Stop(), ErrNotStarted)
 			} else {
 				assert.NoError(t, err, "Failed to start")
+				assert.NoError(t, s.proc.Stop(), "Failed to stop")
 			}
-			assert.NoError(t, s.proc.Stop(), "Failed to stop")
 		})
 	}
 }
@@ -124,13 +130,13 @@ func TestGetEnv(t *testing.T) {
 	t.Setenv("k1", "v1")
 	t.Setenv("FOO_PATH", "/usr/local/bin")
 
-	env := getEnv("/var/lib/k0s", "foo", false)
+	env := getEnv("/var/lib/k0s", "foo", false, nil)
 	sort.Strings(env)
 	expected := fmt.Sprintf("[HTTPS_PROXY=a.b.c:1080 PATH=/var/lib/k0s/bin%c/usr/local/bin _K0S_MANAGED=yes k1=v1 k2=foo_v2 k3=foo_v3 k4=v4]", os.PathListSeparator)
 	actual := fmt.Sprintf("%s", env)
 	assert.Equal(t, expected, actual)
 
-	env = getEnv("/var/lib/k0s", "foo", true)
+	env = getEnv("/var/lib/k0s", "foo", true, nil)
 	sort.Strings(env)
 	expected = fmt.Sprintf("[FOO_PATH=/usr/local/bin FOO_k2=foo_v2 FOO_k3=foo_v3 HTTPS_PROXY=a.b.c:1080 PATH=/var/lib/k0s/bin%c/bin _K0S_MANAGED=yes k1=v1 k2=v2 k3=v3 k4=v4]", os.PathListSeparator)
 	actual = fmt.Sprintf("%s", env)
@@ -240,6 +246,36 @@ func TestMultiThread(t *testing.T) {
 	wg.Wait()
 }
 
+func TestDisableLogging(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	hook := new(logtest.Hook)
+	std := logrus.StandardLogger()
+	oldHooks := std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	t.Cleanup(func() { std.ReplaceHooks(oldHooks) })
+
+	done := filepath.Join(t.TempDir(), "done")
+	sh := selectCmd(t, cmd{"sh", []string{"-c", `echo out; echo err >&2; touch "$1"; exec sleep 60`, "sh", done}})
+	s := Supervisor{
+		Name:           "supervisor-test-disable-logging",
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		DisableLogging: true,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(done)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Empty(t, hook.AllEntries())
+}
+
 func TestCleanupPIDFile_Gracefully(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("PID file cleanup not yet implemented on Windows")
@@ -398,6 +434,456 @@ func TestCleanupPIDFile_BogusPIDFile(t *testing.T) {
 	assert.ErrorContains(t, s.Supervise(), `"rubbish": invalid`)
 }
 
+func TestCleanupPIDFile_PreviousBoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("PID file cleanup not yet implemented on Windows")
+	}
+
+	pingPong := pingpong.New(t)
+	s := Supervisor{
+		Name:          t.Name(),
+		BinPath:       pingPong.BinPath(),
+		RunDir:        t.TempDir(),
+		Args:          pingPong.BinArgs(),
+		BootStampFile: filepath.Join(t.TempDir(), "boot"),
+	}
+
+	// Create a bogus PID file that predates the boot stamp.
+	pidFilePath := filepath.Join(s.RunDir, s.Name+".pid")
+	require.NoError(t, os.WriteFile(pidFilePath, []byte("rubbish"), 0644))
+	require.NoError(t, os.WriteFile(s.BootStampFile, nil, 0644))
+	past := time.Now().Add(-1 * time.Hour)
+	require.NoError(t, os.Chtimes(pidFilePath, past, past))
+
+	// Expect the stale PID file to be ignored.
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	if pid, err := os.ReadFile(pidFilePath); assert.NoError(t, err, "Failed to read PID file") {
+		assert.Equal(t, []byte(fmt.Sprintf("%d\n", s.cmd.Process.Pid)), pid)
+	}
+}
+
+func TestCleanupPIDFile_MissingBootStamp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("PID file cleanup not yet implemented on Windows")
+	}
+
+	s := Supervisor{
+		Name:          t.Name(),
+		BinPath:       "/bin/sh",
+		RunDir:        t.TempDir(),
+		BootStampFile: filepath.Join(t.TempDir(), "boot"),
+	}
+
+	// Create a bogus PID file, which can't be stale without a boot stamp.
+	pidFilePath := filepath.Join(s.RunDir, s.Name+".pid")
+	require.NoError(t, os.WriteFile(pidFilePath, []byte("rubbish"), 0644))
+
+	// Expect the supervisor to try to parse it.
+	assert.ErrorContains(t, s.Supervise(), `"rubbish": invalid`)
+}
+
+func TestCleanupPIDFile_ProcFSBootStamp(t *testing.T) {
+	s := Supervisor{
+		Name:          t.Name(),
+		BinPath:       "/bin/sh",
+		RunDir:        t.TempDir(),
+		BootStampFile: "/proc/stat",
+	}
+
+	assert.ErrorContains(t, s.Supervise(), "boot stamp file /proc/stat is in procfs")
+}
+
+func TestSuperviseWithRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test relies on symlinks")
+	}
+
+	sleep := selectCmd(t, cmd{"sleep", []string{"60"}})
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: filepath.Join(t.TempDir(), "sleep"),
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}
+
+	// Give up after exceeding the attempts.
+	assert.ErrorContains(t, s.SuperviseWithRetry(context.TODO(), 2), "no such file or directory")
+
+	// Make the binary available while retrying.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, os.Symlink(sleep.binPath, s.BinPath))
+	}()
+	require.NoError(t, s.SuperviseWithRetry(context.TODO(), 10))
+	assert.NoError(t, s.Stop())
+}
+
+func TestWaitDelay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	// The background process inherits stdout and keeps it open.
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "sleep 5 & exit 0"}})
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Hour,
+		WaitDelay:      100 * time.Millisecond,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	assert.Eventually(t, func() bool {
+		return s.Snapshot().State == ProcessStateRestarting
+	}, 3*time.Second, 50*time.Millisecond, "Process exit not detected")
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	t.Setenv("FOO_BAR", "baz")
+	sh := selectCmd(t, cmd{"sh", nil})
+	dataDir := t.TempDir()
+	var stdout, stderr strings.Builder
+	s := Supervisor{
+		Name:       "foo",
+		BinPath:    sh.binPath,
+		DataDir:    dataDir,
+		ExecStdout: &stdout,
+		ExecStderr: &stderr,
+	}
+
+	require.NoError(t, s.Exec("-c", `echo "$BAR $PWD"; echo err >&2`))
+	assert.Equal(t, "baz "+dataDir+"\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+
+	assert.ErrorContains(t, s.Exec("-c", "exit 3"), "exit status 3")
+}
+
+func TestExecContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	sh := selectCmd(t, cmd{"sh", nil})
+
+	t.Run("terminates", func(t *testing.T) {
+		var stdout strings.Builder
+		s := Supervisor{Name: t.Name(), BinPath: sh.binPath, ExecStdout: &stdout}
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		err := s.ExecContext(ctx, "-c", `trap 'kill $!; echo terminated; exit 0' TERM; sleep 10 >/dev/null & wait`)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, "terminated\n", stdout.String())
+	})
+
+	t.Run("kills", func(t *testing.T) {
+		s := Supervisor{Name: t.Name(), BinPath: sh.binPath, TimeoutStop: 100 * time.Millisecond}
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		start := time.Now()
+		err := s.ExecContext(ctx, "-c", `trap '' TERM; while :; do sleep 0.01; done`)
+		assert.ErrorContains(t, err, "signal: killed")
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestGuard_PanicOnFirstStart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Probing processes via the null signal is not supported on Windows")
+	}
+
+	pingPong := pingpong.New(t)
+
+	var process *os.Process
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: pingPong.BinPath(),
+		RunDir:  t.TempDir(),
+		Args:    pingPong.BinArgs(),
+	}
+	s.OnStart = func(int) {
+		process = s.cmd.Process
+		panic("boom")
+	}
+
+	assert.ErrorContains(t, s.Supervise(), "supervisor panicked: boom")
+	require.NotNil(t, process)
+	assert.ErrorIs(t, process.Signal(syscall.Signal(0)), os.ErrProcessDone, "Process should have been terminated")
+}
+
+func TestGuard_ReattachAfterPanic(t *testing.T) {
+	oldDelay := guardRestartDelay
+	guardRestartDelay = 1 * time.Millisecond
+	t.Cleanup(func() { guardRestartDelay = oldDelay })
+
+	pingPong := pingpong.New(t)
+
+	var starts int
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        pingPong.BinPath(),
+		RunDir:         t.TempDir(),
+		Args:           pingPong.BinArgs(),
+		TimeoutRespawn: 1 * time.Millisecond,
+		OnStart: func(int) {
+			if starts++; starts == 2 {
+				panic("boom")
+			}
+		},
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	// Let the first process exit, so that the second start panics.
+	require.NoError(t, pingPong.AwaitPing())
+	require.NoError(t, pingPong.SendPong())
+
+	// The second process is still alive and gets re-attached.
+	require.NoError(t, pingPong.AwaitPing())
+	process := s.GetProcess()
+	require.NoError(t, pingPong.SendPong())
+
+	// The supervisor keeps respawning.
+	require.NoError(t, pingPong.AwaitPing())
+	assert.NotEqual(t, process.Pid, s.GetProcess().Pid, "Respawn failed")
+	assert.Equal(t, 3, starts)
+}
+
+func TestProcessPriority_OutOfRange(t *testing.T) {
+	s := Supervisor{
+		Name:            t.Name(),
+		BinPath:         filepath.Join(t.TempDir(), "foo"),
+		RunDir:          t.TempDir(),
+		ProcessPriority: 20,
+	}
+
+	assert.ErrorContains(t, s.Supervise(), "process priority 20 out of range")
+}
+
+func TestLogFormat(t *testing.T) {
+	s := Supervisor{
+		Name:      t.Name(),
+		BinPath:   filepath.Join(t.TempDir(), "foo"),
+		RunDir:    t.TempDir(),
+		LogFormat: "yaml",
+	}
+	assert.ErrorContains(t, s.Supervise(), `unsupported log format: "yaml"`)
+
+	log, err := newFormattedLogger("json")
+	require.NoError(t, err)
+	var out strings.Builder
+	log.SetOutput(&out)
+	log.WithField("component", "foo").Info("bar")
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &entry))
+	assert.Equal(t, "foo", entry["component"])
+	assert.Equal(t, "bar", entry["msg"])
+}
+
+func TestStartupDelay(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	t.Run("delays_start", func(t *testing.T) {
+		started := make(chan time.Time, 1)
+		s := Supervisor{
+			Name:         t.Name(),
+			BinPath:      sleep.binPath,
+			Args:         sleep.binArgs,
+			RunDir:       t.TempDir(),
+			StartupDelay: 200 * time.Millisecond,
+			OnStart:      func(int) { started <- time.Now() },
+		}
+
+		before := time.Now()
+		require.NoError(t, s.Supervise())
+		t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+		assert.Less(t, time.Since(before), s.StartupDelay, "Supervise should return right away")
+
+		select {
+		case startedAt := <-started:
+			assert.GreaterOrEqual(t, startedAt.Sub(before), s.StartupDelay)
+		case <-time.After(10 * time.Second):
+			assert.Fail(t, "Process hasn't been started")
+		}
+	})
+
+	t.Run("stop_during_delay", func(t *testing.T) {
+		s := Supervisor{
+			Name:         t.Name(),
+			BinPath:      sleep.binPath,
+			Args:         sleep.binArgs,
+			RunDir:       t.TempDir(),
+			StartupDelay: time.Hour,
+			OnStart:      func(int) { assert.Fail(t, "Process shouldn't be started") },
+		}
+
+		require.NoError(t, s.Supervise())
+		require.NoError(t, s.Stop())
+		assert.Equal(t, ProcessStateStopped, s.Snapshot().State)
+	})
+
+	t.Run("respawns_failed_start", func(t *testing.T) {
+		s := Supervisor{
+			Name:           t.Name(),
+			BinPath:        filepath.Join(t.TempDir(), "missing"),
+			RunDir:         t.TempDir(),
+			StartupDelay:   time.Millisecond,
+			TimeoutRespawn: time.Millisecond,
+		}
+
+		require.NoError(t, s.Supervise())
+		t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+		assert.Eventually(t, func() bool {
+			return s.Snapshot().State == ProcessStateRestarting
+		}, 10*time.Second, time.Millisecond)
+	})
+}
+
+func TestNotStarted(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}
+
+	assertNotRunning := func(t *testing.T, started bool) {
+		assert.False(t, s.IsRunning())
+
+		for name, err := range map[string]error{
+			"Freeze": s.Freeze(),
+			"SetUID": s.SetUID(os.Getuid()),
+			"SetGID": s.SetGID(os.Getgid()),
+			"GetResourceUsage": func() error {
+				_, err := s.GetResourceUsage()
+				return err
+			}(),
+			"Attach": new(SupervisorDebugger).Attach(&s, "127.0.0.1:0"),
+		} {
+			assert.ErrorIs(t, err, ErrNotRunning, name)
+			if started {
+				assert.NotErrorIs(t, err, ErrNotStarted, name)
+			} else {
+				assert.ErrorIs(t, err, ErrNotStarted, name)
+			}
+		}
+	}
+
+	t.Run("before_supervise", func(t *testing.T) {
+		assertNotRunning(t, false)
+		assert.Nil(t, s.GetProcess())
+		assert.ErrorIs(t, s.Stop(), ErrNotStarted)
+	})
+
+	t.Run("after_failed_supervise", func(t *testing.T) {
+		s := Supervisor{
+			Name:    t.Name(),
+			BinPath: filepath.Join(t.TempDir(), "missing"),
+			RunDir:  t.TempDir(),
+		}
+		assert.Error(t, s.Supervise())
+		assert.ErrorIs(t, s.Stop(), ErrNotStarted)
+	})
+
+	require.NoError(t, s.Supervise())
+	assert.True(t, s.IsRunning())
+	require.NoError(t, s.Stop())
+
+	t.Run("after_stop", func(t *testing.T) {
+		assertNotRunning(t, true)
+		assert.NoError(t, s.Stop(), "Stopping a stopped supervisor should be a no-op")
+	})
+}
+
+func TestSupervisor_GoroutineLabels(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: sleep.binPath,
+		Args:    sleep.binArgs,
+		RunDir:  t.TempDir(),
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var profile strings.Builder
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+	assert.Contains(t, profile.String(), `labels: {"supervisor":"`+t.Name()+`"}`)
+}
+
+func TestShutdownBarrier(t *testing.T) {
+	sleep := selectCmd(t,
+		cmd{"sleep", []string{"60"}},
+		cmd{"powershell", []string{"-noprofile", "-noninteractive", "-command", "Start-Sleep -Seconds 60"}},
+	)
+
+	t.Run("lifted", func(t *testing.T) {
+		barrier := make(chan struct{})
+		s := Supervisor{
+			Name:            t.Name(),
+			BinPath:         sleep.binPath,
+			Args:            sleep.binArgs,
+			RunDir:          t.TempDir(),
+			TimeoutStop:     time.Minute,
+			ShutdownBarrier: barrier,
+		}
+		require.NoError(t, s.Supervise())
+
+		stopped := make(chan error, 1)
+		go func() { stopped <- s.Stop() }()
+		select {
+		case err := <-stopped:
+			require.Fail(t, "Stopped before the barrier has been lifted", "%v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		assert.Equal(t, ProcessStateRunning, s.Snapshot().State, "Process should still be running")
+
+		close(barrier)
+		select {
+		case err := <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(10 * time.Second):
+			assert.Fail(t, "Not stopped after the barrier has been lifted")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s := Supervisor{
+			Name:            t.Name(),
+			BinPath:         sleep.binPath,
+			Args:            sleep.binArgs,
+			RunDir:          t.TempDir(),
+			TimeoutStop:     100 * time.Millisecond,
+			ShutdownBarrier: make(chan struct{}),
+		}
+		require.NoError(t, s.Supervise())
+		start := time.Now()
+		require.NoError(t, s.Stop())
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+}
+
 type cmd struct {
 	binPath string
 	binArgs []string
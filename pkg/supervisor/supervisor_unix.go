@@ -87,6 +87,16 @@ Loop:
 // `_KOS_MANAGED=yes`. This function does not delete the old pidFile as
 // this is done by the caller.
 func (s *Supervisor) maybeKillPidFile() error {
+	if stale, err := s.isPidFileFromPreviousBoot(); err != nil {
+		return err
+	} else if stale {
+		s.log.Infof("Removing PID file %s from previous boot", s.PidFile)
+		if err := os.Remove(s.PidFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale pid file %s: %w", s.PidFile, err)
+		}
+		return nil
+	}
+
 	pid, err := os.ReadFile(s.PidFile)
 	if os.IsNotExist(err) {
 		return nil
@@ -106,6 +116,147 @@ func (s *Supervisor) maybeKillPidFile() error {
 	return nil
 }
 
+// isPidFileFromPreviousBoot checks if the PID file has been written before
+// s.BootStampFile has been modified, i.e. before the last OS boot. A missing
+// boot stamp file means that the boot time is unknown.
+func (s *Supervisor) isPidFileFromPreviousBoot() (bool, error) {
+	if s.BootStampFile == "" {
+		return false, nil
+	}
+
+	bootStamp, err := os.Stat(s.BootStampFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to stat boot stamp file %s: %w", s.BootStampFile, err)
+	}
+
+	pidFile, err := os.Stat(s.PidFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to stat pid file %s: %w", s.PidFile, err)
+	}
+
+	return pidFile.ModTime().Before(bootStamp.ModTime()), nil
+}
+
+// setPriority applies s.ProcessPriority as the nice value of the given PID.
+// New threads inherit the nice value of the thread that creates them, but the
+// process may have created threads before it has been applied. Hence, the
+// threads are listed repeatedly, until no more unknown threads show up.
+func (s *Supervisor) setPriority(pid int) {
+	reniced := make(map[int]bool)
+	for {
+		tids, err := threadIDs(pid)
+		if err != nil {
+			s.log.WithError(err).Warnf("Failed to set priority of pid %d to %d", pid, s.ProcessPriority)
+			return
+		}
+
+		done := true
+		for _, tid := range tids {
+			if reniced[tid] {
+				continue
+			}
+			reniced[tid], done = true, false
+			err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, s.ProcessPriority)
+			if err != nil && !errors.Is(err, syscall.ESRCH) {
+				s.log.WithError(err).Warnf("Failed to set priority of thread %d of pid %d to %d", tid, pid, s.ProcessPriority)
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// stopProcessGroup terminates the process group of the supervised process,
+// which has been created by DetachAttr or joined in WarmRestartMode, and waits
+// until the process exited. Sends SIGKILL to the group if any of its processes
+// is still running after the stop timeout. Returns whether the group
+// terminated without being killed.
+func (s *Supervisor) stopProcessGroup(waitResult <-chan error) bool {
+	pgid := s.cmd.Process.Pid
+	if s.WarmRestartMode && s.processGroup != 0 {
+		pgid = s.processGroup
+	}
+	s.log.Infof("Shutting down process group %d", pgid)
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		s.log.Warnf("Failed to send SIGTERM to process group %d: %s", pgid, err)
+	}
+
+	deadline := time.NewTimer(s.stopTimeout())
+	defer deadline.Stop()
+	checkTicker := time.NewTicker(exitCheckInterval)
+	defer checkTicker.Stop()
+
+	for exited := false; ; {
+		select {
+		case <-waitResult:
+			exited, waitResult = true, nil
+		case <-checkTicker.C:
+			// Signal zero checks if the group still exists.
+			if exited && errors.Is(syscall.Kill(-pgid, 0), syscall.ESRCH) {
+				return true
+			}
+		case <-deadline.C:
+			s.log.Infof("Killing process group %d", pgid)
+			if err := syscall.Kill(-pgid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+				s.log.Warnf("Failed to send SIGKILL to process group %d: %s", pgid, err)
+			}
+			if !exited {
+				<-waitResult
+			}
+			return false
+		}
+	}
+}
+
+// stopProcess suspends the given process by sending it SIGSTOP.
+func stopProcess(p *os.Process) error {
+	if err := p.Signal(syscall.SIGSTOP); err != nil {
+		return fmt.Errorf("failed to send SIGSTOP: %w", err)
+	}
+	return nil
+}
+
+// continueProcess resumes the given process by sending it SIGCONT.
+func continueProcess(p *os.Process) error {
+	if err := p.Signal(syscall.SIGCONT); err != nil {
+		return fmt.Errorf("failed to send SIGCONT: %w", err)
+	}
+	return nil
+}
+
+// findAdoptableProcess returns the process with the given PID, if it's still
+// running.
+func findAdoptableProcess(pid int) (*os.Process, error) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	// Signal zero checks if the process still exists.
+	if err := p.Signal(syscall.Signal(0)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// waitForAdoptedProcess waits until the given process exited. Adopted
+// processes aren't children of this process, so they can't be waited for and
+// their exit status remains unknown.
+func waitForAdoptedProcess(p *os.Process) error {
+	checkTicker := time.NewTicker(exitCheckInterval)
+	defer checkTicker.Stop()
+	for {
+		<-checkTicker.C
+		if err := p.Signal(syscall.Signal(0)); errors.Is(err, os.ErrProcessDone) {
+			return nil
+		}
+	}
+}
+
 func (s *Supervisor) shouldKillProcess(pid int) (bool, error) {
 	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
 	if os.IsNotExist(err) {
@@ -117,7 +268,9 @@ func (s *Supervisor) shouldKillProcess(pid int) (bool, error) {
 	// only kill process if it has the expected cmd
 	cmd := strings.Split(string(cmdline), "\x00")
 	if cmd[0] != s.BinPath {
-		return false, nil
+		if s.Sandbox != SandboxGVisor || !isGVisorCmdline(cmd, s.SandboxBinary, s.BinPath) {
+			return false, nil
+		}
 	}
 
 	//only kill process if it has the _KOS_MANAGED env set
@@ -0,0 +1,85 @@
+//go:build unix
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKillProcessGroup(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		script string
+	}{
+		{"terminate", `sleep 100 & echo $! >"$0"; exec sleep 100`},
+		// Ignored signals are inherited by child processes.
+		{"kill", `trap "" TERM; sleep 100 & echo $! >"$0"; exec sleep 100`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pidFile := filepath.Join(t.TempDir(), "grandchild")
+			s := Supervisor{
+				Name:             t.Name(),
+				BinPath:          selectCmd(t, cmd{binPath: "sh"}).binPath,
+				RunDir:           t.TempDir(),
+				Args:             []string{"-c", test.script, pidFile},
+				TimeoutStop:      100 * time.Millisecond,
+				KillProcessGroup: true,
+			}
+			require.NoError(t, s.Supervise())
+
+			var pid int
+			require.Eventually(t, func() bool {
+				content, err := os.ReadFile(pidFile)
+				if err == nil {
+					pid, err = strconv.Atoi(strings.TrimSpace(string(content)))
+				}
+				return err == nil
+			}, 10*time.Second, 10*time.Millisecond)
+			require.NoError(t, syscall.Kill(pid, 0), "Grandchild isn't running")
+
+			require.NoError(t, s.Stop())
+			assert.Eventually(t, func() bool { return !isRunning(pid) }, 10*time.Second, 10*time.Millisecond,
+				"Grandchild is still running")
+		})
+	}
+}
+
+// isRunning checks whether the given PID refers to a process that's neither
+// gone nor a zombie.
+func isRunning(pid int) bool {
+	if errors.Is(syscall.Kill(pid, 0), syscall.ESRCH) {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return !errors.Is(err, os.ErrNotExist)
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
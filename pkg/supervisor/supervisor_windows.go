@@ -16,6 +16,11 @@ limitations under the License.
 
 package supervisor
 
+import (
+	"errors"
+	"os"
+)
+
 // maybeKillPidFile checks kills the process in the pidFile if it's has
 // the same binary as the supervisor's. This function does not delete
 // the old pidFile as this is done by the caller.
@@ -23,3 +28,35 @@ func (s *Supervisor) maybeKillPidFile() error {
 	s.log.Warnf("maybeKillPidFile is not implemented on Windows")
 	return nil
 }
+
+// setPriority is not implemented on Windows.
+func (s *Supervisor) setPriority(int) {
+	s.log.Warnf("Process priority is not implemented on Windows")
+}
+
+// stopProcessGroup is not implemented on Windows.
+func (s *Supervisor) stopProcessGroup(<-chan error) bool {
+	panic("process groups are not implemented on Windows")
+}
+
+// stopProcess is not implemented on Windows.
+func stopProcess(*os.Process) error {
+	return errors.New("suspending processes is not implemented on Windows")
+}
+
+// continueProcess is not implemented on Windows.
+func continueProcess(*os.Process) error {
+	return errors.New("resuming processes is not implemented on Windows")
+}
+
+// findAdoptableProcess returns the process with the given PID, if it's still
+// running.
+func findAdoptableProcess(pid int) (*os.Process, error) {
+	return os.FindProcess(pid)
+}
+
+// waitForAdoptedProcess waits until the given process exited.
+func waitForAdoptedProcess(p *os.Process) error {
+	_, err := p.Wait()
+	return err
+}
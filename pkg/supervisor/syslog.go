@@ -0,0 +1,101 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// syslogOutput forwards the output of a supervised process to the local
+// syslog daemon.
+type syslogOutput struct {
+	conn           io.Closer
+	stdout, stderr *syslogLineWriter
+}
+
+func (o *syslogOutput) flush() {
+	o.stdout.flush()
+	o.stderr.flush()
+}
+
+func (o *syslogOutput) Close() error {
+	o.flush()
+	return o.conn.Close()
+}
+
+// syslogLineWriter implements [io.Writer] by sending each line as a separate
+// syslog message.
+type syslogLineWriter struct {
+	mu   sync.Mutex
+	send func(line string) error
+	buf  []byte
+}
+
+// Write implements [io.Writer].
+func (w *syslogLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(w.buf[:idx])
+		w.buf = w.buf[idx+1:]
+		if err := w.send(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// flush sends any incomplete last line.
+func (w *syslogLineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		_ = w.send(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// reconnectSyslog closes the connection to the syslog daemon used for the
+// previous run of the supervised process, if any, and opens a new one.
+func (s *Supervisor) reconnectSyslog() error {
+	s.closeSyslog()
+	out, err := dialSyslog(s.SyslogIdentifier)
+	if err != nil {
+		return err
+	}
+	s.syslogOut = out
+	return nil
+}
+
+func (s *Supervisor) closeSyslog() {
+	if s.syslogOut == nil {
+		return
+	}
+	if err := s.syslogOut.Close(); err != nil {
+		s.log.WithError(err).Warn("Failed to close syslog connection")
+	}
+	s.syslogOut = nil
+}
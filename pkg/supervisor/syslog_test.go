@@ -0,0 +1,126 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSyslog struct {
+	mu       sync.Mutex
+	tags     []string
+	messages []string
+	closed   int
+}
+
+func (f *fakeSyslog) dial(tag string) (*syslogOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tags = append(f.tags, tag)
+	send := func(priority string) func(string) error {
+		return func(line string) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.messages = append(f.messages, priority+" "+line)
+			return nil
+		}
+	}
+	return &syslogOutput{
+		conn:   f,
+		stdout: &syslogLineWriter{send: send("info")},
+		stderr: &syslogLineWriter{send: send("err")},
+	}, nil
+}
+
+func (f *fakeSyslog) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed++
+	return nil
+}
+
+func TestSyslogLineWriter(t *testing.T) {
+	var lines []string
+	w := syslogLineWriter{send: func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}}
+
+	for _, chunk := range []string{"fir", "st\nsecond\n", "\nlast"} {
+		n, err := w.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	assert.Equal(t, []string{"first", "second", ""}, lines)
+
+	w.flush()
+	assert.Equal(t, []string{"first", "second", "", "last"}, lines)
+}
+
+func TestSyslogIdentifier(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Syslog is not supported on Windows")
+	}
+
+	var fake fakeSyslog
+	oldDial := dialSyslog
+	dialSyslog = fake.dial
+	t.Cleanup(func() { dialSyslog = oldDial })
+
+	logFile := filepath.Join(t.TempDir(), "out.log")
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo out; printf err >&2"}})
+	s := Supervisor{
+		Name:             t.Name(),
+		BinPath:          sh.binPath,
+		Args:             sh.binArgs,
+		RunDir:           t.TempDir(),
+		TimeoutRespawn:   10 * time.Millisecond,
+		StdoutFile:       logFile,
+		SyslogIdentifier: "k0s-test",
+	}
+	require.NoError(t, s.Supervise())
+
+	// Each run gets its own connection.
+	require.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.tags) >= 2
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NoError(t, s.Stop())
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, tag := range fake.tags {
+		assert.Equal(t, "k0s-test", tag)
+	}
+	assert.Equal(t, len(fake.tags), fake.closed, "All connections should have been closed")
+
+	assert.Contains(t, fake.messages, "info out")
+	assert.Contains(t, fake.messages, "err err")
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Empty(t, content, "Output should not be written to StdoutFile")
+}
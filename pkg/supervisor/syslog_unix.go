@@ -0,0 +1,39 @@
+//go:build !windows
+
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// dialSyslog connects to the local syslog daemon. It's a variable, so that
+// tests can replace it.
+var dialSyslog = func(tag string) (*syslogOutput, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return &syslogOutput{
+		conn:   w,
+		stdout: &syslogLineWriter{send: w.Info},
+		stderr: &syslogLineWriter{send: w.Err},
+	}, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import "os"
+
+// defaultTerminationLogMaxBytes is the default of TerminationLogMaxBytes, the
+// same as the limit that Kubernetes applies to termination messages.
+const defaultTerminationLogMaxBytes = 4096
+
+// writeTerminationLog writes the most recent output of the supervised process
+// to TerminationLog, if configured.
+func (s *Supervisor) writeTerminationLog() {
+	if s.TerminationLog == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	output := s.output
+	s.mutex.Unlock()
+
+	var log []byte
+	if output != nil {
+		for _, line := range output.snapshot() {
+			log = append(append(log, line...), '\n')
+		}
+	}
+	if maxBytes := s.TerminationLogMaxBytes; len(log) > maxBytes {
+		log = log[len(log)-maxBytes:]
+	}
+
+	// The file is written in place, as it's usually bind mounted by the
+	// container runtime and can't be replaced atomically.
+	if err := os.WriteFile(s.TerminationLog, log, 0644); err != nil {
+		s.log.WithError(err).Warnf("Failed to write termination log %s", s.TerminationLog)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminationLog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	terminationLog := filepath.Join(t.TempDir(), "termination-log")
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo out; echo err >&2; exit 1"}})
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Hour,
+		TerminationLog: terminationLog,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	var content []byte
+	require.Eventually(t, func() bool {
+		var err error
+		content, err = os.ReadFile(terminationLog)
+		return err == nil && len(content) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"out", "err"}, strings.Fields(string(content)))
+}
+
+func TestTerminationLog_DisableLogging(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	hook := new(logtest.Hook)
+	std := logrus.StandardLogger()
+	oldHooks := std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	t.Cleanup(func() { std.ReplaceHooks(oldHooks) })
+
+	terminationLog := filepath.Join(t.TempDir(), "termination-log")
+	sh := selectCmd(t, cmd{"sh", []string{"-c", "echo out; exit 1"}})
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        sh.binPath,
+		Args:           sh.binArgs,
+		RunDir:         t.TempDir(),
+		TimeoutRespawn: 1 * time.Hour,
+		TerminationLog: terminationLog,
+		DisableLogging: true,
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop()) })
+
+	// The output is remembered, even though it isn't logged.
+	var content []byte
+	require.Eventually(t, func() bool {
+		var err error
+		content, err = os.ReadFile(terminationLog)
+		return err == nil && len(content) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "out", strings.TrimSpace(string(content)))
+
+	for _, entry := range hook.AllEntries() {
+		assert.NotEqual(t, t.Name(), entry.Data["component"], "Unexpected log entry: %s", entry.Message)
+	}
+}
+
+func TestTerminationLog_MaxBytes(t *testing.T) {
+	s := Supervisor{
+		TerminationLog:         filepath.Join(t.TempDir(), "termination-log"),
+		TerminationLogMaxBytes: 8,
+		output:                 newOutputBuffer(10),
+	}
+	s.output.add("first")
+	s.output.add("second")
+
+	s.writeTerminationLog()
+	if content, err := os.ReadFile(s.TerminationLog); assert.NoError(t, err) {
+		assert.Equal(t, "\nsecond\n", string(content))
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/k0sproject/k0s/pkg/supervisor"
+)
+
+// MockSupervisedProcess is a [supervisor.SupervisedProcess] for component
+// tests. Its behavior can be configured by setting the On* fields before it's
+// handed to the component under test.
+type MockSupervisedProcess struct {
+	// Called on each call to Supervise. The mock is considered running if it
+	// returns nil. Defaults to returning nil.
+	OnSupervise func() error
+	// Called on each call to Stop, unless the mock has never been started.
+	// Defaults to returning nil.
+	OnStop func() error
+	// The process returned by GetProcess while the mock is running.
+	Process *os.Process
+	// The state returned by Snapshot. Its State is set according to whether
+	// the mock is running.
+	State supervisor.SupervisorState
+
+	mu         sync.Mutex
+	started    bool
+	running    bool
+	supervised int
+	stopped    int
+}
+
+var _ supervisor.SupervisedProcess = (*MockSupervisedProcess)(nil)
+
+// NewMockSupervisedProcess returns a new mock. The test fails if the mock is
+// still running when the test finishes.
+func NewMockSupervisedProcess(t *testing.T) *MockSupervisedProcess {
+	m := new(MockSupervisedProcess)
+	t.Cleanup(func() {
+		assert.False(t, m.IsRunning(), "Supervised process hasn't been stopped")
+	})
+	return m
+}
+
+// Supervise implements [supervisor.SupervisedProcess].
+func (m *MockSupervisedProcess) Supervise() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.supervised++
+	if m.OnSupervise != nil {
+		if err := m.OnSupervise(); err != nil {
+			return err
+		}
+	}
+	m.started, m.running = true, true
+	return nil
+}
+
+// Stop implements [supervisor.SupervisedProcess]. Returns
+// [supervisor.ErrNotStarted] if Supervise has never succeeded.
+func (m *MockSupervisedProcess) Stop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopped++
+	if !m.started {
+		return supervisor.ErrNotStarted
+	}
+	m.running = false
+	if m.OnStop != nil {
+		return m.OnStop()
+	}
+	return nil
+}
+
+// GetProcess implements [supervisor.SupervisedProcess].
+func (m *MockSupervisedProcess) GetProcess() *os.Process {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.running {
+		return nil
+	}
+	return m.Process
+}
+
+// IsRunning implements [supervisor.SupervisedProcess].
+func (m *MockSupervisedProcess) IsRunning() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// Snapshot implements [supervisor.SupervisedProcess].
+func (m *MockSupervisedProcess) Snapshot() supervisor.SupervisorState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.State
+	if m.running {
+		state.State = supervisor.ProcessStateRunning
+	} else {
+		state.State = supervisor.ProcessStateStopped
+	}
+	return state
+}
+
+// Calls returns how often Supervise and Stop have been called.
+func (m *MockSupervisedProcess) Calls() (supervise, stop int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.supervised, m.stopped
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/supervisor"
+)
+
+func TestMockSupervisedProcess(t *testing.T) {
+	t.Run("lifecycle", func(t *testing.T) {
+		underTest := NewMockSupervisedProcess(t)
+		underTest.Process = &os.Process{Pid: 4711}
+		underTest.State.Name = "mock"
+
+		assert.ErrorIs(t, underTest.Stop(), supervisor.ErrNotStarted)
+		assert.Nil(t, underTest.GetProcess())
+
+		require.NoError(t, underTest.Supervise())
+		assert.True(t, underTest.IsRunning())
+		assert.Equal(t, 4711, underTest.GetProcess().Pid)
+		assert.Equal(t, supervisor.SupervisorState{Name: "mock", State: supervisor.ProcessStateRunning}, underTest.Snapshot())
+
+		require.NoError(t, underTest.Stop())
+		assert.False(t, underTest.IsRunning())
+		assert.Nil(t, underTest.GetProcess())
+		assert.Equal(t, supervisor.ProcessStateStopped, underTest.Snapshot().State)
+
+		supervise, stop := underTest.Calls()
+		assert.Equal(t, 1, supervise)
+		assert.Equal(t, 2, stop)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		superviseErr, stopErr := errors.New("supervise"), errors.New("stop")
+		underTest := NewMockSupervisedProcess(t)
+		underTest.OnSupervise = func() error { return superviseErr }
+		underTest.OnStop = func() error { return stopErr }
+
+		assert.Same(t, superviseErr, underTest.Supervise())
+		assert.False(t, underTest.IsRunning())
+
+		underTest.OnSupervise = nil
+		require.NoError(t, underTest.Supervise())
+		assert.Same(t, stopErr, underTest.Stop())
+		assert.False(t, underTest.IsRunning())
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// TestSupervisor mimics the lifecycle of a supervisor.Supervisor for unit
+// tests, without running any OS processes. Instead, Run is executed in a
+// goroutine whose context is cancelled whenever a supervised process would be
+// asked to terminate.
+type TestSupervisor struct {
+	// The function that simulates the supervised process.
+	Run func(ctx context.Context)
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+	ready    chan struct{}
+	exitCode *int
+}
+
+// Supervise starts running Run in a goroutine. It's a no-op if it's already
+// running.
+func (s *TestSupervisor) Supervise() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.cancel, s.done, s.exitCode = cancel, done, nil
+	ready := s.readyLocked()
+
+	go func() {
+		defer close(done)
+		close(ready)
+		s.Run(ctx)
+	}()
+
+	return nil
+}
+
+// Stop cancels the context of Run and waits for it to return.
+func (s *TestSupervisor) Stop() error {
+	s.terminate(nil)
+	return nil
+}
+
+// ExitWith simulates an exit of the supervised process with the given exit
+// code. It cancels the context of Run and waits for it to return.
+func (s *TestSupervisor) ExitWith(code int) {
+	s.terminate(&code)
+}
+
+func (s *TestSupervisor) terminate(exitCode *int) {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	if cancel == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.cancel, s.ready = nil, nil
+	s.exitCode = exitCode
+	s.mu.Unlock()
+
+	cancel()
+	<-done
+}
+
+// Ready returns a channel that is closed as soon as Run has been started.
+func (s *TestSupervisor) Ready() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readyLocked()
+}
+
+func (s *TestSupervisor) readyLocked() chan struct{} {
+	if s.ready == nil {
+		s.ready = make(chan struct{})
+	}
+	return s.ready
+}
+
+// ExitCode returns the exit code passed to ExitWith, if the simulated process
+// has exited that way.
+func (s *TestSupervisor) ExitCode() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exitCode == nil {
+		return 0, false
+	}
+	return *s.exitCode, true
+}
+
+// GetProcess always returns nil, as there's no OS process.
+func (s *TestSupervisor) GetProcess() *os.Process {
+	return nil
+}
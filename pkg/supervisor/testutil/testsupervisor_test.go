@@ -0,0 +1,61 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestSupervisor(t *testing.T) {
+	runs := make(chan context.Context, 2)
+	underTest := TestSupervisor{Run: func(ctx context.Context) {
+		runs <- ctx
+		<-ctx.Done()
+	}}
+
+	ready := underTest.Ready()
+	require.NoError(t, underTest.Supervise())
+	<-ready
+	ctx := <-runs
+
+	require.NoError(t, underTest.Supervise(), "Supervising twice should be a no-op")
+	assert.Empty(t, runs)
+
+	underTest.ExitWith(42)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	code, exited := underTest.ExitCode()
+	assert.True(t, exited)
+	assert.Equal(t, 42, code)
+
+	require.NoError(t, underTest.Supervise())
+	<-underTest.Ready()
+	ctx = <-runs
+	_, exited = underTest.ExitCode()
+	assert.False(t, exited)
+
+	require.NoError(t, underTest.Stop())
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	_, exited = underTest.ExitCode()
+	assert.False(t, exited)
+	assert.Nil(t, underTest.GetProcess())
+
+	require.NoError(t, underTest.Stop(), "Stopping twice should be a no-op")
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The time strace is given to detach from a process once tracing is stopped.
+const straceDetachTimeout = 10 * time.Second
+
+// Trace traces the file, network and process related syscalls of the
+// supervised process and its descendants using strace, until ctx is done or
+// the process exits. The trace is written to output. The process continues to
+// run unaffected, apart from being slowed down. Requires strace to be in
+// PATH. Linux only.
+func (s *Supervisor) Trace(ctx context.Context, output io.Writer) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("syscall traces are not supported on %s", runtime.GOOS)
+	}
+
+	strace, err := exec.LookPath("strace")
+	if err != nil {
+		return fmt.Errorf("strace is required to trace syscalls: %w", err)
+	}
+
+	pid := s.Snapshot().PID
+	if pid == 0 {
+		return s.errNotRunning()
+	}
+
+	cmd := exec.CommandContext(ctx, strace, "-p", strconv.Itoa(pid), "-f", "-e", "trace=file,network,process")
+	cmd.Stdout, cmd.Stderr = output, output
+	// Let strace detach gracefully when ctx is done.
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = straceDetachTimeout
+
+	s.log.Infof("Tracing pid %d", pid)
+	err = cmd.Run()
+	s.log.Infof("Stopped tracing pid %d", pid)
+
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to trace pid %d: %w", pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a [strings.Builder] that's safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTrace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Syscall traces are Linux only")
+	}
+
+	// A fake strace that echoes its args and runs until it's terminated.
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "strace"), []byte(`#!/bin/sh
+trap 'echo detached >&2; exit 0' TERM
+echo "$@" >&2
+while :; do sleep 0.01; done
+`), 0700))
+
+	pids := make(chan int, 1)
+	s := Supervisor{
+		Name:    t.Name(),
+		BinPath: selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:  t.TempDir(),
+		Args:    []string{"-c", "exec sleep 60"},
+		OnStart: func(pid int) { pids <- pid },
+	}
+	require.NoError(t, s.Supervise())
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+	pid := <-pids
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ctx, cancel := context.WithCancel(context.Background())
+	var output syncBuffer
+	traced := make(chan error, 1)
+	go func() { traced <- s.Trace(ctx, &output) }()
+
+	expected := "-p " + strconv.Itoa(pid) + " -f -e trace=file,network,process\n"
+	require.Eventually(t, func() bool {
+		return output.String() == expected
+	}, 10*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-traced:
+		assert.NoError(t, err)
+		assert.Equal(t, expected+"detached\n", output.String())
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "Tracing didn't stop")
+	}
+}
+
+func TestTrace_NoStrace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Syscall traces are Linux only")
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	var s Supervisor
+	err := s.Trace(context.Background(), io.Discard)
+	assert.ErrorContains(t, err, "strace is required to trace syscalls")
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Propagates span contexts in the W3C Trace Context format.
+	TracePropagationW3C = "w3c"
+	// Propagates span contexts in the single header B3 format.
+	TracePropagationB3 = "b3"
+)
+
+func validateTracePropagationFormat(format string) error {
+	switch format {
+	case "", TracePropagationW3C, TracePropagationB3:
+		return nil
+	default:
+		return fmt.Errorf("unsupported trace propagation format: %q", format)
+	}
+}
+
+// traceEnv returns the environment variables that propagate the given span
+// context in the given format. The variables are named like the propagation
+// headers, but in upper case. Returns nothing if the span context is invalid.
+func traceEnv(spanContext trace.SpanContext, format string) []string {
+	var propagator propagation.TextMapPropagator = propagation.TraceContext{}
+	if format == TracePropagationB3 {
+		propagator = b3Propagator{}
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), spanContext), carrier)
+
+	env := make([]string, 0, len(carrier))
+	for key, value := range carrier {
+		env = append(env, strings.ToUpper(key)+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// b3Propagator injects span contexts in the single header B3 format, see
+// https://github.com/openzipkin/b3-propagation#single-header.
+type b3Propagator struct{}
+
+// Inject implements [propagation.TextMapPropagator].
+func (b3Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return
+	}
+
+	sampled := "0"
+	if spanContext.IsSampled() {
+		sampled = "1"
+	}
+	carrier.Set("b3", spanContext.TraceID().String()+"-"+spanContext.SpanID().String()+"-"+sampled)
+}
+
+// Extract implements [propagation.TextMapPropagator]. Extraction isn't
+// supported, as the supervisor only passes span contexts on.
+func (b3Propagator) Extract(ctx context.Context, _ propagation.TextMapCarrier) context.Context {
+	return ctx
+}
+
+// Fields implements [propagation.TextMapPropagator].
+func (b3Propagator) Fields() []string {
+	return []string{"b3"}
+}
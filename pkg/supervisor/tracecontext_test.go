@@ -0,0 +1,99 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testSpanContext(t *testing.T) trace.SpanContext {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	traceState, err := trace.ParseTraceState("k0s=join")
+	require.NoError(t, err)
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: traceState,
+	})
+}
+
+func TestTraceEnv(t *testing.T) {
+	spanContext := testSpanContext(t)
+
+	assert.Equal(t, []string{
+		"TRACEPARENT=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"TRACESTATE=k0s=join",
+	}, traceEnv(spanContext, TracePropagationW3C))
+	assert.Equal(t, traceEnv(spanContext, TracePropagationW3C), traceEnv(spanContext, ""))
+	assert.Equal(t, []string{
+		"B3=4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	}, traceEnv(spanContext, TracePropagationB3))
+
+	assert.Empty(t, traceEnv(trace.SpanContext{}, TracePropagationW3C))
+	assert.Empty(t, traceEnv(trace.SpanContext{}, TracePropagationB3))
+}
+
+func TestPropagateTrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test process requires a POSIX shell")
+	}
+
+	envFile := filepath.Join(t.TempDir(), "env")
+	s := Supervisor{
+		Name:           t.Name(),
+		BinPath:        selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:         t.TempDir(),
+		Args:           []string{"-c", `echo "$TRACEPARENT" >"$0.tmp"; mv "$0.tmp" "$0"; exec sleep 10`, envFile},
+		PropagateTrace: true,
+	}
+	ctx := trace.ContextWithSpanContext(context.TODO(), testSpanContext(t))
+	require.NoError(t, s.SuperviseContext(ctx))
+	t.Cleanup(func() { assert.NoError(t, s.Stop(), "Failed to stop") })
+
+	var env []byte
+	require.Eventually(t, func() bool {
+		var err error
+		env, err = os.ReadFile(envFile)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", strings.TrimSpace(string(env)))
+}
+
+func TestPropagateTrace_InvalidFormat(t *testing.T) {
+	s := Supervisor{
+		Name:                   t.Name(),
+		BinPath:                selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:                 t.TempDir(),
+		PropagateTrace:         true,
+		TracePropagationFormat: "jaeger",
+	}
+	assert.ErrorContains(t, s.Supervise(), `unsupported trace propagation format: "jaeger"`)
+}
@@ -0,0 +1,26 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+// TrampolineCommand is the hidden k0s subcommand via which supervised
+// processes are started if they need to be prepared by a process of their
+// own, between fork and exec, e.g. for ChildSubreaper or MountBinds. The
+// current executable is re-executed with this subcommand, followed by the
+// options and command line of the supervised process, which need to be passed
+// on to [RunTrampoline]. It's k0s in production, so other executables using
+// those features need to handle the subcommand themselves.
+const TrampolineCommand = "supervisor-exec"
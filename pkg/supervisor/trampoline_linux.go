@@ -0,0 +1,102 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// RunTrampoline prepares the current process as described by args, and then
+// replaces it with the supervised process. It's the implementation of
+// [TrampolineCommand], with args being the arguments following it. Returns
+// only if something went wrong.
+//
+// Go's os/exec can't run code between fork and exec, and the multi-threaded Go
+// runtime can't safely change process-wide attributes like the mount
+// namespace after the fact. Instead, the prepared attributes are preserved
+// when the trampoline replaces itself with the actual binary.
+func RunTrampoline(args []string) error {
+	flags := flag.NewFlagSet(TrampolineCommand, flag.ContinueOnError)
+	subreaper := flags.Bool("child-subreaper", false, "make the process a child subreaper")
+	mountBinds := flags.String("mount-binds", "", "the bind mounts to set up, as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) < 1 {
+		return errors.New("nothing to execute")
+	}
+
+	if *mountBinds != "" {
+		var binds []MountBind
+		if err := json.Unmarshal([]byte(*mountBinds), &binds); err != nil {
+			return fmt.Errorf("failed to parse bind mounts: %w", err)
+		}
+		if err := setUpMountBinds(binds); err != nil {
+			return fmt.Errorf("failed to set up bind mounts: %w", err)
+		}
+	}
+	if *subreaper {
+		if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to become a child subreaper: %w", err)
+		}
+	}
+
+	err := syscall.Exec(args[0], args, os.Environ())
+	return fmt.Errorf("failed to execute %s: %w", args[0], err)
+}
+
+// wrapInTrampoline modifies cmd, so that it's executed via the
+// [TrampolineCommand] of the current executable, which makes itself a child
+// subreaper and sets up the given bind mounts in a new mount namespace, as
+// requested.
+func wrapInTrampoline(cmd *exec.Cmd, subreaper bool, binds []MountBind) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine executable for preparing the process: %w", err)
+	}
+
+	args := []string{self, TrampolineCommand}
+	if subreaper {
+		args = append(args, "--child-subreaper")
+	}
+	if len(binds) > 0 {
+		data, err := json.Marshal(binds)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--mount-binds="+string(data))
+
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWNS
+	}
+	args = append(args, "--", cmd.Path)
+
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = self
+	return nil
+}
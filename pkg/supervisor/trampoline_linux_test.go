@@ -0,0 +1,58 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain lets the test binary act as k0s when it's re-executed via
+// TrampolineCommand.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == TrampolineCommand {
+		err := RunTrampoline(os.Args[2:])
+		fmt.Fprintln(os.Stderr, "Trampoline failed:", err)
+		os.Exit(127)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestWrapInTrampoline(t *testing.T) {
+	self, err := os.Executable()
+	require.NoError(t, err)
+
+	cmd := exec.Command("/bin/true", "--foo", "bar")
+	require.NoError(t, wrapInTrampoline(cmd, true, []MountBind{{Source: "/a", Dest: "/b"}}))
+
+	assert.Equal(t, self, cmd.Path)
+	assert.Equal(t, []string{
+		self, TrampolineCommand,
+		"--child-subreaper", `--mount-binds=[{"source":"/a","dest":"/b"}]`,
+		"--", "/bin/true", "--foo", "bar",
+	}, cmd.Args)
+}
+
+func TestRunTrampoline_NothingToExecute(t *testing.T) {
+	assert.ErrorContains(t, RunTrampoline([]string{"--child-subreaper"}), "nothing to execute")
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmRestartMode(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "warm.sock")
+	pgidFile := filepath.Join(t.TempDir(), "pgids")
+
+	// The first instance leaves a child behind that keeps its process group
+	// alive. The second one replaces itself with a long running process.
+	script := `test -S /dev/fd/3 || exit 1
+awk '{print $5}' /proc/$$/stat >>"$0"
+[ "$(wc -l <"$0")" -gt 1 ] && exec sleep 100
+sleep 100 >/dev/null 2>&1 &`
+
+	s := Supervisor{
+		Name:               t.Name(),
+		BinPath:            selectCmd(t, cmd{binPath: "sh"}).binPath,
+		RunDir:             t.TempDir(),
+		Args:               []string{"-c", script, pgidFile},
+		TimeoutStop:        100 * time.Millisecond,
+		TimeoutRespawn:     1 * time.Millisecond,
+		KillProcessGroup:   true,
+		InheritedListeners: []string{socket},
+		WarmRestartMode:    true,
+	}
+	require.NoError(t, s.Supervise())
+
+	var pgids []string
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(pgidFile)
+		if err == nil {
+			pgids = strings.Fields(string(content))
+		}
+		return len(pgids) > 1
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, pgids[0], pgids[1], "Restarted process didn't join the process group")
+
+	conn, err := net.Dial("unix", socket)
+	if assert.NoError(t, err, "Inherited listener isn't accepting connections") {
+		assert.NoError(t, conn.Close())
+	}
+
+	require.NoError(t, s.Stop())
+	assert.NoFileExists(t, socket)
+}
+
+func TestWarmRestartMode_RequiresSingleListener(t *testing.T) {
+	s := Supervisor{
+		Name:            t.Name(),
+		BinPath:         filepath.Join(t.TempDir(), "foo"),
+		RunDir:          t.TempDir(),
+		WarmRestartMode: true,
+	}
+	assert.ErrorContains(t, s.Supervise(), "warm restarts require exactly one inherited listener")
+}
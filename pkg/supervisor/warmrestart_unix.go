@@ -0,0 +1,94 @@
+//go:build unix
+
+/*
+Copyright 2022 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func (s *Supervisor) validateInheritedListeners() error {
+	if s.WarmRestartMode && len(s.InheritedListeners) != 1 {
+		return errors.New("warm restarts require exactly one inherited listener")
+	}
+	return nil
+}
+
+// openInheritedListeners listens on all InheritedListeners, replacing any
+// stale socket files.
+func (s *Supervisor) openInheritedListeners() error {
+	for _, path := range s.InheritedListeners {
+		f, err := listenUnix(path)
+		if err != nil {
+			s.closeInheritedListeners()
+			return fmt.Errorf("failed to listen on %s: %w", path, err)
+		}
+		s.listeners = append(s.listeners, f)
+	}
+	return nil
+}
+
+func listenUnix(path string) (*os.File, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the duplicated file descriptor is kept. The socket file is removed
+	// along with it in closeInheritedListeners.
+	l.SetUnlinkOnClose(false)
+	f, err := l.File()
+	return f, errors.Join(err, l.Close())
+}
+
+func (s *Supervisor) closeInheritedListeners() {
+	for i, f := range s.listeners {
+		path := s.InheritedListeners[i]
+		if err := f.Close(); err != nil {
+			s.log.WithError(err).Warnf("Failed to close inherited listener %s", path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.log.WithError(err).Warnf("Failed to remove socket file %s", path)
+		}
+	}
+	s.listeners, s.processGroup = nil, 0
+}
+
+// joinProcessGroup lets cmd join the process group of the previously started
+// process, if any of its members are still alive. Otherwise, cmd will start a
+// new process group.
+func (s *Supervisor) joinProcessGroup(cmd *exec.Cmd) {
+	if s.processGroup == 0 {
+		return
+	}
+	if err := syscall.Kill(-s.processGroup, 0); err != nil {
+		s.log.WithError(err).Debugf("Not joining process group %d", s.processGroup)
+		s.processGroup = 0
+		return
+	}
+	s.log.Debugf("Joining process group %d", s.processGroup)
+	cmd.SysProcAttr.Pgid = s.processGroup
+}
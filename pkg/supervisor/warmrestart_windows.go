@@ -0,0 +1,38 @@
+/*
+Copyright 2024 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func (s *Supervisor) validateInheritedListeners() error {
+	if len(s.InheritedListeners) > 0 {
+		return errors.New("inherited listeners are not supported on windows")
+	}
+	if s.WarmRestartMode {
+		return errors.New("warm restarts are not supported on windows")
+	}
+	return nil
+}
+
+func (s *Supervisor) openInheritedListeners() error { return nil }
+
+func (s *Supervisor) closeInheritedListeners() {}
+
+func (s *Supervisor) joinProcessGroup(*exec.Cmd) {}